@@ -3,30 +3,111 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/insanjati/fitbyte/internal/cache"
 	"github.com/insanjati/fitbyte/internal/database"
 	"github.com/insanjati/fitbyte/internal/handler"
+	"github.com/insanjati/fitbyte/internal/i18n"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/mailer"
+	"github.com/insanjati/fitbyte/internal/metrics"
 	"github.com/insanjati/fitbyte/internal/middleware"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/oauth"
+	"github.com/insanjati/fitbyte/internal/ratelimit"
 	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/scanner"
 	"github.com/insanjati/fitbyte/internal/service"
 	"github.com/insanjati/fitbyte/internal/storage"
+	"github.com/insanjati/fitbyte/internal/tracing"
 
 	"github.com/caarlos0/env"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 type Config struct {
 	HTTPPort    string `env:"HTTP_PORT" envDefault:"8080"`
 	DatabaseURL string `env:"DATABASE_URL"`
 
+	// Database statement timeouts, DB_OPERATION_TIMEOUTS overrides single operations
+	// e.g. "ActivityRepository.GetUserActivities=5s,UserRepository.UpdateUser=2s"
+	DBReadTimeout       time.Duration `env:"DB_READ_TIMEOUT" envDefault:"3s"`
+	DBWriteTimeout      time.Duration `env:"DB_WRITE_TIMEOUT" envDefault:"5s"`
+	DBOperationTimeouts string        `env:"DB_OPERATION_TIMEOUTS" envDefault:""`
+
+	// Account emails (MAILER: log|smtp). TOKEN_SIGNING_KEY falls back to JWT_SECRET.
+	AppBaseURL           string        `env:"APP_BASE_URL" envDefault:"http://localhost:8080"`
+	TokenSigningKey      string        `env:"TOKEN_SIGNING_KEY" envDefault:""`
+	EmailVerificationTTL time.Duration `env:"EMAIL_VERIFICATION_TTL" envDefault:"48h"`
+	PasswordResetTTL     time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"1h"`
+	RequireVerifiedEmail bool          `env:"REQUIRE_VERIFIED_EMAIL" envDefault:"false"`
+	Mailer               string        `env:"MAILER" envDefault:"log"`
+	MailLogDir           string        `env:"MAIL_LOG_DIR" envDefault:""`
+	SMTPHost             string        `env:"SMTP_HOST" envDefault:""`
+	SMTPPort             int           `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername         string        `env:"SMTP_USERNAME" envDefault:""`
+	SMTPPassword         string        `env:"SMTP_PASSWORD" envDefault:""`
+	SMTPFrom             string        `env:"SMTP_FROM" envDefault:"FitByte <no-reply@fitbyte.local>"`
+
+	// TOTP two-factor authentication, TWO_FACTOR_ENCRYPTION_KEY falls back to TOKEN_SIGNING_KEY
+	TwoFactorIssuer        string        `env:"TWO_FACTOR_ISSUER" envDefault:"FitByte"`
+	TwoFactorEncryptionKey string        `env:"TWO_FACTOR_ENCRYPTION_KEY" envDefault:""`
+	TwoFactorChallengeTTL  time.Duration `env:"TWO_FACTOR_CHALLENGE_TTL" envDefault:"5m"`
+
+	// Deleted accounts can be restored during the grace period, 0 deletes immediately
+	AccountDeletionGrace time.Duration `env:"ACCOUNT_DELETION_GRACE" envDefault:"720h"`
+	AccountPurgeInterval time.Duration `env:"ACCOUNT_PURGE_INTERVAL" envDefault:"1h"`
+
+	// OIDC social login, a provider is enabled when its client ID is set.
+	// APPLE_CLIENT_SECRET is the signed client secret JWT generated for the app.
+	OAuthRedirectBaseURL string `env:"OAUTH_REDIRECT_BASE_URL" envDefault:"http://localhost:8080/api/v1/oauth"`
+	GoogleIssuer         string `env:"GOOGLE_ISSUER" envDefault:"https://accounts.google.com"`
+	GoogleClientID       string `env:"GOOGLE_CLIENT_ID" envDefault:""`
+	GoogleClientSecret   string `env:"GOOGLE_CLIENT_SECRET" envDefault:""`
+	AppleIssuer          string `env:"APPLE_ISSUER" envDefault:"https://appleid.apple.com"`
+	AppleClientID        string `env:"APPLE_CLIENT_ID" envDefault:""`
+	AppleClientSecret    string `env:"APPLE_CLIENT_SECRET" envDefault:""`
+	MockOIDCIssuer       string `env:"MOCK_OIDC_ISSUER" envDefault:""`
+	MockOIDCClientID     string `env:"MOCK_OIDC_CLIENT_ID" envDefault:""`
+	MockOIDCClientSecret string `env:"MOCK_OIDC_CLIENT_SECRET" envDefault:""`
+
+	// Rate limits as "<limit>/<window>", empty disables the limit
+	RateLimitLogin    string `env:"RATE_LIMIT_LOGIN" envDefault:"10/1m"`
+	RateLimitRegister string `env:"RATE_LIMIT_REGISTER" envDefault:"5/1m"`
+	RateLimitAPI      string `env:"RATE_LIMIT_API" envDefault:"300/1m"`
+	RateLimitPassword string `env:"RATE_LIMIT_PASSWORD" envDefault:"5/15m"`
+
+	// Progressive lockout after repeated failed logins for an email
+	LoginMaxAttempts int           `env:"LOGIN_MAX_ATTEMPTS" envDefault:"5"`
+	LoginWindow      time.Duration `env:"LOGIN_WINDOW" envDefault:"15m"`
+	LoginBaseLockout time.Duration `env:"LOGIN_BASE_LOCKOUT" envDefault:"1m"`
+	LoginMaxLockout  time.Duration `env:"LOGIN_MAX_LOCKOUT" envDefault:"1h"`
+
+	// Tracing Configuration (TRACE_EXPORTER: none|stdout|stderr|otlp)
+	TraceExporter     string  `env:"TRACE_EXPORTER" envDefault:"none"`
+	TraceOTLPEndpoint string  `env:"TRACE_OTLP_ENDPOINT" envDefault:""`
+	TraceOTLPInsecure bool    `env:"TRACE_OTLP_INSECURE" envDefault:"true"`
+	TraceServiceName  string  `env:"TRACE_SERVICE_NAME" envDefault:"fitbyte"`
+	TraceSampleRatio  float64 `env:"TRACE_SAMPLE_RATIO" envDefault:"1"`
+
+	// Logging Configuration
+	LogLevel  string `env:"LOG_LEVEL" envDefault:"info"`
+	LogFormat string `env:"LOG_FORMAT" envDefault:"json"`
+
 	// JWT Configuration
 	JWTSecret   string        `env:"JWT_SECRET" envDefault:"your-secret-key"`
 	JWTDuration time.Duration `env:"JWT_DURATION" envDefault:"24h"`
@@ -37,6 +118,10 @@ type Config struct {
 	RedisPassword string `env:"REDIS_PASSWORD" envDefault:""`
 	RedisDB       int    `env:"REDIS_DB" envDefault:"0"`
 
+	// Storage Configuration, STORAGE_BACKEND is minio or local
+	StorageBackend  string `env:"STORAGE_BACKEND" envDefault:"minio"`
+	StorageLocalDir string `env:"STORAGE_LOCAL_DIR" envDefault:"./data/uploads"`
+
 	// MinIO Configuration
 	MinIOEndpoint       string `env:"MINIO_ENDPOINT" envDefault:"minio:9000"`
 	MinIOAccessKey      string `env:"MINIO_ACCESS_KEY" envDefault:"minioadmin"`
@@ -44,6 +129,34 @@ type Config struct {
 	MinIOBucket         string `env:"MINIO_BUCKET" envDefault:"fitbyte-uploads"`
 	MinIOPublicEndpoint string `env:"MINIO_PUBLIC_ENDPOINT" envDefault:"http://localhost:9000"`
 	MinIOUseSSL         bool   `env:"MINIO_USE_SSL" envDefault:"false"`
+	MinIORegion         string `env:"MINIO_REGION" envDefault:"us-east-1"`
+
+	// Uploads
+	FilePresignTTL    time.Duration `env:"FILE_PRESIGN_TTL" envDefault:"15m"`
+	FileSignedURLTTL  time.Duration `env:"FILE_SIGNED_URL_TTL" envDefault:"15m"`
+	FileGCGracePeriod time.Duration `env:"FILE_GC_GRACE_PERIOD" envDefault:"24h"`
+	FileGCInterval    time.Duration `env:"FILE_GC_INTERVAL" envDefault:"1h"`
+
+	// Resumable chunked uploads, UPLOAD_CHUNK_SIZE must be at least 5MB
+	UploadSessionTTL      time.Duration `env:"UPLOAD_SESSION_TTL" envDefault:"24h"`
+	UploadChunkSize       int64         `env:"UPLOAD_CHUNK_SIZE" envDefault:"8388608"`
+	UploadMaxSize         int64         `env:"UPLOAD_MAX_SIZE" envDefault:"1073741824"`
+	UploadCleanupInterval time.Duration `env:"UPLOAD_CLEANUP_INTERVAL" envDefault:"1h"`
+
+	// Malware scanning of uploads (FILE_SCANNER: none|clamav|fake), uploads wait
+	// in quarantine until scanned unless it is none
+	FileScanner      string        `env:"FILE_SCANNER" envDefault:"none"`
+	FileScanInterval time.Duration `env:"FILE_SCAN_INTERVAL" envDefault:"30s"`
+	ClamAVAddress    string        `env:"CLAMAV_ADDRESS" envDefault:"tcp://clamav:3310"`
+	ClamAVTimeout    time.Duration `env:"CLAMAV_TIMEOUT" envDefault:"1m"`
+
+	// Storage quotas per role, 0 means unlimited
+	QuotaUserBytes  int64 `env:"STORAGE_QUOTA_USER_BYTES" envDefault:"524288000"`
+	QuotaUserFiles  int64 `env:"STORAGE_QUOTA_USER_FILES" envDefault:"1000"`
+	QuotaCoachBytes int64 `env:"STORAGE_QUOTA_COACH_BYTES" envDefault:"2147483648"`
+	QuotaCoachFiles int64 `env:"STORAGE_QUOTA_COACH_FILES" envDefault:"5000"`
+	QuotaAdminBytes int64 `env:"STORAGE_QUOTA_ADMIN_BYTES" envDefault:"0"`
+	QuotaAdminFiles int64 `env:"STORAGE_QUOTA_ADMIN_FILES" envDefault:"0"`
 }
 
 func main() {
@@ -53,6 +166,22 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Initialize structured logger
+	appLogger := logger.New(logger.Config{Level: cfg.LogLevel, Format: cfg.LogFormat})
+	slog.SetDefault(appLogger)
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		Exporter:     cfg.TraceExporter,
+		OTLPEndpoint: cfg.TraceOTLPEndpoint,
+		OTLPInsecure: cfg.TraceOTLPInsecure,
+		ServiceName:  cfg.TraceServiceName,
+		SampleRatio:  cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		log.Fatal("Failed to initialize tracing:", err)
+	}
+
 	// Connect to database
 	db, err := database.Connect(cfg.DatabaseURL)
 	if err != nil {
@@ -60,6 +189,20 @@ func main() {
 	}
 	defer db.Close()
 
+	if err := metrics.RegisterDBStats(db.DB, "postgres"); err != nil {
+		log.Fatal("Failed to register database metrics:", err)
+	}
+
+	operationTimeouts, err := database.ParseOperationTimeouts(cfg.DBOperationTimeouts)
+	if err != nil {
+		log.Fatal("Failed to parse DB_OPERATION_TIMEOUTS:", err)
+	}
+	dbTimeouts := database.Timeouts{
+		Read:       cfg.DBReadTimeout,
+		Write:      cfg.DBWriteTimeout,
+		Operations: operationTimeouts,
+	}
+
 	// Initialize Redis cache
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:     cfg.RedisAddr,
@@ -67,9 +210,13 @@ func main() {
 		DB:       cfg.RedisDB,
 	})
 
+	if err := redisotel.InstrumentTracing(redisClient); err != nil {
+		log.Fatal("Failed to instrument Redis tracing:", err)
+	}
+
 	defer func() {
 		if err := redisClient.Close(); err != nil {
-			log.Printf("Error closing Redis connection: %v", err)
+			slog.Error("error closing redis connection", "error", err)
 		}
 	}()
 
@@ -86,62 +233,343 @@ func main() {
 	}
 	jwtService := service.NewJwtService(jwtConfig)
 
-	// Initialize MinIO storage
-	minioConfig := &storage.MinIOConfig{
-		Endpoint:       cfg.MinIOEndpoint,
-		AccessKey:      cfg.MinIOAccessKey,
-		SecretKey:      cfg.MinIOSecretKey,
-		BucketName:     cfg.MinIOBucket,
-		PublicEndpoint: cfg.MinIOPublicEndpoint,
-		UseSSL:         cfg.MinIOUseSSL,
+	// Initialize health handler
+	healthHandler := handler.NewHealthHandler(db, cache)
+
+	// Initialize mailer
+	var accountMailer mailer.Mailer
+	switch cfg.Mailer {
+	case "smtp":
+		accountMailer = mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		})
+	case "log":
+		accountMailer = mailer.NewLogMailer(cfg.MailLogDir)
+	default:
+		log.Fatalf("Unknown MAILER %q", cfg.Mailer)
+	}
+
+	tokenSigningKey := cfg.TokenSigningKey
+	if tokenSigningKey == "" {
+		tokenSigningKey = cfg.JWTSecret
+	}
+
+	// Initialize storage
+	var fileStorage storage.Storage
+	var localStorage *storage.LocalStorage
+	switch cfg.StorageBackend {
+	case "minio":
+		fileStorage, err = storage.NewMinIOStorage(&storage.MinIOConfig{
+			Endpoint:       cfg.MinIOEndpoint,
+			AccessKey:      cfg.MinIOAccessKey,
+			SecretKey:      cfg.MinIOSecretKey,
+			BucketName:     cfg.MinIOBucket,
+			PublicEndpoint: cfg.MinIOPublicEndpoint,
+			UseSSL:         cfg.MinIOUseSSL,
+			Region:         cfg.MinIORegion,
+		})
+	case "local":
+		localStorage, err = storage.NewLocalStorage(&storage.LocalConfig{
+			Root:       cfg.StorageLocalDir,
+			BaseURL:    cfg.AppBaseURL + "/api/v1/storage",
+			SigningKey: tokenSigningKey,
+		})
+		fileStorage = localStorage
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q", cfg.StorageBackend)
 	}
-	minioStorage, err := storage.NewMinIOStorage(minioConfig)
 	if err != nil {
-		log.Fatal("Failed to initialize MinIO storage:", err)
+		log.Fatal("Failed to initialize storage:", err)
 	}
 
-	// Initialize health handler
-	healthHandler := handler.NewHealthHandler(db, cache)
+	var fileScanner scanner.Scanner
+	switch cfg.FileScanner {
+	case "clamav":
+		fileScanner, err = scanner.NewClamAV(scanner.ClamAVConfig{
+			Address: cfg.ClamAVAddress,
+			Timeout: cfg.ClamAVTimeout,
+		})
+	case "fake":
+		fileScanner = scanner.NewFake()
+	case "none":
+	default:
+		log.Fatalf("Unknown FILE_SCANNER %q", cfg.FileScanner)
+	}
+	if err != nil {
+		log.Fatal("Failed to initialize file scanner:", err)
+	}
 
 	// Initialize users layers
-	userRepo := repository.NewUserRepository(db)
-	userService := service.NewUserService(userRepo, cache, jwtService)
+	userRepo := repository.NewUserRepository(db, dbTimeouts)
+	userTokenRepo := repository.NewUserTokenRepository(db, dbTimeouts)
+	activityRepo := repository.NewActivityRepository(db, dbTimeouts)
+	auditService := service.NewAuditService(repository.NewAuditRepository(db, dbTimeouts))
+	sessionService := service.NewSessionService(userRepo, cache)
+	lockout := service.LockoutConfig{
+		MaxAttempts: cfg.LoginMaxAttempts,
+		Window:      cfg.LoginWindow,
+		BaseLockout: cfg.LoginBaseLockout,
+		MaxLockout:  cfg.LoginMaxLockout,
+	}
+	accountService := service.NewAccountService(userRepo, userTokenRepo, cache, accountMailer, sessionService, service.AccountConfig{
+		SigningKey:       tokenSigningKey,
+		BaseURL:          cfg.AppBaseURL,
+		VerificationTTL:  cfg.EmailVerificationTTL,
+		PasswordResetTTL: cfg.PasswordResetTTL,
+		Lockout:          lockout,
+	})
+	deletionService := service.NewAccountDeletionService(userRepo, activityRepo, sessionService, cache, fileStorage, auditService, service.DeletionConfig{
+		GracePeriod:   cfg.AccountDeletionGrace,
+		PurgeInterval: cfg.AccountPurgeInterval,
+		Lockout:       lockout,
+	})
+	accountHandler := handler.NewAccountHandler(accountService, deletionService)
+	twoFactorEncryptionKey := cfg.TwoFactorEncryptionKey
+	if twoFactorEncryptionKey == "" {
+		twoFactorEncryptionKey = tokenSigningKey
+	}
+	twoFactorService, err := service.NewTwoFactorService(repository.NewTwoFactorRepository(db, dbTimeouts), userRepo, cache, jwtService, auditService, service.TwoFactorConfig{
+		Issuer:        cfg.TwoFactorIssuer,
+		EncryptionKey: twoFactorEncryptionKey,
+		ChallengeTTL:  cfg.TwoFactorChallengeTTL,
+	})
+	if err != nil {
+		log.Fatal("Failed to initialize two-factor authentication:", err)
+	}
+	twoFactorHandler := handler.NewTwoFactorHandler(twoFactorService)
+	coachingService := service.NewCoachingService(repository.NewCoachingRepository(db, dbTimeouts), userRepo, auditService)
+	fileService := service.NewFileService(repository.NewFileRepository(db, dbTimeouts), fileStorage, coachingService, fileScanner, service.FileConfig{
+		BaseURL:       cfg.AppBaseURL + "/api/v1/file",
+		SignedURLTTL:  cfg.FileSignedURLTTL,
+		GCGracePeriod: cfg.FileGCGracePeriod,
+		GCInterval:    cfg.FileGCInterval,
+		ScanInterval:  cfg.FileScanInterval,
+		Quotas: map[model.Role]model.StorageQuota{
+			model.RoleUser:  {MaxBytes: cfg.QuotaUserBytes, MaxFiles: cfg.QuotaUserFiles},
+			model.RoleCoach: {MaxBytes: cfg.QuotaCoachBytes, MaxFiles: cfg.QuotaCoachFiles},
+			model.RoleAdmin: {MaxBytes: cfg.QuotaAdminBytes, MaxFiles: cfg.QuotaAdminFiles},
+		},
+	})
+	imageService := service.NewImageService(fileStorage, fileService, cache, service.ImageConfig{
+		PresignTTL: cfg.FilePresignTTL,
+	})
+	if cfg.UploadChunkSize < storage.MinPartSize {
+		log.Fatalf("UPLOAD_CHUNK_SIZE must be at least %d bytes", storage.MinPartSize)
+	}
+	uploadService := service.NewUploadService(fileStorage, fileService, cache, service.UploadConfig{
+		SessionTTL:      cfg.UploadSessionTTL,
+		ChunkSize:       cfg.UploadChunkSize,
+		MaxSize:         cfg.UploadMaxSize,
+		CleanupInterval: cfg.UploadCleanupInterval,
+	})
+	userService := service.NewUserService(userRepo, cache, jwtService, accountService, sessionService, twoFactorService, auditService, fileService, lockout)
 	userHandler := handler.NewUserHandler(userService)
 
+	// Initialize social login
+	var oauthProviders []*oauth.Provider
+	for _, providerConfig := range []oauth.Config{
+		{Name: "google", Issuer: cfg.GoogleIssuer, ClientID: cfg.GoogleClientID, ClientSecret: cfg.GoogleClientSecret},
+		{Name: "apple", Issuer: cfg.AppleIssuer, ClientID: cfg.AppleClientID, ClientSecret: cfg.AppleClientSecret, Scopes: []string{"email", "name"}, FormPost: true},
+		{Name: "mock", Issuer: cfg.MockOIDCIssuer, ClientID: cfg.MockOIDCClientID, ClientSecret: cfg.MockOIDCClientSecret},
+	} {
+		if providerConfig.ClientID == "" || providerConfig.Issuer == "" {
+			continue
+		}
+		providerConfig.RedirectURL = cfg.OAuthRedirectBaseURL + "/" + providerConfig.Name + "/callback"
+		provider, err := oauth.NewProvider(context.Background(), providerConfig)
+		if err != nil {
+			log.Fatal("Failed to initialize OIDC provider:", err)
+		}
+		oauthProviders = append(oauthProviders, provider)
+	}
+	userIdentityRepo := repository.NewUserIdentityRepository(db, dbTimeouts)
+	oauthService := service.NewOAuthService(oauthProviders, userRepo, userIdentityRepo, cache, twoFactorService)
+	oauthHandler := handler.NewOAuthHandler(oauthService, strings.HasPrefix(cfg.OAuthRedirectBaseURL, "https://"))
+
+	// Initialize coaching layers
+	coachingHandler := handler.NewCoachingHandler(coachingService)
+
 	// Initialize activities layers
-	activityRepo := repository.NewActivityRepository(db)
-	activityService := service.NewActivityService(activityRepo, cache)
+	attachmentService := service.NewAttachmentService(repository.NewAttachmentRepository(db, dbTimeouts), activityRepo, imageService, fileService, auditService)
+	activityService := service.NewActivityService(activityRepo, cache, coachingService, attachmentService, auditService)
 	activityHandler := handler.NewActivityHandler(activityService)
+	attachmentHandler := handler.NewAttachmentHandler(attachmentService, fileService)
+
+	// Initialize feed layers
+	feedService := service.NewFeedService(repository.NewFollowRepository(db, dbTimeouts), activityRepo, userRepo, cache, fileService, attachmentService, auditService)
+	feedHandler := handler.NewFeedHandler(feedService)
+
+	// Initialize admin layers
+	adminService := service.NewAdminService(userRepo, activityService, sessionService, auditService)
+	adminHandler := handler.NewAdminHandler(adminService)
+
+	// Initialize personal access tokens
+	accessTokenService := service.NewAccessTokenService(repository.NewAccessTokenRepository(db, dbTimeouts), auditService)
+	accessTokenHandler := handler.NewAccessTokenHandler(accessTokenService)
 
 	// Initialize file handler
-	fileHandler := handler.NewFileHandler(minioStorage)
+	fileHandler := handler.NewFileHandler(imageService, fileService, auditService)
+	uploadHandler := handler.NewUploadHandler(uploadService, fileService, auditService)
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(jwtService)
+	authMiddleware := middleware.NewAuthMiddleware(jwtService, sessionService, accessTokenService)
+
+	// Initialize rate limiter
+	limiter := ratelimit.NewLimiter(redisClient)
+	loginRule, err := ratelimit.ParseRule(cfg.RateLimitLogin)
+	if err != nil {
+		log.Fatal("Failed to parse RATE_LIMIT_LOGIN:", err)
+	}
+	registerRule, err := ratelimit.ParseRule(cfg.RateLimitRegister)
+	if err != nil {
+		log.Fatal("Failed to parse RATE_LIMIT_REGISTER:", err)
+	}
+	apiRule, err := ratelimit.ParseRule(cfg.RateLimitAPI)
+	if err != nil {
+		log.Fatal("Failed to parse RATE_LIMIT_API:", err)
+	}
+	passwordRule, err := ratelimit.ParseRule(cfg.RateLimitPassword)
+	if err != nil {
+		log.Fatal("Failed to parse RATE_LIMIT_PASSWORD:", err)
+	}
+
+	// Initialize translations for validation and domain errors
+	translator, err := i18n.New(binding.Validator.Engine().(*validator.Validate))
+	if err != nil {
+		log.Fatal("Failed to initialize translations:", err)
+	}
 
 	// Setup Gin router
-	r := gin.Default()
+	r := gin.New()
+	r.Use(middleware.Recovery(translator))
+	r.Use(otelgin.Middleware(cfg.TraceServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/metrics"
+	})))
+	r.Use(middleware.RequestID(appLogger))
+	r.Use(middleware.ClientInfo())
+	r.Use(middleware.RequestLogger())
+	r.Use(middleware.Metrics())
+	r.Use(middleware.Locale(translator))
+	r.Use(middleware.ErrorHandler(translator))
+
+	// Prometheus scrape endpoint
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// Routes
 	v1 := r.Group("/api/v1")
 	{
 		v1.GET("/healthz", healthHandler.Check)
-		v1.POST("/register", userHandler.CreateNewUser)
-		v1.POST("/login", userHandler.Login)
+		v1.POST("/register", middleware.RateLimit(limiter, "register", registerRule, middleware.KeyByIP), userHandler.CreateNewUser)
+		v1.POST("/login", middleware.RateLimit(limiter, "login", loginRule, middleware.KeyByIP), userHandler.Login)
+		v1.POST("/login/2fa", middleware.RateLimit(limiter, "login", loginRule, middleware.KeyByIP), twoFactorHandler.CompleteLogin)
+
+		v1.POST("/email/verify", accountHandler.VerifyEmail)
+		v1.POST("/password/forgot", middleware.RateLimit(limiter, "password_forgot", passwordRule, middleware.KeyByIP), accountHandler.ForgotPassword)
+		v1.POST("/password/reset", middleware.RateLimit(limiter, "password_reset", passwordRule, middleware.KeyByIP), accountHandler.ResetPassword)
+		v1.GET("/oauth/:provider/authorize", middleware.RateLimit(limiter, "login", loginRule, middleware.KeyByIP), oauthHandler.Authorize)
+		v1.GET("/oauth/:provider/callback", oauthHandler.Callback)
+		v1.POST("/oauth/:provider/callback", oauthHandler.Callback)
+		v1.POST("/users/restore", middleware.RateLimit(limiter, "account_restore", passwordRule, middleware.KeyByIP), accountHandler.RestoreAccount)
+	}
+
+	// Authenticated routes, personal access tokens are only accepted where a
+	// route asks for a scope
+	authenticated := v1.Group("/")
+	authenticated.Use(authMiddleware.CheckToken())
+	authenticated.Use(middleware.RateLimit(limiter, "api", apiRule, middleware.KeyByUser))
+
+	// Account security stays reachable before the email is verified
+	account := authenticated.Group("/")
+	account.Use(middleware.RequireSession())
+	{
+		account.POST("/email/verify/resend", accountHandler.ResendVerification)
+		account.POST("/users/password", userHandler.ChangePassword)
+		account.DELETE("/users", accountHandler.DeleteAccount)
+		account.POST("/users/2fa/enroll", twoFactorHandler.Enroll)
+		account.POST("/users/2fa/enable", twoFactorHandler.Enable)
+		account.DELETE("/users/2fa", twoFactorHandler.Disable)
+		account.POST("/users/tokens", accessTokenHandler.Create)
+		account.GET("/users/tokens", accessTokenHandler.List)
+		account.DELETE("/users/tokens/:tokenId", accessTokenHandler.Revoke)
+		account.GET("/users/audit", userHandler.ListAudit)
 	}
 
-	protected := v1.Group("/")
-	protected.Use(authMiddleware.CheckToken())
+	protected := authenticated.Group("/")
+	if cfg.RequireVerifiedEmail {
+		protected.Use(middleware.RequireVerifiedEmail(accountService))
+	}
 	{
-		protected.PATCH("/users", userHandler.UpdateUser)
-		protected.GET("/users", userHandler.GetUsers)
+		protected.PATCH("/users", middleware.RequireScope(model.ScopeProfileWrite), userHandler.UpdateUser)
+		protected.GET("/users", middleware.RequireScope(model.ScopeProfileRead), userHandler.GetUsers)
+		protected.GET("/users/storage", middleware.RequireScope(model.ScopeProfileRead), fileHandler.Usage)
+
+		protected.POST("/activity", middleware.RequireScope(model.ScopeActivityWrite), activityHandler.CreateActivity)
+		protected.GET("/activity", middleware.RequireScope(model.ScopeActivityRead), activityHandler.GetUserActivities)
+		protected.PATCH("/activity/:activityId", middleware.RequireScope(model.ScopeActivityWrite), activityHandler.UpdateActivity)
+		protected.DELETE("/activity/:activityId", middleware.RequireScope(model.ScopeActivityWrite), activityHandler.DeleteActivity)
+		protected.GET("/activity/:activityId/attachments", middleware.RequireScope(model.ScopeActivityRead), attachmentHandler.List)
+		protected.POST("/activity/:activityId/attachments", middleware.RequireScope(model.ScopeActivityWrite), attachmentHandler.Upload)
+		protected.DELETE("/activity/:activityId/attachments/:attachmentId", middleware.RequireScope(model.ScopeActivityWrite), attachmentHandler.Delete)
+
+		protected.GET("/feed", middleware.RequireScope(model.ScopeActivityRead), feedHandler.Feed)
+		protected.GET("/users/following", middleware.RequireScope(model.ScopeProfileRead), feedHandler.ListFollowing)
+		protected.POST("/users/following", middleware.RequireScope(model.ScopeProfileWrite), feedHandler.Follow)
+		protected.DELETE("/users/following/:userId", middleware.RequireScope(model.ScopeProfileWrite), feedHandler.Unfollow)
+		protected.GET("/users/followers", middleware.RequireScope(model.ScopeProfileRead), feedHandler.ListFollowers)
 
-		protected.POST("/activity", activityHandler.CreateActivity)
-		protected.GET("/activity", activityHandler.GetUserActivities)
-		protected.PATCH("/activity/:activityId", activityHandler.UpdateActivity)
-		protected.DELETE("/activity/:activityId", activityHandler.DeleteActivity)
+		protected.POST("/file", middleware.RequireScope(model.ScopeProfileWrite), fileHandler.UploadFile)
+		protected.GET("/file/:fileId", middleware.RequireScope(model.ScopeProfileRead), fileHandler.Download)
+		protected.GET("/file/:fileId/metadata", middleware.RequireScope(model.ScopeProfileRead), fileHandler.Metadata)
+		protected.POST("/file/presign", middleware.RequireScope(model.ScopeProfileWrite), fileHandler.Presign)
+		protected.POST("/file/presign/:uploadId/complete", middleware.RequireScope(model.ScopeProfileWrite), fileHandler.CompletePresigned)
 
-		protected.POST("/file", fileHandler.UploadFile)
+		// Resumable uploads
+		protected.POST("/uploads", middleware.RequireScope(model.ScopeProfileWrite), uploadHandler.Create)
+		protected.GET("/uploads/:uploadId", middleware.RequireScope(model.ScopeProfileWrite), uploadHandler.Get)
+		protected.PUT("/uploads/:uploadId/chunks/:index", middleware.RequireScope(model.ScopeProfileWrite), uploadHandler.PutChunk)
+		protected.POST("/uploads/:uploadId/complete", middleware.RequireScope(model.ScopeProfileWrite), uploadHandler.Complete)
+		protected.DELETE("/uploads/:uploadId", middleware.RequireScope(model.ScopeProfileWrite), uploadHandler.Abort)
+	}
+
+	// The local backend is served by the app, uploads and downloads are
+	// authorized by their signature like presigned object store URLs
+	if localStorage != nil {
+		storageHandler := handler.NewStorageHandler(localStorage)
+		v1.POST("/storage", storageHandler.Upload)
+		v1.GET("/storage/*object", storageHandler.Download)
+	}
+
+	coaching := protected.Group("/coaching")
+	coaching.Use(middleware.RequireSession())
+	{
+		coaching.GET("", coachingHandler.List)
+		coaching.POST("/:relationshipId/accept", coachingHandler.Accept)
+		coaching.DELETE("/:relationshipId", coachingHandler.Remove)
+	}
+
+	coach := coaching.Group("/")
+	coach.Use(middleware.RequireRole(model.RoleCoach, model.RoleAdmin))
+	{
+		coach.POST("/invitations", coachingHandler.Invite)
+		coach.GET("/trainees/:traineeId/activity", activityHandler.GetTraineeActivities)
+		coach.POST("/trainees/:traineeId/activity", activityHandler.CreateTraineeActivity)
+		coach.PATCH("/trainees/:traineeId/activity/:activityId", activityHandler.UpdateTraineeActivity)
+	}
+
+	admin := authenticated.Group("/admin")
+	admin.Use(middleware.RequireSession())
+	admin.Use(middleware.RequireRole(model.RoleAdmin))
+	{
+		admin.GET("/users", adminHandler.ListUsers)
+		admin.PATCH("/users/:userId/role", adminHandler.UpdateRole)
+		admin.POST("/users/:userId/disable", adminHandler.DisableUser)
+		admin.POST("/users/:userId/enable", adminHandler.EnableUser)
+		admin.GET("/users/:userId/activities", adminHandler.GetUserActivities)
+		admin.GET("/audit", adminHandler.ListAudit)
 	}
 
 	// Create HTTP server
@@ -150,9 +578,16 @@ func main() {
 		Handler: r,
 	}
 
+	// Purge accounts whose deletion grace period is over and unused files
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	go deletionService.Run(purgeCtx)
+	go fileService.Run(purgeCtx)
+	go fileService.RunScanner(purgeCtx)
+	go uploadService.Run(purgeCtx)
+
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Server starting on port %s", cfg.HTTPPort)
+		slog.Info("server starting", "port", cfg.HTTPPort)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
@@ -162,7 +597,8 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server")
+	stopPurge()
 
 	// Give 30 seconds for graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -170,8 +606,13 @@ func main() {
 
 	// Shutdown server
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
+		slog.Error("server forced to shutdown", "error", err)
+	}
+
+	// Flush pending spans
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("failed to shutdown tracing", "error", err)
 	}
 
-	log.Println("Server exited")
+	slog.Info("server exited")
 }
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/insanjati/fitbyte/internal/metrics"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -35,7 +37,7 @@ func NewRedis(conf RedisConfig) (*Redis, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	log.Println("redis is up and running")
+	slog.Info("redis is up and running")
 
 	return &Redis{client: conf.DB}, nil
 }
@@ -49,12 +51,15 @@ func (r *Redis) Set(ctx context.Context, key string, value interface{}, expirati
 }
 
 func (r *Redis) Get(ctx context.Context, key string) (string, error) {
-	return r.client.Get(ctx, key).Result()
+	val, err := r.client.Get(ctx, key).Result()
+	observeLookup(key, err)
+	return val, err
 }
 
 // GetAs method for type-safe retrieval
 func (r *Redis) GetAs(ctx context.Context, key string, out interface{}) error {
 	val, err := r.client.Get(ctx, key).Result()
+	observeLookup(key, err)
 	if errors.Is(err, redis.Nil) {
 		return fmt.Errorf("%w: key %s", ErrKeyNotExist, key)
 	}
@@ -66,6 +71,33 @@ func (r *Redis) GetAs(ctx context.Context, key string, out interface{}) error {
 	return json.Unmarshal([]byte(val), out)
 }
 
+// Take reads key into out and deletes it atomically, for single-use values
+func (r *Redis) Take(ctx context.Context, key string, out interface{}) error {
+	val, err := r.client.GetDel(ctx, key).Result()
+	observeLookup(key, err)
+	if errors.Is(err, redis.Nil) {
+		return fmt.Errorf("%w: key %s", ErrKeyNotExist, key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error occurred on redis getdel: %w", err)
+	}
+
+	return json.Unmarshal([]byte(val), out)
+}
+
+// observeLookup counts cache hits, misses and errors per key family
+func observeLookup(key string, err error) {
+	result := "hit"
+	switch {
+	case errors.Is(err, redis.Nil):
+		result = "miss"
+	case err != nil:
+		result = "error"
+	}
+	metrics.CacheRequestsTotal.WithLabelValues(metrics.KeyFamily(key), result).Inc()
+}
+
 // SetExp method for your preference
 func (r *Redis) SetExp(ctx context.Context, key string, inValue interface{}, expireDur time.Duration) error {
 	val, err := json.Marshal(inValue)
@@ -92,3 +124,92 @@ func (r *Redis) DeletePattern(ctx context.Context, pattern string) error {
 	}
 	return nil
 }
+
+// Incr increments key and starts its expiration on the first increment
+func (r *Redis) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, expiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("error incrementing key %s: %w", key, err)
+	}
+	return incr.Val(), nil
+}
+
+// TTL returns the remaining time to live of key, or ErrKeyNotExist
+func (r *Redis) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.client.TTL(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("error getting ttl of key %s: %w", key, err)
+	}
+	if ttl == -2 {
+		return 0, fmt.Errorf("%w: key %s", ErrKeyNotExist, key)
+	}
+	return ttl, nil
+}
+
+// HSetExp stores value as JSON in field of the hash at key and moves the
+// expiration of the whole hash to expireAt
+func (r *Redis) HSetExp(ctx context.Context, key, field string, value interface{}, expireAt time.Time) error {
+	val, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cannot marshal json value: %w", err)
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.HSet(ctx, key, field, val)
+	pipe.ExpireAt(ctx, key, expireAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("error setting field %s of key %s: %w", field, key, err)
+	}
+	return nil
+}
+
+// HGetAll returns every field of the hash at key, empty when it does not exist
+func (r *Redis) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	fields, err := r.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting hash %s: %w", key, err)
+	}
+	return fields, nil
+}
+
+// ZAddAt stores member as JSON in the sorted set at key, scored by at
+func (r *Redis) ZAddAt(ctx context.Context, key string, member interface{}, at time.Time) error {
+	val, err := json.Marshal(member)
+	if err != nil {
+		return fmt.Errorf("cannot marshal json value: %w", err)
+	}
+
+	if err := r.client.ZAdd(ctx, key, redis.Z{Score: float64(at.Unix()), Member: val}).Err(); err != nil {
+		return fmt.Errorf("error adding member to key %s: %w", key, err)
+	}
+	return nil
+}
+
+// ZRem removes member, marshalled like ZAddAt, from the sorted set at key
+func (r *Redis) ZRem(ctx context.Context, key string, member interface{}) error {
+	val, err := json.Marshal(member)
+	if err != nil {
+		return fmt.Errorf("cannot marshal json value: %w", err)
+	}
+
+	if err := r.client.ZRem(ctx, key, val).Err(); err != nil {
+		return fmt.Errorf("error removing member from key %s: %w", key, err)
+	}
+	return nil
+}
+
+// ZRangeBefore returns up to limit members of the sorted set at key scored
+// before at, oldest first
+func (r *Redis) ZRangeBefore(ctx context.Context, key string, at time.Time, limit int64) ([]string, error) {
+	members, err := r.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "(" + strconv.FormatInt(at.Unix(), 10),
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting members of key %s: %w", key, err)
+	}
+	return members, nil
+}
@@ -0,0 +1,398 @@
+// Package redistest runs an in-memory Redis speaking the subset of RESP2 the
+// app uses, so code built on cache.Redis can be tested without a Redis server
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ScriptFunc answers EVAL, scripts are not interpreted
+type ScriptFunc func(keys, args []string) ([]int64, error)
+
+type entry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// Server keeps string keys with expirations
+type Server struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	data   map[string]entry
+	script ScriptFunc
+}
+
+// NewServer starts a server that stops with the test
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start redis: %v", err)
+	}
+	s := &Server{listener: listener, data: map[string]entry{}}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// Client returns a client connected to the server, closed with the test
+func (s *Server) Client(t testing.TB) redis.UniversalClient {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{
+		Addr:            s.listener.Addr().String(),
+		Protocol:        2,
+		DisableIdentity: true,
+	})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// HandleScript sets the reply to EVAL and EVALSHA
+func (s *Server) HandleScript(fn ScriptFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script = fn
+}
+
+// Set stores key without an expiration
+func (s *Server) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = entry{value: value}
+}
+
+// Get returns the value of key
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.lookup(key)
+	return e.value, ok
+}
+
+// TTL returns how long key has left, zero when it does not expire
+func (s *Server) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.lookup(key)
+	if !ok || e.expiresAt.IsZero() {
+		return 0
+	}
+	return time.Until(e.expiresAt)
+}
+
+func (s *Server) lookup(key string) (entry, bool) {
+	e, ok := s.data[key]
+	if ok && !e.expiresAt.IsZero() && !time.Now().Before(e.expiresAt) {
+		delete(s.data, key)
+		return entry{}, false
+	}
+	return e, ok
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	var queued [][]string
+	inMulti := false
+
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		switch name := strings.ToUpper(cmd[0]); {
+		case name == "MULTI":
+			inMulti, queued = true, nil
+			writeReply(w, "OK")
+		case name == "EXEC":
+			replies := make([]any, 0, len(queued))
+			for _, c := range queued {
+				replies = append(replies, s.exec(c))
+			}
+			inMulti, queued = false, nil
+			writeReply(w, replies)
+		case name == "DISCARD":
+			inMulti, queued = false, nil
+			writeReply(w, "OK")
+		case inMulti:
+			queued = append(queued, cmd)
+			writeReply(w, "QUEUED")
+		default:
+			writeReply(w, s.exec(cmd))
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+type nilReply struct{}
+
+func (s *Server) exec(cmd []string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name, args := strings.ToUpper(cmd[0]), cmd[1:]
+	switch name {
+	case "PING":
+		return "PONG"
+	case "SELECT", "CLIENT":
+		return "OK"
+	case "GET", "GETDEL":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		e, ok := s.lookup(args[0])
+		if !ok {
+			return nilReply{}
+		}
+		if name == "GETDEL" {
+			delete(s.data, args[0])
+		}
+		return []byte(e.value)
+	case "SET":
+		return s.set(args)
+	case "DEL":
+		deleted := int64(0)
+		for _, key := range args {
+			if _, ok := s.lookup(key); ok {
+				delete(s.data, key)
+				deleted++
+			}
+		}
+		return deleted
+	case "INCR":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		e, _ := s.lookup(args[0])
+		n := int64(0)
+		if e.value != "" {
+			var err error
+			if n, err = strconv.ParseInt(e.value, 10, 64); err != nil {
+				return errors.New("ERR value is not an integer or out of range")
+			}
+		}
+		n++
+		e.value = strconv.FormatInt(n, 10)
+		s.data[args[0]] = e
+		return n
+	case "EXPIRE", "PEXPIRE":
+		return s.expire(name, args)
+	case "TTL", "PTTL":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		e, ok := s.lookup(args[0])
+		switch {
+		case !ok:
+			return int64(-2)
+		case e.expiresAt.IsZero():
+			return int64(-1)
+		case name == "TTL":
+			return int64(time.Until(e.expiresAt).Round(time.Second) / time.Second)
+		default:
+			return time.Until(e.expiresAt).Milliseconds()
+		}
+	case "KEYS":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		var keys []any
+		for key := range s.data {
+			if _, ok := s.lookup(key); !ok {
+				continue
+			}
+			if ok, _ := path.Match(args[0], key); ok {
+				keys = append(keys, []byte(key))
+			}
+		}
+		return keys
+	case "EVALSHA":
+		return errors.New("NOSCRIPT No matching script. Please use EVAL.")
+	case "EVAL":
+		return s.eval(args)
+	default:
+		return fmt.Errorf("ERR unknown command '%s'", cmd[0])
+	}
+}
+
+func (s *Server) set(args []string) any {
+	if len(args) < 2 {
+		return wrongArgs("SET")
+	}
+	e := entry{value: args[1]}
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errors.New("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return errors.New("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			e.expiresAt = time.Now().Add(time.Duration(n) * unit)
+			i++
+		default:
+			return errors.New("ERR syntax error")
+		}
+	}
+	s.data[args[0]] = e
+	return "OK"
+}
+
+func (s *Server) expire(name string, args []string) any {
+	if len(args) < 2 || len(args) > 3 {
+		return wrongArgs(name)
+	}
+	e, ok := s.lookup(args[0])
+	if !ok {
+		return int64(0)
+	}
+	if len(args) == 3 {
+		if strings.ToUpper(args[2]) != "NX" {
+			return errors.New("ERR unsupported option " + args[2])
+		}
+		if !e.expiresAt.IsZero() {
+			return int64(0)
+		}
+	}
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return errors.New("ERR value is not an integer or out of range")
+	}
+	unit := time.Second
+	if name == "PEXPIRE" {
+		unit = time.Millisecond
+	}
+	e.expiresAt = time.Now().Add(time.Duration(n) * unit)
+	s.data[args[0]] = e
+	return int64(1)
+}
+
+func (s *Server) eval(args []string) any {
+	if s.script == nil {
+		return errors.New("ERR scripts are not supported")
+	}
+	if len(args) < 2 {
+		return wrongArgs("EVAL")
+	}
+	numKeys, err := strconv.Atoi(args[1])
+	if err != nil || numKeys < 0 || 2+numKeys > len(args) {
+		return errors.New("ERR invalid number of keys")
+	}
+	res, err := s.script(args[2:2+numKeys], args[2+numKeys:])
+	if err != nil {
+		return fmt.Errorf("ERR %s", err)
+	}
+	reply := make([]any, len(res))
+	for i, n := range res {
+		reply[i] = n
+	}
+	return reply
+}
+
+func wrongArgs(name string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(name))
+}
+
+// readCommand reads one command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[0] != '*' {
+		return nil, fmt.Errorf("unexpected command %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid command length %q", line)
+	}
+
+	cmd := make([]string, n)
+	for i := range cmd {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 2 || line[0] != '$' {
+			return nil, fmt.Errorf("unexpected argument %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid argument length %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		cmd[i] = string(buf[:size])
+	}
+	return cmd, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+func writeReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nilReply:
+		w.WriteString("$-1\r\n")
+	case string:
+		w.WriteString("+" + v + "\r\n")
+	case error:
+		w.WriteString("-" + v.Error() + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case []byte:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n")
+		w.Write(v)
+		w.WriteString("\r\n")
+	case []any:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		panic(fmt.Sprintf("redistest: unsupported reply %T", reply))
+	}
+}
@@ -1,7 +1,7 @@
 package database
 
 import (
-	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -11,7 +11,7 @@ import (
 type DB = sqlx.DB
 
 func Connect(databaseURL string) (*DB, error) {
-	fmt.Println("databaseURL:", databaseURL)
+	slog.Info("connecting to database", "dsn", databaseURL)
 	db, err := sqlx.Connect("postgres", databaseURL)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+)
+
+type OpKind int
+
+const (
+	Read OpKind = iota
+	Write
+)
+
+// Timeouts bounds how long a single statement may run. Operations holds
+// per-operation overrides keyed by "<Repository>.<Method>".
+type Timeouts struct {
+	Read       time.Duration
+	Write      time.Duration
+	Operations map[string]time.Duration
+}
+
+func (t Timeouts) For(op string, kind OpKind) time.Duration {
+	if d, ok := t.Operations[op]; ok {
+		return d
+	}
+	if kind == Write {
+		return t.Write
+	}
+	return t.Read
+}
+
+// WithTimeout derives a context for op. A zero timeout keeps the parent deadline.
+func (t Timeouts) WithTimeout(ctx context.Context, op string, kind OpKind) (context.Context, context.CancelFunc) {
+	d := t.For(op, kind)
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// ParseOperationTimeouts parses "ActivityRepository.GetUserActivities=5s,UserRepository.UpdateUser=2s"
+func ParseOperationTimeouts(s string) (map[string]time.Duration, error) {
+	ops := map[string]time.Duration{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid operation timeout %q", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid operation timeout %q: %w", pair, err)
+		}
+		ops[strings.TrimSpace(name)] = d
+	}
+	return ops, nil
+}
+
+// ContextError maps an error caused by an expired deadline to ErrGatewayTimeout.
+// lib/pq reports a cancelled statement as its own error, so ctx is checked too.
+func ContextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", appErrors.ErrGatewayTimeout, err)
+	}
+	return err
+}
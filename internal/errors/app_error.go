@@ -0,0 +1,195 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FieldError describes a single invalid request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Tag     string `json:"tag,omitempty"`
+	Message string `json:"message"`
+}
+
+// AppError is the error type services hand back to handlers. Message is safe to
+// show to clients, Err keeps the underlying cause for logs only.
+type AppError struct {
+	Code       string
+	Status     int
+	Message    string
+	Fields     []FieldError
+	RetryAfter time.Duration
+	Err        error
+}
+
+func New(status int, code, message string) *AppError {
+	return &AppError{Code: code, Status: status, Message: message}
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any AppError with the same code, so copies made by Wrap or
+// WithFields still satisfy errors.Is against the declared value
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of e carrying cause
+func (e *AppError) Wrap(cause error) *AppError {
+	cp := *e
+	cp.Err = cause
+	return &cp
+}
+
+// WithFields returns a copy of e carrying field level details
+func (e *AppError) WithFields(fields ...FieldError) *AppError {
+	cp := *e
+	cp.Fields = append(append([]FieldError{}, e.Fields...), fields...)
+	return &cp
+}
+
+// WithRetryAfter returns a copy of e telling the client when to try again
+func (e *AppError) WithRetryAfter(d time.Duration) *AppError {
+	cp := *e
+	cp.RetryAfter = d
+	return &cp
+}
+
+// WithMessage returns a copy of e with a different client message
+func (e *AppError) WithMessage(message string) *AppError {
+	cp := *e
+	cp.Message = message
+	return &cp
+}
+
+// Domain errors
+var (
+	ErrValidation            = New(http.StatusBadRequest, "validation_failed", "request validation failed")
+	ErrInvalidBody           = New(http.StatusBadRequest, "invalid_body", "request body is invalid")
+	ErrInvalidDoneAt         = New(http.StatusBadRequest, "invalid_done_at", "doneAt must be an ISO 8601 date")
+	ErrInvalidActivityType   = New(http.StatusBadRequest, "invalid_activity_type", "activityType is not supported")
+	ErrInvalidDuration       = New(http.StatusBadRequest, "invalid_duration", "durationInMinutes must be >= 1")
+	ErrInvalidActivityID     = New(http.StatusBadRequest, "invalid_activity_id", "activityId must be a valid UUID")
+	ErrInvalidEmail          = New(http.StatusBadRequest, "invalid_email", "email format is invalid")
+	ErrInvalidPassword       = New(http.StatusBadRequest, "invalid_password", "password length must be between 8 and 32 characters")
+	ErrInvalidCredentials    = New(http.StatusBadRequest, "invalid_credentials", "invalid email or password")
+	ErrMissingToken          = New(http.StatusUnauthorized, "missing_token", "missing request token")
+	ErrInvalidToken          = New(http.StatusUnauthorized, "invalid_token", "invalid request token")
+	ErrExpiredToken          = New(http.StatusUnauthorized, "expired_token", "expired request token")
+	ErrSessionRevoked        = New(http.StatusUnauthorized, "session_revoked", "session has been revoked, sign in again")
+	ErrWrongPassword         = New(http.StatusBadRequest, "invalid_current_password", "current password is incorrect")
+	ErrAccountDeleted        = New(http.StatusForbidden, "account_pending_deletion", "account is scheduled for deletion, restore it to sign in")
+	ErrUserNotFound          = New(http.StatusNotFound, "user_not_found", "user not found")
+	ErrActivityNotFound      = New(http.StatusNotFound, "activity_not_found", "activity not found")
+	ErrInvalidUserID         = New(http.StatusBadRequest, "invalid_user_id", "userId must be a valid UUID")
+	ErrAccessDenied          = New(http.StatusForbidden, "access_denied", "you do not have access to this resource")
+	ErrAccountDisabled       = New(http.StatusForbidden, "account_disabled", "account has been disabled")
+	ErrInvalidRelationshipID = New(http.StatusBadRequest, "invalid_relationship_id", "relationshipId must be a valid UUID")
+	ErrCoachingNotFound      = New(http.StatusNotFound, "coaching_not_found", "coaching relationship not found")
+	ErrCoachingExists        = New(http.StatusConflict, "coaching_exists", "a coaching relationship with this user already exists")
+	ErrCoachingReadOnly      = New(http.StatusForbidden, "coaching_read_only", "coaching relationship only allows reading activities")
+	ErrInvalidAccessTokenID  = New(http.StatusBadRequest, "invalid_token_id", "tokenId must be a valid UUID")
+	ErrAccessTokenNotFound   = New(http.StatusNotFound, "access_token_not_found", "access token not found")
+	ErrInsufficientScope     = New(http.StatusForbidden, "insufficient_scope", "access token does not allow this request")
+	ErrUploadNotFound        = New(http.StatusNotFound, "upload_not_found", "upload not found or expired")
+	ErrUploadCompleting      = New(http.StatusConflict, "upload_completing", "upload is being completed, call complete again to finish it")
+	ErrUploadIncomplete      = New(http.StatusConflict, "upload_incomplete", "file has not been uploaded yet")
+	ErrInvalidImageURI       = New(http.StatusBadRequest, "invalid_image_uri", "imageUri must point to one of your uploaded images")
+	ErrInvalidFileID         = New(http.StatusBadRequest, "invalid_file_id", "fileId must be a valid UUID")
+	ErrFileNotFound          = New(http.StatusNotFound, "file_not_found", "file not found")
+	ErrInvalidAttachmentID   = New(http.StatusBadRequest, "invalid_attachment_id", "attachmentId must be a valid UUID")
+	ErrAttachmentNotFound    = New(http.StatusNotFound, "attachment_not_found", "attachment not found")
+	ErrTooManyAttachments    = New(http.StatusConflict, "too_many_attachments", "activity already has the maximum number of attachments")
+	ErrFilePending           = New(http.StatusConflict, "file_pending_scan", "file is still being scanned, try again shortly")
+	ErrFileRejected          = New(http.StatusUnprocessableEntity, "file_rejected", "file was rejected by the malware scan")
+	ErrChunkChecksumMismatch = New(http.StatusBadRequest, "chunk_checksum_mismatch", "chunk does not match its X-Chunk-SHA256 checksum")
+	ErrNotFollowing          = New(http.StatusNotFound, "not_following", "you do not follow this user")
+	ErrEmailExists           = New(http.StatusConflict, "email_exists", "email already registered")
+	ErrUnknownProvider       = New(http.StatusNotFound, "unknown_provider", "login provider is not supported")
+	ErrOAuthFailed           = New(http.StatusBadRequest, "oauth_failed", "sign in with the provider failed")
+	ErrIdentityConflict      = New(http.StatusConflict, "identity_conflict", "an account with this email already exists, sign in with your password first")
+	ErrInvalidAccountToken   = New(http.StatusBadRequest, "invalid_account_token", "token is invalid or expired")
+	ErrEmailNotVerified      = New(http.StatusForbidden, "email_not_verified", "email address is not verified")
+	ErrEmailAlreadyVerified  = New(http.StatusConflict, "email_already_verified", "email address is already verified")
+	ErrInvalidTwoFactorCode  = New(http.StatusBadRequest, "invalid_two_factor_code", "two-factor code is invalid")
+	ErrInvalidLoginChallenge = New(http.StatusUnauthorized, "invalid_login_challenge", "login challenge is invalid or expired, sign in again")
+	ErrTwoFactorEnabled      = New(http.StatusConflict, "two_factor_enabled", "two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled  = New(http.StatusConflict, "two_factor_not_enrolled", "two-factor authentication is not set up")
+	ErrRateLimited           = New(http.StatusTooManyRequests, "too_many_requests", "too many requests").Wrap(ErrTooManyRequests)
+	ErrLoginLocked           = New(http.StatusTooManyRequests, "login_locked", "too many failed login attempts, try again later").Wrap(ErrTooManyRequests)
+	ErrStorageQuotaExceeded  = New(http.StatusRequestEntityTooLarge, "storage_quota_exceeded", "upload exceeds your storage quota").Wrap(ErrPayloadTooLarge)
+)
+
+// sentinelStatus maps the plain sentinel errors to their HTTP status
+var sentinelStatus = map[error]int{
+	ErrBadRequest:            http.StatusBadRequest,
+	ErrUnauthorized:          http.StatusUnauthorized,
+	ErrPaymentRequired:       http.StatusPaymentRequired,
+	ErrForbidden:             http.StatusForbidden,
+	ErrNotFound:              http.StatusNotFound,
+	ErrMethodNotAllowed:      http.StatusMethodNotAllowed,
+	ErrNotAcceptable:         http.StatusNotAcceptable,
+	ErrProxyAuthRequired:     http.StatusProxyAuthRequired,
+	ErrRequestTimeout:        http.StatusRequestTimeout,
+	ErrConflict:              http.StatusConflict,
+	ErrGone:                  http.StatusGone,
+	ErrLengthRequired:        http.StatusLengthRequired,
+	ErrPreconditionFailed:    http.StatusPreconditionFailed,
+	ErrPayloadTooLarge:       http.StatusRequestEntityTooLarge,
+	ErrURITooLong:            http.StatusRequestURITooLong,
+	ErrUnsupportedMedia:      http.StatusUnsupportedMediaType,
+	ErrRangeNotSatisfiable:   http.StatusRequestedRangeNotSatisfiable,
+	ErrExpectationFailed:     http.StatusExpectationFailed,
+	ErrTooManyRequests:       http.StatusTooManyRequests,
+	ErrInternalServerError:   http.StatusInternalServerError,
+	ErrNotImplemented:        http.StatusNotImplemented,
+	ErrBadGateway:            http.StatusBadGateway,
+	ErrServiceUnavailable:    http.StatusServiceUnavailable,
+	ErrGatewayTimeout:        http.StatusGatewayTimeout,
+	ErrHTTPVersionNotSupport: http.StatusHTTPVersionNotSupported,
+}
+
+// FromError converts any error into an AppError. Unknown errors become a 500
+// with a generic message so internal details never reach the client.
+func FromError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	// Deadlines win over whatever sentinel the cause may also wrap
+	if errors.Is(err, ErrGatewayTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return fromSentinel(ErrGatewayTimeout, http.StatusGatewayTimeout, err)
+	}
+
+	for sentinel, status := range sentinelStatus {
+		if errors.Is(err, sentinel) {
+			return fromSentinel(sentinel, status, err)
+		}
+	}
+
+	return fromSentinel(ErrInternalServerError, http.StatusInternalServerError, err)
+}
+
+func fromSentinel(sentinel error, status int, cause error) *AppError {
+	return &AppError{
+		Code:    strings.ReplaceAll(sentinel.Error(), " ", "_"),
+		Status:  status,
+		Message: sentinel.Error(),
+		Err:     cause,
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/service"
+)
+
+type AccessTokenHandler struct {
+	accessTokenService *service.AccessTokenService
+}
+
+func NewAccessTokenHandler(accessTokenService *service.AccessTokenService) *AccessTokenHandler {
+	return &AccessTokenHandler{accessTokenService: accessTokenService}
+}
+
+// POST /v1/users/tokens
+func (h *AccessTokenHandler) Create(c *gin.Context) {
+	var req model.CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	token, err := h.accessTokenService.Create(c.Request.Context(), userID, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+// GET /v1/users/tokens
+func (h *AccessTokenHandler) List(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	tokens, err := h.accessTokenService.List(c.Request.Context(), userID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// DELETE /v1/users/tokens/:tokenId
+func (h *AccessTokenHandler) Revoke(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	tokenID, err := uuid.Parse(c.Param("tokenId"))
+	if err != nil {
+		_ = c.Error(appErrors.ErrInvalidAccessTokenID.Wrap(err))
+		return
+	}
+
+	if err := h.accessTokenService.Revoke(c.Request.Context(), userID, tokenID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "revoked"})
+}
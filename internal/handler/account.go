@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/service"
+)
+
+type AccountHandler struct {
+	accountService  *service.AccountService
+	deletionService *service.AccountDeletionService
+}
+
+func NewAccountHandler(accountService *service.AccountService, deletionService *service.AccountDeletionService) *AccountHandler {
+	return &AccountHandler{accountService: accountService, deletionService: deletionService}
+}
+
+// POST /v1/email/verify
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	var req model.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	if err := h.accountService.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email verified"})
+}
+
+// POST /v1/email/verify/resend
+func (h *AccountHandler) ResendVerification(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.accountService.ResendVerification(c.Request.Context(), userID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "verification email sent"})
+}
+
+// POST /v1/password/forgot
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	var req model.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	if err := h.accountService.ForgotPassword(c.Request.Context(), req.Email); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	// Same response whether or not the email exists
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the email is registered, a reset link has been sent"})
+}
+
+// POST /v1/password/reset
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var req model.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	if err := h.accountService.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password updated"})
+}
+
+// DELETE /v1/users
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.deletionService.DeleteAccount(c.Request.Context(), userID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "account scheduled for deletion"})
+}
+
+// POST /v1/users/restore
+func (h *AccountHandler) RestoreAccount(c *gin.Context) {
+	var req model.RestoreAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	if err := h.deletionService.RestoreAccount(c.Request.Context(), req.Email, req.Password); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "account restored"})
+}
@@ -1,12 +1,11 @@
 package handler
 
 import (
-	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
-	"github.com/insanjati/fitbyte/internal/errors"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
 	"github.com/insanjati/fitbyte/internal/model"
 	"github.com/insanjati/fitbyte/internal/service"
 
@@ -25,67 +24,64 @@ func NewActivityHandler(activityService *service.ActivityService) *ActivityHandl
 func getUserID(c *gin.Context) (uuid.UUID, error) {
 	rawUserID, exists := c.Get("user_id")
 	if !exists {
-		return uuid.Nil, errors.ErrUnauthorized
+		return uuid.Nil, appErrors.ErrUnauthorized
 	}
 	userID, ok := rawUserID.(uuid.UUID)
 	if !ok {
-		return uuid.Nil, fmt.Errorf("Invalid user ID type")
+		return uuid.Nil, appErrors.ErrInvalidToken.WithMessage("invalid user ID type")
 	}
 	return userID, nil
 }
 
+func getRole(c *gin.Context) model.Role {
+	rawRole, _ := c.Get("role")
+	role, _ := rawRole.(model.Role)
+	return role
+}
+
 // POST /v1/activity
 func (h *ActivityHandler) CreateActivity(c *gin.Context) {
 	var req model.CreateActivityRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrBadRequest.Error()})
+		_ = c.Error(validationError(err))
 		return
 	}
 
 	userID, err := getUserID(c)
-	if err == errors.ErrUnauthorized {
-		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrUnauthorized.Error()})
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	activity, err := h.activityService.CreateActivity(c, userID, req)
-
+	activity, err := h.activityService.CreateActivity(c.Request.Context(), userID, req)
 	if err != nil {
-		fmt.Printf("CreateActivity error: %v\n", err)
-		if err == errors.ErrUnauthorized {
-			c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrUnauthorized.Error()})
-			return
-		}
-		if err.Error() == "invalid doneAt" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid doneAt"})
-			return
-		}
-		if err.Error() == "invalid activityType" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid activityType"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"activityId":        activity.ID,
-		"activityType":      activity.ActivityType,
-		"doneAt":            activity.DoneAt.Format(time.RFC3339),
-		"durationInMinutes": activity.DurationInMinutes,
-		"caloriesBurned":    activity.CaloriesBurned,
-		"createdAt":         activity.CreatedAt.Format(time.RFC3339),
-		"updatedAt":         activity.UpdatedAt.Format(time.RFC3339),
-	})
+	c.JSON(http.StatusCreated, activityResponse(activity))
 }
 
 func (h *ActivityHandler) GetUserActivities(c *gin.Context) {
 	userID, err := getUserID(c)
-	if err == errors.ErrUnauthorized {
-		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrUnauthorized.Error()})
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
+	filter := parseActivityFilter(c)
+
+	activities, err := h.activityService.GetUserActivities(c.Request.Context(), userID, &filter)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, activityListResponse(activities))
+}
+
+// parseActivityFilter reads the list filters, invalid values are ignored
+func parseActivityFilter(c *gin.Context) model.ActivityFilter {
 	var filter model.ActivityFilter
 
 	if v := c.Query("limit"); v != "" {
@@ -125,12 +121,24 @@ func (h *ActivityHandler) GetUserActivities(c *gin.Context) {
 		}
 	}
 
-	activities, err := h.activityService.GetUserActivities(c, userID, &filter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
-		return
+	return filter
+}
+
+func activityResponse(activity *model.Activity) gin.H {
+	return gin.H{
+		"activityId":        activity.ID,
+		"activityType":      activity.ActivityType,
+		"doneAt":            activity.DoneAt.Format(time.RFC3339),
+		"durationInMinutes": activity.DurationInMinutes,
+		"caloriesBurned":    activity.CaloriesBurned,
+		"visibility":        activity.Visibility,
+		"createdAt":         activity.CreatedAt.Format(time.RFC3339),
+		"updatedAt":         activity.UpdatedAt.Format(time.RFC3339),
+		"attachments":       attachmentsResponse(activity.Attachments),
 	}
+}
 
+func activityListResponse(activities []model.Activity) []gin.H {
 	resp := make([]gin.H, 0, len(activities))
 	for _, a := range activities {
 		resp = append(resp, gin.H{
@@ -139,11 +147,12 @@ func (h *ActivityHandler) GetUserActivities(c *gin.Context) {
 			"doneAt":            a.DoneAt.Format(time.RFC3339),
 			"durationInMinutes": a.DurationInMinutes,
 			"caloriesBurned":    a.CaloriesBurned,
+			"visibility":        a.Visibility,
 			"createdAt":         a.CreatedAt.Format(time.RFC3339),
+			"attachments":       attachmentsResponse(a.Attachments),
 		})
 	}
-
-	c.JSON(http.StatusOK, resp)
+	return resp
 }
 
 // PATCH /v1/activity
@@ -151,84 +160,146 @@ func (h *ActivityHandler) UpdateActivity(c *gin.Context) {
 	var req model.UpdateActivityRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrBadRequest.Error()})
+		_ = c.Error(validationError(err))
 		return
 	}
 
 	userID, err := getUserID(c)
-	if err == errors.ErrUnauthorized {
-		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrUnauthorized.Error()})
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
 	// Validate activityID
 	activityID, err := uuid.Parse(c.Param("activityId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":       "invalid activityId",
-			"description": "activityId must be a valid UUID",
-		})
+		_ = c.Error(appErrors.ErrInvalidActivityID.Wrap(err))
 		return
 	}
 
-	activity, err := h.activityService.UpdateActivity(c, userID, activityID, req)
-	fmt.Print(err)
-
+	activity, err := h.activityService.UpdateActivity(c.Request.Context(), userID, activityID, req)
 	if err != nil {
-		if err == errors.ErrUnauthorized {
-			c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrUnauthorized.Error()})
-			return
-		}
-		if err.Error() == "invalid doneAt" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid doneAt"})
-			return
-		}
-		if err.Error() == "invalid activityType" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid activityType"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"activityId":        activity.ID,
-		"activityType":      activity.ActivityType,
-		"doneAt":            activity.DoneAt.Format(time.RFC3339),
-		"durationInMinutes": activity.DurationInMinutes,
-		"caloriesBurned":    activity.CaloriesBurned,
-		"createdAt":         activity.CreatedAt.Format(time.RFC3339),
-		"updatedAt":         activity.UpdatedAt.Format(time.RFC3339),
-	})
+	c.JSON(http.StatusCreated, activityResponse(activity))
 }
 
 // DELETE /v1/activity/:activityId
 func (h *ActivityHandler) DeleteActivity(c *gin.Context) {
 	// Get activity ID from URL parameter
-	activityIDStr := c.Param("activityId")
-	activityID, err := uuid.Parse(activityIDStr)
+	activityID, err := uuid.Parse(c.Param("activityId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid activity ID format"})
+		_ = c.Error(appErrors.ErrInvalidActivityID.Wrap(err))
 		return
 	}
 
 	// Get user ID from JWT context
 	userID, err := getUserID(c)
-	if err == errors.ErrUnauthorized {
-		c.JSON(http.StatusBadRequest, gin.H{"error": errors.ErrUnauthorized.Error()})
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
 	// Delete the activity
-	err = h.activityService.DeleteActivity(c, activityID, userID)
-	if err != nil {
-		if err.Error() == "activity not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
+	if err := h.activityService.DeleteActivity(c.Request.Context(), activityID, userID); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
 }
+
+func parseTraineeIDParam(c *gin.Context) (uuid.UUID, error) {
+	traineeID, err := uuid.Parse(c.Param("traineeId"))
+	if err != nil {
+		return uuid.Nil, appErrors.ErrInvalidUserID.Wrap(err)
+	}
+	return traineeID, nil
+}
+
+// GET /v1/coaching/trainees/:traineeId/activity
+func (h *ActivityHandler) GetTraineeActivities(c *gin.Context) {
+	coachID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	traineeID, err := parseTraineeIDParam(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	filter := parseActivityFilter(c)
+
+	activities, err := h.activityService.GetTraineeActivities(c.Request.Context(), coachID, traineeID, &filter)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, activityListResponse(activities))
+}
+
+// POST /v1/coaching/trainees/:traineeId/activity
+func (h *ActivityHandler) CreateTraineeActivity(c *gin.Context) {
+	var req model.CreateActivityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	coachID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	traineeID, err := parseTraineeIDParam(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	activity, err := h.activityService.CreateTraineeActivity(c.Request.Context(), coachID, traineeID, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, activityResponse(activity))
+}
+
+// PATCH /v1/coaching/trainees/:traineeId/activity/:activityId
+func (h *ActivityHandler) UpdateTraineeActivity(c *gin.Context) {
+	var req model.UpdateActivityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	coachID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	traineeID, err := parseTraineeIDParam(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	activityID, err := uuid.Parse(c.Param("activityId"))
+	if err != nil {
+		_ = c.Error(appErrors.ErrInvalidActivityID.Wrap(err))
+		return
+	}
+
+	activity, err := h.activityService.UpdateTraineeActivity(c.Request.Context(), coachID, traineeID, activityID, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, activityResponse(activity))
+}
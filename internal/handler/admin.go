@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/service"
+)
+
+type AdminHandler struct {
+	adminService *service.AdminService
+}
+
+func NewAdminHandler(adminService *service.AdminService) *AdminHandler {
+	return &AdminHandler{adminService: adminService}
+}
+
+// parsePagination reads limit and offset, limit is capped at 100
+func parsePagination(c *gin.Context) (int, int) {
+	limit, offset := 20, 0
+	if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 {
+		limit = min(n, 100)
+	}
+	if n, err := strconv.Atoi(c.Query("offset")); err == nil && n >= 0 {
+		offset = n
+	}
+	return limit, offset
+}
+
+func parseUserIDParam(c *gin.Context) (uuid.UUID, error) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		return uuid.Nil, appErrors.ErrInvalidUserID.Wrap(err)
+	}
+	return userID, nil
+}
+
+// GET /v1/admin/users?search=&role=
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	filter := model.AdminUserFilter{Search: c.Query("search")}
+	filter.Limit, filter.Offset = parsePagination(c)
+	if v := c.Query("role"); v != "" {
+		role := model.Role(v)
+		filter.Role = &role
+	}
+
+	users, err := h.adminService.ListUsers(c.Request.Context(), filter)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// PATCH /v1/admin/users/:userId/role
+func (h *AdminHandler) UpdateRole(c *gin.Context) {
+	var req model.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	actorID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	userID, err := parseUserIDParam(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.adminService.SetRole(c.Request.Context(), actorID, userID, req.Role); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "role updated"})
+}
+
+// POST /v1/admin/users/:userId/disable
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	actorID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	userID, err := parseUserIDParam(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.adminService.DisableUser(c.Request.Context(), actorID, userID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user disabled"})
+}
+
+// POST /v1/admin/users/:userId/enable
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	actorID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	userID, err := parseUserIDParam(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.adminService.EnableUser(c.Request.Context(), actorID, userID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user enabled"})
+}
+
+// GET /v1/admin/users/:userId/activities
+func (h *AdminHandler) GetUserActivities(c *gin.Context) {
+	actorID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	userID, err := parseUserIDParam(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	filter := parseActivityFilter(c)
+	activities, err := h.adminService.GetUserActivities(c.Request.Context(), actorID, userID, &filter)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, activityListResponse(activities))
+}
+
+// GET /v1/admin/audit?actorId=&subjectId=&action=&entityType=
+func (h *AdminHandler) ListAudit(c *gin.Context) {
+	filter := model.AuditFilter{Action: c.Query("action"), EntityType: c.Query("entityType")}
+	filter.Limit, filter.Offset = parsePagination(c)
+	if v := c.Query("actorId"); v != "" {
+		actorID, err := uuid.Parse(v)
+		if err != nil {
+			_ = c.Error(appErrors.ErrInvalidUserID.WithMessage("actorId must be a valid UUID").Wrap(err))
+			return
+		}
+		filter.ActorID = &actorID
+	}
+	if v := c.Query("subjectId"); v != "" {
+		subjectID, err := uuid.Parse(v)
+		if err != nil {
+			_ = c.Error(appErrors.ErrInvalidUserID.WithMessage("subjectId must be a valid UUID").Wrap(err))
+			return
+		}
+		filter.SubjectID = &subjectID
+	}
+
+	entries, err := h.adminService.ListAudit(c.Request.Context(), filter)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/service"
+)
+
+type AttachmentHandler struct {
+	attachments *service.AttachmentService
+	files       *service.FileService
+}
+
+func NewAttachmentHandler(attachments *service.AttachmentService, files *service.FileService) *AttachmentHandler {
+	return &AttachmentHandler{attachments: attachments, files: files}
+}
+
+// attachmentsResponse never returns null so clients can always iterate
+func attachmentsResponse(attachments []model.ActivityAttachment) []model.ActivityAttachment {
+	if attachments == nil {
+		return []model.ActivityAttachment{}
+	}
+	return attachments
+}
+
+// POST /v1/activity/:activityId/attachments
+func (h *AttachmentHandler) Upload(c *gin.Context) {
+	activityID, err := uuid.Parse(c.Param("activityId"))
+	if err != nil {
+		_ = c.Error(appErrors.ErrInvalidActivityID.Wrap(err))
+		return
+	}
+
+	// A JSON body attaches a file uploaded before
+	if c.ContentType() == "application/json" {
+		h.attachFile(c, activityID)
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		_ = c.Error(appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "file", Tag: "required", Message: "file is required"}).Wrap(err))
+		return
+	}
+	defer file.Close()
+
+	// Validate file size (max 10MB), the type is sniffed from the content
+	if header.Size > service.MaxImageSize {
+		_ = c.Error(appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "file", Tag: "max", Message: "file size exceeds 10MB limit"}))
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.files.CheckQuota(c.Request.Context(), userID, getRole(c), header.Size); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	attachment, err := h.attachments.Upload(c.Request.Context(), userID, activityID, header.Filename, file)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+func (h *AttachmentHandler) attachFile(c *gin.Context, activityID uuid.UUID) {
+	var req model.AttachFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	attachment, err := h.attachments.AttachFile(c.Request.Context(), userID, activityID, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// GET /v1/activity/:activityId/attachments
+func (h *AttachmentHandler) List(c *gin.Context) {
+	activityID, err := uuid.Parse(c.Param("activityId"))
+	if err != nil {
+		_ = c.Error(appErrors.ErrInvalidActivityID.Wrap(err))
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	attachments, err := h.attachments.List(c.Request.Context(), userID, activityID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+	c.JSON(http.StatusOK, attachmentsResponse(attachments))
+}
+
+// DELETE /v1/activity/:activityId/attachments/:attachmentId
+func (h *AttachmentHandler) Delete(c *gin.Context) {
+	activityID, err := uuid.Parse(c.Param("activityId"))
+	if err != nil {
+		_ = c.Error(appErrors.ErrInvalidActivityID.Wrap(err))
+		return
+	}
+	attachmentID, err := uuid.Parse(c.Param("attachmentId"))
+	if err != nil {
+		_ = c.Error(appErrors.ErrInvalidAttachmentID.Wrap(err))
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.attachments.Delete(c.Request.Context(), userID, activityID, attachmentID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/service"
+)
+
+type CoachingHandler struct {
+	coachingService *service.CoachingService
+}
+
+func NewCoachingHandler(coachingService *service.CoachingService) *CoachingHandler {
+	return &CoachingHandler{coachingService: coachingService}
+}
+
+func parseRelationshipIDParam(c *gin.Context) (uuid.UUID, error) {
+	relationshipID, err := uuid.Parse(c.Param("relationshipId"))
+	if err != nil {
+		return uuid.Nil, appErrors.ErrInvalidRelationshipID.Wrap(err)
+	}
+	return relationshipID, nil
+}
+
+// POST /v1/coaching/invitations
+func (h *CoachingHandler) Invite(c *gin.Context) {
+	var req model.CoachingInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	coachID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	rel, err := h.coachingService.Invite(c.Request.Context(), coachID, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, rel)
+}
+
+// GET /v1/coaching
+func (h *CoachingHandler) List(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	rels, err := h.coachingService.List(c.Request.Context(), userID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rels)
+}
+
+// POST /v1/coaching/:relationshipId/accept
+func (h *CoachingHandler) Accept(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	relationshipID, err := parseRelationshipIDParam(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	rel, err := h.coachingService.Accept(c.Request.Context(), userID, relationshipID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rel)
+}
+
+// DELETE /v1/coaching/:relationshipId
+func (h *CoachingHandler) Remove(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	relationshipID, err := parseRelationshipIDParam(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.coachingService.Remove(c.Request.Context(), userID, relationshipID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "removed"})
+}
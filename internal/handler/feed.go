@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/service"
+)
+
+type FeedHandler struct {
+	feedService *service.FeedService
+}
+
+func NewFeedHandler(feedService *service.FeedService) *FeedHandler {
+	return &FeedHandler{feedService: feedService}
+}
+
+func feedResponse(items []model.FeedItem) []gin.H {
+	resp := make([]gin.H, 0, len(items))
+	for _, item := range items {
+		resp = append(resp, gin.H{
+			"activityId":        item.ID,
+			"activityType":      item.ActivityType,
+			"doneAt":            item.DoneAt.Format(time.RFC3339),
+			"durationInMinutes": item.DurationInMinutes,
+			"caloriesBurned":    item.CaloriesBurned,
+			"visibility":        item.Visibility,
+			"createdAt":         item.CreatedAt.Format(time.RFC3339),
+			"attachments":       attachmentsResponse(item.Attachments),
+			"user": gin.H{
+				"userId":   item.UserID,
+				"name":     item.AuthorName,
+				"imageUri": item.AuthorImageUri,
+			},
+		})
+	}
+	return resp
+}
+
+// GET /v1/feed
+func (h *FeedHandler) Feed(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	limit, offset := parsePagination(c)
+
+	items, err := h.feedService.Feed(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+	c.JSON(http.StatusOK, feedResponse(items))
+}
+
+// POST /v1/users/following
+func (h *FeedHandler) Follow(c *gin.Context) {
+	var req model.FollowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	follow, err := h.feedService.Follow(c.Request.Context(), userID, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, follow)
+}
+
+// DELETE /v1/users/following/:userId
+func (h *FeedHandler) Unfollow(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	followeeID, err := parseUserIDParam(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.feedService.Unfollow(c.Request.Context(), userID, followeeID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// GET /v1/users/following
+func (h *FeedHandler) ListFollowing(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	limit, offset := parsePagination(c)
+
+	follows, err := h.feedService.ListFollowing(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, follows)
+}
+
+// GET /v1/users/followers
+func (h *FeedHandler) ListFollowers(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	limit, offset := parsePagination(c)
+
+	follows, err := h.feedService.ListFollowers(c.Request.Context(), userID, limit, offset)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, follows)
+}
@@ -2,59 +2,192 @@ package handler
 
 import (
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/insanjati/fitbyte/internal/storage"
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/imaging"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/service"
 )
 
 type FileHandler struct {
-	storage *storage.MinIOStorage
+	images *service.ImageService
+	files  *service.FileService
+	audit  *service.AuditService
 }
 
-func NewFileHandler(minioStorage *storage.MinIOStorage) *FileHandler {
+func NewFileHandler(images *service.ImageService, files *service.FileService, audit *service.AuditService) *FileHandler {
 	return &FileHandler{
-		storage: minioStorage,
+		images: images,
+		files:  files,
+		audit:  audit,
 	}
 }
 
 func (h *FileHandler) UploadFile(c *gin.Context) {
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		_ = c.Error(appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "file", Tag: "required", Message: "file is required"}).Wrap(err))
 		return
 	}
 	defer file.Close()
 
-	// Validate file size (max 10MB)
-	if header.Size > 10*1024*1024 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File size exceeds 10MB limit"})
+	// Validate file size (max 10MB), the type is sniffed from the content
+	if header.Size > service.MaxImageSize {
+		_ = c.Error(appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "file", Tag: "max", Message: "file size exceeds 10MB limit"}))
 		return
 	}
 
-	// Validate file type (jpeg/jpg/png)
-	contentType := header.Header.Get("Content-Type")
-	allowedTypes := []string{"image/jpeg", "image/jpg", "image/png"}
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.files.CheckQuota(c.Request.Context(), userID, getRole(c), header.Size); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	image, err := h.images.Upload(c.Request.Context(), userID, file)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	h.audit.Record(c.Request.Context(), service.AuditEvent{
+		ActorID:    userID,
+		SubjectID:  userID,
+		Action:     "file.uploaded",
+		EntityType: "file",
+		EntityID:   image.URI,
+		After:      gin.H{"uri": image.URI, "size": header.Size, "filename": header.Filename},
+	})
+
+	c.JSON(http.StatusOK, image)
+}
+
+// POST /v1/file/presign
+func (h *FileHandler) Presign(c *gin.Context) {
+	var req model.PresignUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.files.CheckQuota(c.Request.Context(), userID, getRole(c), req.Size); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	upload, err := h.images.Presign(c.Request.Context(), userID, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, upload)
+}
+
+// POST /v1/file/presign/:uploadId/complete
+func (h *FileHandler) CompletePresigned(c *gin.Context) {
+	uploadID, err := uuid.Parse(c.Param("uploadId"))
+	if err != nil {
+		_ = c.Error(appErrors.ErrUploadNotFound.Wrap(err))
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	image, err := h.images.Complete(c.Request.Context(), userID, uploadID.String())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	h.audit.Record(c.Request.Context(), service.AuditEvent{
+		ActorID:    userID,
+		SubjectID:  userID,
+		Action:     "file.uploaded",
+		EntityType: "file",
+		EntityID:   image.URI,
+		After:      gin.H{"uri": image.URI, "uploadId": uploadID.String()},
+	})
+
+	c.JSON(http.StatusOK, image)
+}
 
-	isValidType := false
-	for _, allowedType := range allowedTypes {
-		if strings.Contains(contentType, allowedType) {
-			isValidType = true
-			break
-		}
+// GET /v1/file/:fileId
+func (h *FileHandler) Download(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("fileId"))
+	if err != nil {
+		_ = c.Error(appErrors.ErrInvalidFileID.Wrap(err))
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	link, err := h.files.Download(c.Request.Context(), userID, getRole(c), fileID, c.DefaultQuery("variant", imaging.OriginalVariant))
+	if err != nil {
+		_ = c.Error(err)
+		return
 	}
 
-	if !isValidType {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only JPEG and PNG files are allowed"})
+	// The link expires, the redirect must not outlive it in caches
+	c.Header("Cache-Control", "private, no-store")
+	c.Redirect(http.StatusFound, link)
+}
+
+// GET /v1/file/:fileId/metadata
+func (h *FileHandler) Metadata(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("fileId"))
+	if err != nil {
+		_ = c.Error(appErrors.ErrInvalidFileID.Wrap(err))
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	file, err := h.files.Metadata(c.Request.Context(), userID, getRole(c), fileID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, file)
+}
+
+// GET /v1/users/storage
+func (h *FileHandler) Usage(c *gin.Context) {
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	// Upload to MinIO
-	uri, err := h.storage.UploadFile(c.Request.Context(), file, header)
+	usage, err := h.files.Usage(c.Request.Context(), userID, getRole(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"uri": uri})
+	c.JSON(http.StatusOK, usage)
 }
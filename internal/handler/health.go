@@ -22,8 +22,10 @@ func NewHealthHandler(db *database.DB, cache *cache.Redis) *HealthHandler {
 }
 
 func (h *HealthHandler) Check(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	// Check database connection
-	if err := h.db.Ping(); err != nil {
+	if err := h.db.PingContext(ctx); err != nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"status":   "down",
 			"database": "disconnected",
@@ -33,7 +35,6 @@ func (h *HealthHandler) Check(c *gin.Context) {
 	}
 
 	// Check cache connection
-	ctx := c.Request.Context()
 	if err := h.cache.SetExp(ctx, "health_check", "ok", 10*time.Second); err != nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"status":   "degraded",
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/service"
+)
+
+const (
+	// oauthStateCookie ties the callback to the browser that started the flow
+	oauthStateCookie = "oauth_state"
+	oauthCookiePath  = "/api/v1/oauth"
+	// oauthCookieMaxAge matches how long the state is kept in Redis
+	oauthCookieMaxAge = 10 * 60
+)
+
+type OAuthHandler struct {
+	oauthService *service.OAuthService
+	// secureCookies is set when the callback is served over HTTPS
+	secureCookies bool
+}
+
+func NewOAuthHandler(oauthService *service.OAuthService, secureCookies bool) *OAuthHandler {
+	return &OAuthHandler{oauthService: oauthService, secureCookies: secureCookies}
+}
+
+// setStateCookie stores state in an HttpOnly cookie. Providers posting the
+// callback need SameSite=None, which browsers only accept on secure cookies.
+func (h *OAuthHandler) setStateCookie(c *gin.Context, provider, state string, maxAge int) {
+	sameSite := http.SameSiteLaxMode
+	if h.secureCookies && h.oauthService.FormPost(provider) {
+		sameSite = http.SameSiteNoneMode
+	}
+	c.SetSameSite(sameSite)
+	c.SetCookie(oauthStateCookie, state, maxAge, oauthCookiePath, "", h.secureCookies, true)
+}
+
+// GET /v1/oauth/:provider/authorize
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	url, state, err := h.oauthService.Authorize(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	h.setStateCookie(c, c.Param("provider"), state, oauthCookieMaxAge)
+	c.Redirect(http.StatusFound, url)
+}
+
+// GET|POST /v1/oauth/:provider/callback, providers using form_post send a POST
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	browserState, _ := c.Cookie(oauthStateCookie)
+	// The state is single use whatever the outcome
+	h.setStateCookie(c, c.Param("provider"), "", -1)
+
+	if errParam := c.Request.FormValue("error"); errParam != "" {
+		_ = c.Error(appErrors.ErrOAuthFailed.WithMessage("provider returned " + errParam))
+		return
+	}
+
+	user, err := h.oauthService.Callback(c.Request.Context(), c.Param("provider"), c.Request.FormValue("code"), c.Request.FormValue("state"), browserState)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Success": user})
+}
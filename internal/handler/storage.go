@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/service"
+	"github.com/insanjati/fitbyte/internal/storage"
+)
+
+// maxLocalUploadBody leaves room for the form fields next to the file
+const maxLocalUploadBody = service.MaxImageSize + 1<<20
+
+// StorageHandler serves the local storage backend, uploads go through the app
+// instead of an object store
+type StorageHandler struct {
+	local *storage.LocalStorage
+}
+
+func NewStorageHandler(local *storage.LocalStorage) *StorageHandler {
+	return &StorageHandler{local: local}
+}
+
+// POST /v1/storage
+func (h *StorageHandler) Upload(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxLocalUploadBody)
+	form, err := c.MultipartForm()
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			_ = c.Error(fmt.Errorf("%w: %v", appErrors.ErrPayloadTooLarge, err))
+			return
+		}
+		_ = c.Error(appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "file", Tag: "required", Message: "file is required"}).Wrap(err))
+		return
+	}
+
+	files := form.File["file"]
+	if len(files) == 0 {
+		_ = c.Error(appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "file", Tag: "required", Message: "file is required"}))
+		return
+	}
+	file, err := files[0].Open()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	defer file.Close()
+
+	formData := make(map[string]string, len(form.Value))
+	for key, values := range form.Value {
+		formData[key] = values[0]
+	}
+
+	err = h.local.AcceptPost(c.Request.Context(), formData, file)
+	switch {
+	case errors.Is(err, storage.ErrInvalidSignature):
+		_ = c.Error(appErrors.ErrAccessDenied.WithMessage(err.Error()).Wrap(err))
+		return
+	case errors.Is(err, storage.ErrObjectTooLarge):
+		_ = c.Error(fmt.Errorf("%w: %v", appErrors.ErrPayloadTooLarge, err))
+		return
+	case err != nil:
+		_ = c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GET /v1/storage/*object, authorized by the signature of the URL
+func (h *StorageHandler) Download(c *gin.Context) {
+	objectName := strings.TrimPrefix(c.Param("object"), "/")
+	err := h.local.ServeObject(c.Writer, c.Request, objectName)
+	if errors.Is(err, storage.ErrInvalidSignature) {
+		_ = c.Error(appErrors.ErrAccessDenied.WithMessage(err.Error()).Wrap(err))
+		return
+	}
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		_ = c.Error(appErrors.ErrNotFound)
+		return
+	}
+	if err != nil {
+		_ = c.Error(err)
+	}
+}
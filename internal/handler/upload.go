@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/service"
+)
+
+// chunkChecksumHeader carries the hex SHA-256 of a chunk
+const chunkChecksumHeader = "X-Chunk-SHA256"
+
+type UploadHandler struct {
+	uploads *service.UploadService
+	files   *service.FileService
+	audit   *service.AuditService
+}
+
+func NewUploadHandler(uploads *service.UploadService, files *service.FileService, audit *service.AuditService) *UploadHandler {
+	return &UploadHandler{uploads: uploads, files: files, audit: audit}
+}
+
+func parseUploadID(c *gin.Context) (uuid.UUID, error) {
+	uploadID, err := uuid.Parse(c.Param("uploadId"))
+	if err != nil {
+		return uuid.Nil, appErrors.ErrUploadNotFound.Wrap(err)
+	}
+	return uploadID, nil
+}
+
+// POST /v1/uploads
+func (h *UploadHandler) Create(c *gin.Context) {
+	var req model.CreateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(validationError(err))
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.files.CheckQuota(c.Request.Context(), userID, getRole(c), req.Size); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	session, err := h.uploads.Create(c.Request.Context(), userID, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, session)
+}
+
+// GET /v1/uploads/:uploadId
+func (h *UploadHandler) Get(c *gin.Context) {
+	uploadID, err := parseUploadID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	session, err := h.uploads.Get(c.Request.Context(), userID, uploadID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// PUT /v1/uploads/:uploadId/chunks/:index
+func (h *UploadHandler) PutChunk(c *gin.Context) {
+	uploadID, err := parseUploadID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		_ = c.Error(appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "index", Tag: "numeric", Message: "chunk index must be a number"}).Wrap(err))
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	session, err := h.uploads.PutChunk(c.Request.Context(), userID, uploadID, index, c.GetHeader(chunkChecksumHeader), c.Request.Body)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// POST /v1/uploads/:uploadId/complete
+func (h *UploadHandler) Complete(c *gin.Context) {
+	uploadID, err := parseUploadID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	file, err := h.uploads.Complete(c.Request.Context(), userID, uploadID)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	h.audit.Record(c.Request.Context(), service.AuditEvent{
+		ActorID:    userID,
+		SubjectID:  userID,
+		Action:     "file.uploaded",
+		EntityType: "file",
+		EntityID:   file.URI,
+		After:      gin.H{"uri": file.URI, "size": file.Size, "contentType": file.ContentType, "uploadId": uploadID.String()},
+	})
+
+	c.JSON(http.StatusCreated, file)
+}
+
+// DELETE /v1/uploads/:uploadId
+func (h *UploadHandler) Abort(c *gin.Context) {
+	uploadID, err := parseUploadID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.uploads.Abort(c.Request.Context(), userID, uploadID); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+)
+
+// validationError turns binding/validation failures into a 400 AppError with
+// one FieldError per invalid field. The English messages built here are only a
+// fallback, the error middleware re-translates the wrapped validator errors.
+func validationError(err error) error {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return appErrors.ErrInvalidBody.Wrap(err)
+	}
+
+	fields := make([]appErrors.FieldError, 0, len(errs))
+	for _, e := range errs {
+		fields = append(fields, appErrors.FieldError{
+			Field:   jsonName(e.Field()),
+			Tag:     e.Tag(),
+			Message: fieldMessage(e),
+		})
+	}
+	return appErrors.ErrValidation.WithFields(fields...).Wrap(err)
+}
+
+func fieldMessage(e validator.FieldError) string {
+	field := jsonName(e.Field())
+	switch e.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of [%s]", field, e.Param())
+	case "min", "gte":
+		return fmt.Sprintf("%s must be at least %s", field, e.Param())
+	case "max", "lte":
+		return fmt.Sprintf("%s must be at most %s", field, e.Param())
+	default:
+		return fmt.Sprintf("%s is invalid", field)
+	}
+}
+
+// jsonName converts a Go field name (WeightUnit) to its JSON name (weightUnit)
+func jsonName(field string) string {
+	if field == "" {
+		return field
+	}
+	r := []rune(field)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
@@ -0,0 +1,128 @@
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/id"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+	idTranslations "github.com/go-playground/validator/v10/translations/id"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"golang.org/x/text/language"
+)
+
+const (
+	English    = "en"
+	Indonesian = "id"
+
+	DefaultLocale = English
+)
+
+type ctxKey struct{}
+
+// Translator resolves the request locale and translates validation and domain errors
+type Translator struct {
+	uni     *ut.UniversalTranslator
+	matcher language.Matcher
+}
+
+// New registers en/id translations on validate and makes it report JSON field names
+func New(validate *validator.Validate) (*Translator, error) {
+	enLocale := en.New()
+	uni := ut.New(enLocale, enLocale, id.New())
+
+	validate.RegisterTagNameFunc(jsonTagName)
+
+	enTrans, _ := uni.GetTranslator(English)
+	if err := enTranslations.RegisterDefaultTranslations(validate, enTrans); err != nil {
+		return nil, fmt.Errorf("failed to register en translations: %w", err)
+	}
+
+	idTrans, _ := uni.GetTranslator(Indonesian)
+	if err := idTranslations.RegisterDefaultTranslations(validate, idTrans); err != nil {
+		return nil, fmt.Errorf("failed to register id translations: %w", err)
+	}
+
+	return &Translator{
+		uni:     uni,
+		matcher: language.NewMatcher([]language.Tag{language.English, language.Indonesian}),
+	}, nil
+}
+
+// Negotiate picks the best supported locale for an Accept-Language header
+func (t *Translator) Negotiate(acceptLanguage string) string {
+	if acceptLanguage == "" {
+		return DefaultLocale
+	}
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return DefaultLocale
+	}
+	_, index, confidence := t.matcher.Match(tags...)
+	if confidence == language.No {
+		return DefaultLocale
+	}
+	if index == 1 {
+		return Indonesian
+	}
+	return English
+}
+
+// Message translates a domain error code, falling back to the given message
+// when the locale has no entry for it
+func (t *Translator) Message(locale, code, fallback string) string {
+	if msg, ok := messages[locale][code]; ok {
+		return msg
+	}
+	return fallback
+}
+
+// Fields translates validator errors into field level details
+func (t *Translator) Fields(locale string, errs validator.ValidationErrors) []appErrors.FieldError {
+	trans, _ := t.uni.GetTranslator(locale)
+
+	fields := make([]appErrors.FieldError, 0, len(errs))
+	for _, e := range errs {
+		fields = append(fields, appErrors.FieldError{
+			Field:   e.Field(),
+			Tag:     e.Tag(),
+			Message: e.Translate(trans),
+		})
+	}
+	return fields
+}
+
+// Field translates a field error raised outside the validator (e.g. by a service)
+func (t *Translator) Field(locale string, field appErrors.FieldError) appErrors.FieldError {
+	if format, ok := fieldMessages[locale][field.Tag]; ok {
+		field.Message = fmt.Sprintf(format, field.Field)
+	}
+	return field
+}
+
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, locale)
+}
+
+func LocaleFromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(ctxKey{}).(string); ok {
+		return locale
+	}
+	return DefaultLocale
+}
+
+func jsonTagName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
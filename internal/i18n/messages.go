@@ -0,0 +1,81 @@
+package i18n
+
+// messages holds client facing texts for AppError codes per locale. English
+// is the language errors are declared in, so it needs no entry here.
+var messages = map[string]map[string]string{
+	Indonesian: {
+		"validation_failed":        "validasi permintaan gagal",
+		"invalid_body":             "isi permintaan tidak valid",
+		"invalid_done_at":          "doneAt harus berupa tanggal ISO 8601",
+		"invalid_activity_type":    "activityType tidak didukung",
+		"invalid_duration":         "durationInMinutes harus >= 1",
+		"invalid_activity_id":      "activityId harus berupa UUID yang valid",
+		"invalid_email":            "format email tidak valid",
+		"invalid_password":         "panjang kata sandi harus antara 8 dan 32 karakter",
+		"invalid_credentials":      "email atau kata sandi salah",
+		"missing_token":            "token permintaan tidak ditemukan",
+		"invalid_token":            "token permintaan tidak valid",
+		"expired_token":            "token permintaan sudah kedaluwarsa",
+		"user_not_found":           "pengguna tidak ditemukan",
+		"activity_not_found":       "aktivitas tidak ditemukan",
+		"email_exists":             "email sudah terdaftar",
+		"bad_request":              "permintaan tidak valid",
+		"unauthorized":             "tidak terautentikasi",
+		"forbidden":                "akses ditolak",
+		"not_found":                "tidak ditemukan",
+		"conflict":                 "terjadi konflik",
+		"payload_too_large":        "ukuran data terlalu besar",
+		"too_many_requests":        "terlalu banyak permintaan",
+		"invalid_account_token":    "token tidak valid atau sudah kedaluwarsa",
+		"email_not_verified":       "alamat email belum diverifikasi",
+		"email_already_verified":   "alamat email sudah diverifikasi",
+		"session_revoked":          "sesi telah dicabut, silakan masuk kembali",
+		"invalid_current_password": "kata sandi saat ini salah",
+		"account_pending_deletion": "akun dijadwalkan untuk dihapus, pulihkan akun untuk masuk",
+		"unknown_provider":         "penyedia login tidak didukung",
+		"oauth_failed":             "gagal masuk melalui penyedia",
+		"identity_conflict":        "akun dengan email ini sudah ada, masuk dengan kata sandi terlebih dahulu",
+		"invalid_two_factor_code":  "kode autentikasi dua faktor tidak valid",
+		"invalid_login_challenge":  "tantangan masuk tidak valid atau sudah kedaluwarsa, silakan masuk kembali",
+		"two_factor_enabled":       "autentikasi dua faktor sudah aktif",
+		"two_factor_not_enrolled":  "autentikasi dua faktor belum diatur",
+		"invalid_user_id":          "userId harus berupa UUID yang valid",
+		"access_denied":            "anda tidak memiliki akses ke sumber daya ini",
+		"account_disabled":         "akun telah dinonaktifkan",
+		"invalid_relationship_id":  "relationshipId harus berupa UUID yang valid",
+		"coaching_not_found":       "hubungan pelatihan tidak ditemukan",
+		"coaching_exists":          "hubungan pelatihan dengan pengguna ini sudah ada",
+		"coaching_read_only":       "hubungan pelatihan hanya mengizinkan melihat aktivitas",
+		"invalid_token_id":         "tokenId harus berupa UUID yang valid",
+		"access_token_not_found":   "token akses tidak ditemukan",
+		"insufficient_scope":       "token akses tidak mengizinkan permintaan ini",
+		"upload_not_found":         "unggahan tidak ditemukan atau sudah kedaluwarsa",
+		"upload_completing":        "unggahan sedang diselesaikan, panggil selesai lagi untuk menuntaskannya",
+		"upload_incomplete":        "berkas belum diunggah",
+		"invalid_image_uri":        "imageUri harus mengarah ke salah satu gambar yang Anda unggah",
+		"invalid_file_id":          "fileId harus berupa UUID yang valid",
+		"file_not_found":           "berkas tidak ditemukan",
+		"invalid_attachment_id":    "attachmentId harus berupa UUID yang valid",
+		"attachment_not_found":     "lampiran tidak ditemukan",
+		"too_many_attachments":     "aktivitas sudah memiliki jumlah lampiran maksimum",
+		"file_pending_scan":        "berkas masih dipindai, coba lagi sebentar lagi",
+		"file_rejected":            "berkas ditolak oleh pemindaian malware",
+		"chunk_checksum_mismatch":  "potongan berkas tidak cocok dengan checksum X-Chunk-SHA256",
+		"not_following":            "Anda tidak mengikuti pengguna ini",
+		"storage_quota_exceeded":   "unggahan melebihi kuota penyimpanan Anda",
+		"login_locked":             "terlalu banyak percobaan masuk yang gagal, coba lagi nanti",
+		"internal_server_error":    "terjadi kesalahan pada server",
+		"service_unavailable":      "layanan tidak tersedia",
+		"gateway_timeout":          "waktu permintaan habis",
+	},
+}
+
+// fieldMessages translate field errors that do not come from the validator;
+// English keeps the message the error was created with
+var fieldMessages = map[string]map[string]string{
+	Indonesian: {
+		"required": "%s wajib diisi",
+		"max":      "%s terlalu besar",
+		"mimetype": "tipe berkas %s tidak didukung",
+	},
+}
@@ -0,0 +1,154 @@
+// Package imaging sanitizes uploaded images: the real format is sniffed from
+// the content, the image is decoded and encoded again, which drops EXIF and
+// anything appended to the file, and resized variants are generated.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+)
+
+// maxPixels rejects decompression bombs before the pixels are allocated
+const maxPixels = 40_000_000
+
+const jpegQuality = 85
+
+// OriginalVariant names the re-encoded image at full size
+const OriginalVariant = "original"
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooManyPixels     = errors.New("image dimensions are too large")
+)
+
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+)
+
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+func (f Format) Extension() string {
+	if f == FormatJPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+// Size is a variant that fits in a MaxDimension square, images are never
+// scaled up
+type Size struct {
+	Name         string
+	MaxDimension int
+}
+
+type Variant struct {
+	Name   string
+	Data   []byte
+	Width  int
+	Height int
+}
+
+type Result struct {
+	Format   Format
+	Original Variant
+	Variants []Variant
+}
+
+// Detect returns the format from the magic bytes of data
+func Detect(data []byte) (Format, error) {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return FormatJPEG, nil
+	case "image/png":
+		return FormatPNG, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// Process re-encodes data and renders every size. JPEG orientation is applied
+// to the pixels since the EXIF block carrying it is dropped.
+func Process(data []byte, sizes []Size) (*Result, error) {
+	format, err := Detect(data)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	if format == FormatJPEG {
+		img = orient(img, exifOrientation(data))
+	}
+
+	result := &Result{Format: format}
+	if result.Original, err = encode(OriginalVariant, img, format); err != nil {
+		return nil, err
+	}
+	for _, size := range sizes {
+		variant, err := encode(size.Name, resize(img, size.MaxDimension), format)
+		if err != nil {
+			return nil, err
+		}
+		result.Variants = append(result.Variants, variant)
+	}
+
+	return result, nil
+}
+
+func encode(name string, img image.Image, format Format) (Variant, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == FormatJPEG {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return Variant{}, fmt.Errorf("failed to encode %s variant: %w", name, err)
+	}
+
+	b := img.Bounds()
+	return Variant{Name: name, Data: buf.Bytes(), Width: b.Dx(), Height: b.Dy()}, nil
+}
+
+func resize(img image.Image, maxDimension int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxDimension && h <= maxDimension {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*maxDimension/w)
+		w = maxDimension
+	} else {
+		w = max(1, w*maxDimension/h)
+		h = maxDimension
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
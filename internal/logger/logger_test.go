@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value any
+		want  string
+	}{
+		{"password", "password", "hunter2", "[REDACTED]"},
+		{"suffix", "smtp_password", "hunter2", "[REDACTED]"},
+		{"prefix", "access_token", "eyJhbGciOi", "[REDACTED]"},
+		{"camel case", "refreshToken", "abc", "[REDACTED]"},
+		{"client secret", "client_secret", "abc", "[REDACTED]"},
+		{"api key", "api_key", "abc", "[REDACTED]"},
+		{"identifier", "token_id", "6f1c", "6f1c"},
+		{"cache key", "key", "activity:6f1c", "activity:6f1c"},
+		{"email", "email", "jane@example.com", "j***@example.com"},
+		{"dsn", "dsn", "postgres://fitbyte:hunter2@db:5432/fitbyte", "postgres://fitbyte:xxxxx@db:5432/fitbyte"},
+		{"dsn in message", "detail", "dial postgres://fitbyte:hunter2@db:5432/fitbyte", "dial postgres://fitbyte:xxxxx@db:5432/fitbyte"},
+		{"dsn in error", "error", errors.New("connect postgres://fitbyte:hunter2@db/fitbyte: refused"), "connect postgres://fitbyte:xxxxx@db/fitbyte: refused"},
+		{"email in error", "error", errors.New("user jane@example.com not found"), "user j***@example.com not found"},
+		{"plain value", "path", "/api/v1/activity", "/api/v1/activity"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			NewWithWriter(&buf, Config{Level: "info", Format: "json"}).Info("test", tt.key, tt.value)
+
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("invalid log line %q: %v", buf.String(), err)
+			}
+			if got := entry[tt.key]; got != tt.want {
+				t.Errorf("%s = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "fitbyte"
+
+// HTTP
+var (
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests by route, method and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Cache
+var (
+	CacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Cache lookups by key family and result (hit, miss, error).",
+	}, []string{"family", "result"})
+)
+
+// Storage
+var (
+	StorageUploadBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "upload_size_bytes",
+		Help:      "Size of uploaded objects.",
+		Buckets:   prometheus.ExponentialBuckets(16*1024, 4, 8), // 16KB .. 256MB
+	}, []string{"backend"})
+
+	StorageUploadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "upload_duration_seconds",
+		Help:      "Latency of object uploads.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "result"})
+
+	FileScansTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "file_scans_total",
+		Help:      "Number of malware scans of uploaded files by result.",
+	}, []string{"result"})
+)
+
+// Business
+var (
+	ActivitiesCreatedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "activity",
+		Name:      "created_total",
+		Help:      "Number of activities created by activity type.",
+	}, []string{"activity_type"})
+
+	UsersRegisteredTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "user",
+		Name:      "registered_total",
+		Help:      "Number of registered users.",
+	})
+
+	LoginsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "user",
+		Name:      "logins_total",
+		Help:      "Login attempts by result.",
+	}, []string{"result"})
+)
+
+// RegisterDBStats exposes the connection pool statistics of db
+func RegisterDBStats(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// KeyFamily returns the prefix of a cache key (e.g. "user_activities" for
+// "user_activities:<uuid>_limit_5") so labels stay low-cardinality
+func KeyFamily(key string) string {
+	if i := strings.IndexByte(key, ':'); i > 0 {
+		return key[:i]
+	}
+	return "other"
+}
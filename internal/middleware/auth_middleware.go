@@ -1,11 +1,15 @@
 package middleware
 
 import (
-	"net/http"
+	"context"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/model"
 	"github.com/insanjati/fitbyte/internal/service"
 )
 
@@ -13,81 +17,105 @@ type AuthMiddleware interface {
 	CheckToken() gin.HandlerFunc
 }
 
+// SessionValidator rejects tokens that were revoked after being issued
+type SessionValidator interface {
+	Validate(ctx context.Context, userID uuid.UUID, issuedAt time.Time) error
+}
+
+// AccessTokenAuthenticator resolves personal access tokens
+type AccessTokenAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (*model.PersonalAccessToken, error)
+}
+
 type authMiddleware struct {
-	jwtService service.JwtService
+	jwtService   service.JwtService
+	sessions     SessionValidator
+	accessTokens AccessTokenAuthenticator
 }
 
 func (a *authMiddleware) CheckToken() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		header := ctx.GetHeader("Authorization")
 		if header == "" {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error":   "Unauthorized",
-				"message": "Missing request token",
-			})
+			abortWithError(ctx, appErrors.ErrMissingToken)
 			return
 		}
 
 		if !strings.HasPrefix(header, "Bearer ") {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error":   "Unauthorized",
-				"message": "Invalid request token format",
-			})
+			abortWithError(ctx, appErrors.ErrInvalidToken.WithMessage("invalid request token format"))
 			return
 		}
 
 		token := strings.TrimPrefix(header, "Bearer ")
 		if token == "" {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error":   "Unauthorized",
-				"message": "Missing request token",
-			})
+			abortWithError(ctx, appErrors.ErrMissingToken)
 			return
 		}
 
-		claims, err := a.jwtService.VerifyToken(token)
-		if err != nil {
-
-			var message string
-			switch {
-			case strings.Contains(err.Error(), "expired"):
-				message = "Expired request token"
-			case strings.Contains(err.Error(), "invalid"):
-				message = "Invalid request token"
-			default:
-				message = "Invalid request token"
+		if strings.HasPrefix(token, service.AccessTokenPrefix) {
+			pat, err := a.accessTokens.Authenticate(ctx.Request.Context(), token)
+			if err != nil {
+				abortWithError(ctx, err)
+				return
 			}
 
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error":   "Unauthorized",
-				"message": message,
-			})
+			ctx.Set("token_scopes", pat.Scopes)
+			authenticate(ctx, pat.UserID, pat.Role)
+			return
+		}
+
+		claims, err := a.jwtService.VerifyToken(token)
+		if err != nil {
+			abortWithError(ctx, err)
 			return
 		}
 
 		uidStr, ok := claims["user_id"].(string)
 		if !ok {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error":   "Unauthorized",
-				"message": "Invalid user ID type",
-			})
+			abortWithError(ctx, appErrors.ErrInvalidToken.WithMessage("invalid user ID type"))
 			return
 		}
 
 		uid, err := uuid.Parse(uidStr)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error":   "Unauthorized",
-				"message": "Invalid UUID format",
-			})
+			abortWithError(ctx, appErrors.ErrInvalidToken.WithMessage("invalid UUID format").Wrap(err))
 			return
 		}
 
-		ctx.Set("user_id", uid)
-		ctx.Next()
+		iat, ok := claims["iat"].(float64)
+		if !ok {
+			abortWithError(ctx, appErrors.ErrInvalidToken.WithMessage("missing issued at claim"))
+			return
+		}
+
+		if err := a.sessions.Validate(ctx.Request.Context(), uid, time.Unix(int64(iat), 0)); err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+
+		// Tokens issued before roles existed belong to regular users
+		role := model.RoleUser
+		if claimed, ok := claims["role"].(string); ok && claimed != "" {
+			role = model.Role(claimed)
+		}
+
+		authenticate(ctx, uid, role)
 	}
 }
 
-func NewAuthMiddleware(jwtService service.JwtService) AuthMiddleware {
-	return &authMiddleware{jwtService: jwtService}
+func authenticate(ctx *gin.Context, userID uuid.UUID, role model.Role) {
+	ctx.Set("user_id", userID)
+	ctx.Set("role", role)
+	ctx.Request = ctx.Request.WithContext(logger.With(ctx.Request.Context(), "user_id", userID.String()))
+	ctx.Next()
+}
+
+// abortWithError stops the chain and leaves rendering to ErrorHandler
+func abortWithError(ctx *gin.Context, err error) {
+	_ = ctx.Error(err)
+	ctx.Abort()
+}
+
+func NewAuthMiddleware(jwtService service.JwtService, sessions SessionValidator, accessTokens AccessTokenAuthenticator) AuthMiddleware {
+	return &authMiddleware{jwtService: jwtService, sessions: sessions, accessTokens: accessTokens}
 }
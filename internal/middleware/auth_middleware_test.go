@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/service"
+)
+
+const testJwtKey = "test-jwt-key"
+
+var testJwt = service.NewJwtService(&service.SecurityConfig{Key: testJwtKey, Durasi: time.Hour, Issues: "fitbyte"})
+
+// acceptSessions treats every JWT as not revoked
+type acceptSessions struct{}
+
+func (acceptSessions) Validate(context.Context, uuid.UUID, time.Time) error { return nil }
+
+// accessTokens resolves personal access tokens from a fixed set
+type accessTokens map[string]*model.PersonalAccessToken
+
+func (a accessTokens) Authenticate(ctx context.Context, token string) (*model.PersonalAccessToken, error) {
+	pat, ok := a[token]
+	if !ok {
+		return nil, appErrors.ErrInvalidToken
+	}
+	return pat, nil
+}
+
+// newAuthRouter serves routes behind CheckToken and ErrorHandler like the
+// protected group of the app, every route answers 200 once let through
+func newAuthRouter(tokens accessTokens, routes map[string][]gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler(nil))
+	router.Use(NewAuthMiddleware(testJwt, acceptSessions{}, tokens).CheckToken())
+	for path, handlers := range routes {
+		router.GET(path, append(handlers, func(ctx *gin.Context) { ctx.Status(http.StatusOK) })...)
+	}
+	return router
+}
+
+// call requests path with token and returns the status and problem code
+func call(t *testing.T, router *gin.Engine, path, token string) (int, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var problem Problem
+	if w.Code != http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("invalid problem %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, problem.Code
+}
+
+func jwtFor(t *testing.T, role model.Role) string {
+	t.Helper()
+	token, err := testJwt.GenerateToken(&model.User{ID: uuid.New(), Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func signClaims(t *testing.T, key string, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRequireRole(t *testing.T) {
+	now := time.Now()
+	userID := uuid.NewString()
+	tokens := accessTokens{
+		"fbp_admin": {UserID: uuid.New(), Role: model.RoleAdmin, Scopes: []model.TokenScope{model.ScopeProfileRead}},
+	}
+	router := newAuthRouter(tokens, map[string][]gin.HandlerFunc{
+		"/admin": {RequireRole(model.RoleAdmin)},
+		"/coach": {RequireRole(model.RoleCoach, model.RoleAdmin)},
+	})
+
+	tests := []struct {
+		name       string
+		token      string
+		path       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"admin on admin route", jwtFor(t, model.RoleAdmin), "/admin", http.StatusOK, ""},
+		{"coach on admin route", jwtFor(t, model.RoleCoach), "/admin", http.StatusForbidden, "access_denied"},
+		{"user on admin route", jwtFor(t, model.RoleUser), "/admin", http.StatusForbidden, "access_denied"},
+		{"coach on coach route", jwtFor(t, model.RoleCoach), "/coach", http.StatusOK, ""},
+		{"admin on coach route", jwtFor(t, model.RoleAdmin), "/coach", http.StatusOK, ""},
+		{"user on coach route", jwtFor(t, model.RoleUser), "/coach", http.StatusForbidden, "access_denied"},
+		{"new user without role", jwtFor(t, ""), "/coach", http.StatusForbidden, "access_denied"},
+		{"token from before roles", signClaims(t, testJwtKey, jwt.MapClaims{"iss": "fitbyte", "user_id": userID, "iat": now.Unix(), "exp": now.Add(time.Hour).Unix()}), "/admin", http.StatusForbidden, "access_denied"},
+		{"admin claim signed with another key", signClaims(t, "other-key", jwt.MapClaims{"iss": "fitbyte", "user_id": userID, "role": "admin", "iat": now.Unix(), "exp": now.Add(time.Hour).Unix()}), "/admin", http.StatusUnauthorized, "invalid_token"},
+		{"unknown role", signClaims(t, testJwtKey, jwt.MapClaims{"iss": "fitbyte", "user_id": userID, "role": "superuser", "iat": now.Unix(), "exp": now.Add(time.Hour).Unix()}), "/admin", http.StatusForbidden, "access_denied"},
+		{"personal token keeps its role", "fbp_admin", "/admin", http.StatusOK, ""},
+		{"no token", "", "/admin", http.StatusUnauthorized, "missing_token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := call(t, router, tt.path, tt.token)
+			if status != tt.wantStatus || code != tt.wantCode {
+				t.Errorf("GET %s = %d %q, want %d %q", tt.path, status, code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRequireRoleWithoutCheckToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler(nil))
+	router.GET("/admin", RequireRole(model.RoleAdmin), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	if status, code := call(t, router, "/admin", ""); status != http.StatusUnauthorized || code != "unauthorized" {
+		t.Errorf("GET /admin = %d %q, want 401 unauthorized", status, code)
+	}
+}
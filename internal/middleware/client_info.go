@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/insanjati/fitbyte/internal/service"
+)
+
+// ClientInfo makes the client IP and user agent available to the audit log
+func ClientInfo() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Request = ctx.Request.WithContext(service.WithClientInfo(ctx.Request.Context(), service.ClientInfo{
+			IP:        ctx.ClientIP(),
+			UserAgent: ctx.Request.UserAgent(),
+		}))
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/i18n"
+	"github.com/insanjati/fitbyte/internal/logger"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details document
+type Problem struct {
+	Type      string                 `json:"type"`
+	Title     string                 `json:"title"`
+	Status    int                    `json:"status"`
+	Detail    string                 `json:"detail,omitempty"`
+	Instance  string                 `json:"instance,omitempty"`
+	Code      string                 `json:"code"`
+	RequestID string                 `json:"requestId,omitempty"`
+	Errors    []appErrors.FieldError `json:"errors,omitempty"`
+}
+
+// ErrorHandler renders the last error attached with ctx.Error as problem+json.
+// Handlers only need to call ctx.Error(err) and return.
+func ErrorHandler(tr *i18n.Translator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		if len(ctx.Errors) == 0 || ctx.Writer.Written() {
+			return
+		}
+
+		WriteProblem(ctx, tr, ctx.Errors.Last().Err)
+	}
+}
+
+// Recovery turns panics into a problem+json 500 response
+func Recovery(tr *i18n.Translator) gin.HandlerFunc {
+	return gin.CustomRecovery(func(ctx *gin.Context, recovered any) {
+		logger.FromContext(ctx.Request.Context()).Error("panic recovered", "panic", recovered)
+		WriteProblem(ctx, tr, appErrors.ErrInternalServerError)
+	})
+}
+
+// WriteProblem renders err in the request locale. tr may be nil, in which
+// case the untranslated messages are used.
+func WriteProblem(ctx *gin.Context, tr *i18n.Translator, err error) {
+	appErr := appErrors.FromError(err)
+	detail, fields := appErr.Message, appErr.Fields
+
+	if tr != nil {
+		locale := i18n.LocaleFromContext(ctx.Request.Context())
+		if locale != i18n.DefaultLocale {
+			detail = tr.Message(locale, appErr.Code, appErr.Message)
+		}
+
+		var validationErrs validator.ValidationErrors
+		if errors.As(appErr, &validationErrs) {
+			fields = tr.Fields(locale, validationErrs)
+		} else if locale != i18n.DefaultLocale {
+			translated := make([]appErrors.FieldError, 0, len(fields))
+			for _, f := range fields {
+				translated = append(translated, tr.Field(locale, f))
+			}
+			fields = translated
+		}
+		ctx.Header("Content-Language", locale)
+	}
+
+	l := logger.FromContext(ctx.Request.Context())
+	if appErr.Status >= http.StatusInternalServerError {
+		l.Error("request failed", "code", appErr.Code, "error", err)
+	} else {
+		l.Debug("request rejected", "code", appErr.Code, "error", err)
+	}
+
+	problem := Problem{
+		Type:     "/problems/" + appErr.Code,
+		Title:    http.StatusText(appErr.Status),
+		Status:   appErr.Status,
+		Detail:   detail,
+		Instance: ctx.Request.URL.Path,
+		Code:     appErr.Code,
+		Errors:   fields,
+	}
+	if requestID, ok := ctx.Get("request_id"); ok {
+		problem.RequestID, _ = requestID.(string)
+	}
+
+	if appErr.RetryAfter > 0 {
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(appErr.RetryAfter.Seconds()))))
+	}
+
+	ctx.Header("Content-Type", problemContentType)
+	ctx.AbortWithStatusJSON(appErr.Status, problem)
+}
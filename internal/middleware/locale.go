@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/insanjati/fitbyte/internal/i18n"
+)
+
+// Locale negotiates the response language from Accept-Language
+func Locale(tr *i18n.Translator) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		locale := tr.Negotiate(ctx.GetHeader("Accept-Language"))
+		ctx.Set("locale", locale)
+		ctx.Request = ctx.Request.WithContext(i18n.WithLocale(ctx.Request.Context(), locale))
+		ctx.Next()
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/ratelimit"
+)
+
+// KeyFunc identifies the caller a rate limit applies to
+type KeyFunc func(ctx *gin.Context) string
+
+// KeyByIP limits per client IP
+func KeyByIP(ctx *gin.Context) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// KeyByUser limits per authenticated user and falls back to the client IP
+func KeyByUser(ctx *gin.Context) string {
+	if uid, ok := ctx.Get("user_id"); ok {
+		if id, ok := uid.(uuid.UUID); ok {
+			return "user:" + id.String()
+		}
+	}
+	return KeyByIP(ctx)
+}
+
+// RateLimit applies rule to every request of the route group, keyed by name
+// and keyFunc. Redis failures let the request through.
+func RateLimit(limiter *ratelimit.Limiter, name string, rule ratelimit.Rule, keyFunc KeyFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !rule.Enabled() {
+			ctx.Next()
+			return
+		}
+
+		res, err := limiter.Allow(ctx.Request.Context(), name+":"+keyFunc(ctx), rule)
+		if err != nil {
+			logger.FromContext(ctx.Request.Context()).Warn("rate limiter unavailable", "limit", name, "error", err)
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		ctx.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+
+		if !res.Allowed {
+			abortWithError(ctx, appErrors.ErrRateLimited.WithRetryAfter(res.RetryAfter))
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/cache/redistest"
+	"github.com/insanjati/fitbyte/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := uuid.New()
+	rule := ratelimit.Rule{Limit: 10, Window: time.Minute}
+
+	tests := []struct {
+		name           string
+		rule           ratelimit.Rule
+		keyFunc        KeyFunc
+		userID         *uuid.UUID
+		reply          []int64
+		replyErr       error
+		wantKey        string
+		wantStatus     int
+		wantRemaining  string
+		wantRetryAfter string
+	}{
+		{"allowed", rule, KeyByIP, nil, []int64{1, 9, 0}, nil, "ratelimit:login:ip:192.0.2.1", http.StatusOK, "9", ""},
+		{"last allowed", rule, KeyByIP, nil, []int64{1, 0, 0}, nil, "ratelimit:login:ip:192.0.2.1", http.StatusOK, "0", ""},
+		{"limited", rule, KeyByIP, nil, []int64{0, 0, 1500}, nil, "ratelimit:login:ip:192.0.2.1", http.StatusTooManyRequests, "0", "2"},
+		{"limited whole seconds", rule, KeyByIP, nil, []int64{0, 0, 30000}, nil, "ratelimit:login:ip:192.0.2.1", http.StatusTooManyRequests, "0", "30"},
+		{"by user", rule, KeyByUser, &userID, []int64{1, 9, 0}, nil, "ratelimit:login:user:" + userID.String(), http.StatusOK, "9", ""},
+		{"by user without user", rule, KeyByUser, nil, []int64{1, 9, 0}, nil, "ratelimit:login:ip:192.0.2.1", http.StatusOK, "9", ""},
+		{"redis down lets through", rule, KeyByIP, nil, nil, errors.New("connection refused"), "ratelimit:login:ip:192.0.2.1", http.StatusOK, "", ""},
+		{"disabled", ratelimit.Rule{}, KeyByIP, nil, []int64{0, 0, 1000}, nil, "", http.StatusOK, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := redistest.NewServer(t)
+			var gotKey string
+			server.HandleScript(func(keys, args []string) ([]int64, error) {
+				gotKey = keys[0]
+				if args[1] != strconv.FormatInt(tt.rule.Window.Milliseconds(), 10) || args[2] != strconv.Itoa(tt.rule.Limit) {
+					t.Errorf("script args = %v, want window %v and limit %d", args, tt.rule.Window, tt.rule.Limit)
+				}
+				return tt.reply, tt.replyErr
+			})
+
+			router := gin.New()
+			router.Use(ErrorHandler(nil))
+			router.Use(func(ctx *gin.Context) {
+				if tt.userID != nil {
+					ctx.Set("user_id", *tt.userID)
+				}
+			})
+			router.GET("/", RateLimit(ratelimit.NewLimiter(server.Client(t)), "login", tt.rule, tt.keyFunc), func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if gotKey != tt.wantKey {
+				t.Errorf("limited key = %q, want %q", gotKey, tt.wantKey)
+			}
+			if got := w.Header().Get("X-RateLimit-Remaining"); got != tt.wantRemaining {
+				t.Errorf("X-RateLimit-Remaining = %q, want %q", got, tt.wantRemaining)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
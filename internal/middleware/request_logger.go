@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/tracing"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID reuses the incoming X-Request-ID (or generates a new one), echoes it
+// back on the response and attaches a request scoped logger to the context
+func RequestID(base *slog.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = uuid.NewString()
+		}
+
+		ctx.Set("request_id", requestID)
+		ctx.Header(RequestIDHeader, requestID)
+
+		l := base.With("request_id", requestID)
+		if traceID := tracing.TraceID(ctx.Request.Context()); traceID != "" {
+			l = l.With("trace_id", traceID)
+		}
+		ctx.Request = ctx.Request.WithContext(logger.WithContext(ctx.Request.Context(), l))
+
+		ctx.Next()
+	}
+}
+
+// RequestLogger replaces gin's default access log with a structured one
+func RequestLogger() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := ctx.Writer.Status()
+		attrs := []any{
+			"method", ctx.Request.Method,
+			"route", route,
+			"status", status,
+			"latency_ms", time.Since(start).Milliseconds(),
+			"client_ip", ctx.ClientIP(),
+			"bytes", ctx.Writer.Size(),
+		}
+		if len(ctx.Errors) > 0 {
+			attrs = append(attrs, "errors", ctx.Errors.String())
+		}
+
+		// The auth middleware enriches the request context with user_id
+		l := logger.FromContext(ctx.Request.Context())
+		switch {
+		case status >= 500:
+			l.Error("request completed", attrs...)
+		case status >= 400:
+			l.Warn("request completed", attrs...)
+		default:
+			l.Info("request completed", attrs...)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+)
+
+// RequireRole rejects users whose token role is not one of roles. It must run
+// after CheckToken.
+func RequireRole(roles ...model.Role) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		role, ok := ctx.Get("role")
+		if !ok {
+			abortWithError(ctx, appErrors.ErrUnauthorized)
+			return
+		}
+
+		if !slices.Contains(roles, role.(model.Role)) {
+			abortWithError(ctx, appErrors.ErrAccessDenied)
+			return
+		}
+
+		ctx.Next()
+	}
+}
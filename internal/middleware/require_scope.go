@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+)
+
+// RequireScope lets personal access tokens through only when they carry
+// scope. Sessions signed in with a JWT are not restricted. It must run after
+// CheckToken.
+func RequireScope(scope model.TokenScope) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scopes, ok := ctx.Get("token_scopes")
+		if ok && !slices.Contains(scopes.([]model.TokenScope), scope) {
+			abortWithError(ctx, appErrors.ErrInsufficientScope)
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// RequireSession rejects personal access tokens, for routes like account
+// security and administration that need an interactive sign in
+func RequireSession() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if _, ok := ctx.Get("token_scopes"); ok {
+			abortWithError(ctx, appErrors.ErrInsufficientScope.WithMessage("personal access tokens cannot be used for this request"))
+			return
+		}
+
+		ctx.Next()
+	}
+}
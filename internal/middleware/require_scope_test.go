@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/model"
+)
+
+func TestRequireScopeAndSession(t *testing.T) {
+	allScopes := []model.TokenScope{model.ScopeActivityRead, model.ScopeActivityWrite, model.ScopeProfileRead, model.ScopeProfileWrite}
+	tokens := accessTokens{
+		"fbp_read":  {UserID: uuid.New(), Role: model.RoleUser, Scopes: []model.TokenScope{model.ScopeActivityRead}},
+		"fbp_none":  {UserID: uuid.New(), Role: model.RoleUser, Scopes: []model.TokenScope{}},
+		"fbp_all":   {UserID: uuid.New(), Role: model.RoleUser, Scopes: allScopes},
+		"fbp_admin": {UserID: uuid.New(), Role: model.RoleAdmin, Scopes: allScopes},
+	}
+	// Mirrors how the app mounts these routes
+	router := newAuthRouter(tokens, map[string][]gin.HandlerFunc{
+		"/activity":         {RequireScope(model.ScopeActivityRead)},
+		"/activity/write":   {RequireScope(model.ScopeActivityWrite)},
+		"/users/password":   {RequireSession()},
+		"/admin/users":      {RequireSession(), RequireRole(model.RoleAdmin)},
+		"/coaching/trainee": {RequireSession()},
+	})
+
+	tests := []struct {
+		name       string
+		token      string
+		path       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"session on read route", jwtFor(t, model.RoleUser), "/activity", http.StatusOK, ""},
+		{"session on write route", jwtFor(t, model.RoleUser), "/activity/write", http.StatusOK, ""},
+		{"token with scope", "fbp_read", "/activity", http.StatusOK, ""},
+		{"token without scope", "fbp_read", "/activity/write", http.StatusForbidden, "insufficient_scope"},
+		{"token without scopes", "fbp_none", "/activity", http.StatusForbidden, "insufficient_scope"},
+		{"token with every scope", "fbp_all", "/activity/write", http.StatusOK, ""},
+		{"session on account route", jwtFor(t, model.RoleUser), "/users/password", http.StatusOK, ""},
+		{"token on account route", "fbp_all", "/users/password", http.StatusForbidden, "insufficient_scope"},
+		{"token on coaching route", "fbp_all", "/coaching/trainee", http.StatusForbidden, "insufficient_scope"},
+		{"admin session on admin route", jwtFor(t, model.RoleAdmin), "/admin/users", http.StatusOK, ""},
+		{"admin token on admin route", "fbp_admin", "/admin/users", http.StatusForbidden, "insufficient_scope"},
+		{"unknown token", "fbp_revoked", "/activity", http.StatusUnauthorized, "invalid_token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := call(t, router, tt.path, tt.token)
+			if status != tt.wantStatus || code != tt.wantCode {
+				t.Errorf("GET %s = %d %q, want %d %q", tt.path, status, code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
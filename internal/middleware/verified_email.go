@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+)
+
+type EmailVerificationChecker interface {
+	IsEmailVerified(ctx context.Context, userID uuid.UUID) (bool, error)
+}
+
+// RequireVerifiedEmail blocks users that have not verified their email yet.
+// It must run after CheckToken.
+func RequireVerifiedEmail(checker EmailVerificationChecker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		uid, ok := ctx.Get("user_id")
+		userID, isUUID := uid.(uuid.UUID)
+		if !ok || !isUUID {
+			abortWithError(ctx, appErrors.ErrUnauthorized)
+			return
+		}
+
+		verified, err := checker.IsEmailVerified(ctx.Request.Context(), userID)
+		if err != nil {
+			abortWithError(ctx, err)
+			return
+		}
+		if !verified {
+			abortWithError(ctx, appErrors.ErrEmailNotVerified)
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TokenScope string
+
+const (
+	ScopeActivityRead  TokenScope = "activity:read"
+	ScopeActivityWrite TokenScope = "activity:write"
+	ScopeProfileRead   TokenScope = "profile:read"
+	ScopeProfileWrite  TokenScope = "profile:write"
+)
+
+// PersonalAccessToken lets scripts call the API without the user's password.
+// Only a hash of the token is stored.
+type PersonalAccessToken struct {
+	ID         uuid.UUID    `json:"id"`
+	UserID     uuid.UUID    `json:"-"`
+	Role       Role         `json:"-"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	Scopes     []TokenScope `json:"scopes"`
+	ExpiresAt  *time.Time   `json:"expiresAt"`
+	LastUsedAt *time.Time   `json:"lastUsedAt"`
+	CreatedAt  time.Time    `json:"createdAt"`
+}
+
+type CreateAccessTokenRequest struct {
+	Name          string       `json:"name" binding:"required,max=100"`
+	Scopes        []TokenScope `json:"scopes" binding:"required,min=1,dive,oneof=activity:read activity:write profile:read profile:write"`
+	ExpiresInDays *int         `json:"expiresInDays" binding:"omitempty,min=1,max=365"`
+}
+
+// CreatedAccessToken carries the plain token, it is only returned on creation
+type CreatedAccessToken struct {
+	PersonalAccessToken
+	Token string `json:"token"`
+}
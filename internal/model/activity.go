@@ -34,27 +34,66 @@ var ActivityTypeCalories = map[ActivityType]int{
 	ActivityTypeJumpRope:   10,
 }
 
+// ActivityVisibility decides who sees an activity in the feed: only its
+// owner, friends (followers the owner follows back) or every follower
+type ActivityVisibility string
+
+const (
+	ActivityVisibilityPrivate ActivityVisibility = "private"
+	ActivityVisibilityFriends ActivityVisibility = "friends"
+	ActivityVisibilityPublic  ActivityVisibility = "public"
+)
+
 type Activity struct {
-	ID                uuid.UUID    `json:"activityId" db:"id"`
-	UserID            uuid.UUID    `json:"userId" db:"user_id"`
-	ActivityType      ActivityType `json:"activityType" db:"activity_type"`
-	DoneAt            time.Time    `json:"doneAt" db:"done_at"`
-	DurationInMinutes int          `json:"durationInMinutes" db:"duration_in_minutes"`
-	CaloriesBurned    int          `json:"caloriesBurned" db:"calories_burned"`
-	CreatedAt         time.Time    `json:"createdAt" db:"created_at"`
-	UpdatedAt         time.Time    `json:"updatedAt" db:"updated_at"`
+	ID                uuid.UUID          `json:"activityId" db:"id"`
+	UserID            uuid.UUID          `json:"userId" db:"user_id"`
+	ActivityType      ActivityType       `json:"activityType" db:"activity_type"`
+	DoneAt            time.Time          `json:"doneAt" db:"done_at"`
+	DurationInMinutes int                `json:"durationInMinutes" db:"duration_in_minutes"`
+	CaloriesBurned    int                `json:"caloriesBurned" db:"calories_burned"`
+	Visibility        ActivityVisibility `json:"visibility" db:"visibility"`
+	CreatedAt         time.Time          `json:"createdAt" db:"created_at"`
+	UpdatedAt         time.Time          `json:"updatedAt" db:"updated_at"`
+	// Attachments are loaded for responses, they are never cached since
+	// their links expire
+	Attachments []ActivityAttachment `json:"-" db:"-"`
+}
+
+// ActivityAttachment is a photo or document attached to an activity. URI is
+// the stable file URL, Links are signed links to every variant.
+type ActivityAttachment struct {
+	ID          uuid.UUID         `json:"attachmentId" db:"id"`
+	ActivityID  uuid.UUID         `json:"-" db:"activity_id"`
+	FileID      uuid.UUID         `json:"fileId" db:"file_id"`
+	Name        string            `json:"name" db:"name"`
+	ContentType string            `json:"contentType" db:"content_type"`
+	Size        int64             `json:"size" db:"size"`
+	CreatedAt   time.Time         `json:"createdAt" db:"created_at"`
+	ScanStatus  ScanStatus        `json:"scanStatus" db:"scan_status"`
+	Objects     map[string]string `json:"-" db:"-"`
+	URI         string            `json:"uri" db:"-"`
+	Links       map[string]string `json:"links" db:"-"`
+}
+
+// AttachFileRequest attaches a file uploaded before, such as a resumable upload
+type AttachFileRequest struct {
+	FileID uuid.UUID `json:"fileId" binding:"required"`
+	Name   string    `json:"name" binding:"max=255"`
 }
 
 type CreateActivityRequest struct {
 	ActivityType      ActivityType `json:"activityType" binding:"required"`
 	DoneAt            string       `json:"doneAt" binding:"required"`
 	DurationInMinutes int          `json:"durationInMinutes" binding:"required,min=1"`
+	// Visibility defaults to private
+	Visibility ActivityVisibility `json:"visibility" binding:"omitempty,oneof=private friends public"`
 }
 
 type UpdateActivityRequest struct {
-	ActivityType      *ActivityType `json:"activityType"`
-	DoneAt            *string       `json:"doneAt"`
-	DurationInMinutes *int          `json:"durationInMinutes" binding:"omitempty,min=1"`
+	ActivityType      *ActivityType       `json:"activityType"`
+	DoneAt            *string             `json:"doneAt"`
+	DurationInMinutes *int                `json:"durationInMinutes" binding:"omitempty,min=1"`
+	Visibility        *ActivityVisibility `json:"visibility" binding:"omitempty,oneof=private friends public"`
 }
 
 type ActivityFilter struct {
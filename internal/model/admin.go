@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AdminUserFilter struct {
+	// Search matches email and name case-insensitively
+	Search string
+	Role   *Role
+	Limit  int
+	Offset int
+}
+
+type AdminUser struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	Name            *string    `json:"name" db:"name"`
+	Email           string     `json:"email" db:"email"`
+	Role            Role       `json:"role" db:"role"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt" db:"email_verified_at"`
+	DisabledAt      *time.Time `json:"disabledAt" db:"disabled_at"`
+	DeletedAt       *time.Time `json:"deletedAt" db:"deleted_at"`
+	CreatedAt       time.Time  `json:"createdAt" db:"created_at"`
+}
+
+type UpdateRoleRequest struct {
+	Role Role `json:"role" binding:"required,oneof=user coach admin"`
+}
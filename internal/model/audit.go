@@ -0,0 +1,34 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEntry records who did what to which entity. Before and After only hold
+// the fields that changed.
+type AuditEntry struct {
+	ID         uuid.UUID        `json:"id" db:"id"`
+	ActorID    *uuid.UUID       `json:"actorId" db:"actor_id"`
+	SubjectID  *uuid.UUID       `json:"subjectId" db:"subject_id"`
+	Action     string           `json:"action" db:"action"`
+	EntityType string           `json:"entityType" db:"entity_type"`
+	EntityID   *string          `json:"entityId" db:"entity_id"`
+	Before     *json.RawMessage `json:"before,omitempty" db:"before_data"`
+	After      *json.RawMessage `json:"after,omitempty" db:"after_data"`
+	Metadata   *json.RawMessage `json:"metadata,omitempty" db:"metadata"`
+	IPAddress  *string          `json:"ipAddress,omitempty" db:"ip_address"`
+	UserAgent  *string          `json:"userAgent,omitempty" db:"user_agent"`
+	CreatedAt  time.Time        `json:"createdAt" db:"created_at"`
+}
+
+type AuditFilter struct {
+	ActorID    *uuid.UUID
+	SubjectID  *uuid.UUID
+	Action     string
+	EntityType string
+	Limit      int
+	Offset     int
+}
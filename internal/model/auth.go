@@ -4,7 +4,10 @@ import "github.com/google/uuid"
 
 type AuthResponse struct{
 	Email     string    `json:"email" db:"email"`
-	Token     string    `json:"token"`
+	Token     string    `json:"token,omitempty"`
+	// Set instead of Token when the login still needs a second factor
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	ChallengeToken    string `json:"challengeToken,omitempty"`
 }
 
 type AuthRequest struct{
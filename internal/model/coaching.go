@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CoachingScope string
+
+const (
+	CoachingScopeRead      CoachingScope = "read"
+	CoachingScopeReadWrite CoachingScope = "read_write"
+)
+
+type CoachingStatus string
+
+const (
+	CoachingStatusPending CoachingStatus = "pending"
+	CoachingStatusActive  CoachingStatus = "active"
+)
+
+type CoachingRelationship struct {
+	ID           uuid.UUID      `json:"id" db:"id"`
+	CoachID      uuid.UUID      `json:"coachId" db:"coach_id"`
+	CoachEmail   string         `json:"coachEmail" db:"coach_email"`
+	TraineeID    uuid.UUID      `json:"traineeId" db:"trainee_id"`
+	TraineeEmail string         `json:"traineeEmail" db:"trainee_email"`
+	Scope        CoachingScope  `json:"scope" db:"scope"`
+	Status       CoachingStatus `json:"status" db:"status"`
+	CreatedAt    time.Time      `json:"createdAt" db:"created_at"`
+	AcceptedAt   *time.Time     `json:"acceptedAt" db:"accepted_at"`
+}
+
+type CoachingInvitationRequest struct {
+	Email string        `json:"email" binding:"required,email"`
+	Scope CoachingScope `json:"scope" binding:"required,oneof=read read_write"`
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ScanStatus tells whether the malware scan let a file through
+type ScanStatus string
+
+const (
+	// ScanStatusUnscanned files were stored while scanning was disabled, they are served
+	ScanStatusUnscanned ScanStatus = "unscanned"
+	// ScanStatusPending files wait in quarantine for the scanner
+	ScanStatusPending  ScanStatus = "pending"
+	ScanStatusClean    ScanStatus = "clean"
+	ScanStatusInfected ScanStatus = "infected"
+	// ScanStatusFailed files could not be scanned after several attempts, they are not served
+	ScanStatusFailed ScanStatus = "failed"
+)
+
+// File is an upload tracked for ownership and garbage collection. Objects maps
+// variant names, "original" included, to object keys.
+type File struct {
+	ID                uuid.UUID         `json:"id" db:"id"`
+	OwnerID           uuid.UUID         `json:"-" db:"owner_id"`
+	ContentType       string            `json:"contentType" db:"content_type"`
+	Size              int64             `json:"size" db:"size"`
+	Objects           map[string]string `json:"-" db:"objects"`
+	CreatedAt         time.Time         `json:"createdAt" db:"created_at"`
+	UnreferencedSince *time.Time        `json:"-" db:"unreferenced_since"`
+	ScanStatus        ScanStatus        `json:"scanStatus" db:"scan_status"`
+	ScanAttempts      int               `json:"-" db:"scan_attempts"`
+	ScannedAt         *time.Time        `json:"scannedAt,omitempty" db:"scanned_at"`
+}
+
+// UploadedImage holds the stable URL of a sanitized upload and of its resized
+// variants, keyed by variant name, to store as imageUri. Links are signed URLs
+// to show the images right away, they expire. Links stay empty until the
+// malware scan let the image through.
+type UploadedImage struct {
+	ID         uuid.UUID         `json:"id"`
+	URI        string            `json:"uri"`
+	Variants   map[string]string `json:"variants"`
+	Links      map[string]string `json:"links"`
+	ScanStatus ScanStatus        `json:"scanStatus"`
+}
+
+// PresignUploadRequest announces a file the client uploads straight to storage
+type PresignUploadRequest struct {
+	ContentType string `json:"contentType" binding:"required,oneof=image/jpeg image/png"`
+	Size        int64  `json:"size" binding:"required,min=1,max=10485760"`
+}
+
+// PresignedUpload tells the client where to POST the file. FormData fields go
+// in the multipart form before the file field.
+type PresignedUpload struct {
+	UploadID  string            `json:"uploadId"`
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	FormData  map[string]string `json:"formData"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// StorageQuota limits what one user keeps in storage, zero means no limit
+type StorageQuota struct {
+	MaxBytes int64
+	MaxFiles int64
+}
+
+// StorageUsage is what a user stores against their quota. Files waiting for
+// garbage collection count until they are removed.
+type StorageUsage struct {
+	UsedBytes int64  `json:"usedBytes"`
+	UsedFiles int64  `json:"usedFiles"`
+	MaxBytes  *int64 `json:"maxBytes"`
+	MaxFiles  *int64 `json:"maxFiles"`
+}
+
+// CreateUploadRequest starts a resumable upload of a workout import or video
+type CreateUploadRequest struct {
+	FileName    string `json:"fileName" binding:"required,max=255"`
+	ContentType string `json:"contentType" binding:"required,oneof=application/gpx+xml application/vnd.garmin.tcx+xml application/vnd.ant.fit video/mp4 video/quicktime"`
+	Size        int64  `json:"size" binding:"required,min=1"`
+}
+
+// UploadSession tells the client how to cut a resumable upload into chunks
+// and which chunks arrived, to resume after a disconnect. Chunks are numbered
+// from 0, all but the last are ChunkSize bytes.
+type UploadSession struct {
+	UploadID       uuid.UUID `json:"uploadId"`
+	FileName       string    `json:"fileName"`
+	ContentType    string    `json:"contentType"`
+	Size           int64     `json:"size"`
+	ChunkSize      int64     `json:"chunkSize"`
+	ChunkCount     int       `json:"chunkCount"`
+	ReceivedChunks []int     `json:"receivedChunks"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
+
+// StoredFile is a finished upload, its ID can be attached to an activity
+type StoredFile struct {
+	ID          uuid.UUID         `json:"id"`
+	URI         string            `json:"uri"`
+	ContentType string            `json:"contentType"`
+	Size        int64             `json:"size"`
+	ScanStatus  ScanStatus        `json:"scanStatus"`
+	Links       map[string]string `json:"links"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Follow is one side of a follow, the user followed or following. Friend
+// is set when the follow goes both ways.
+type Follow struct {
+	UserID    uuid.UUID `json:"userId" db:"user_id"`
+	Name      *string   `json:"name" db:"name"`
+	ImageUri  *string   `json:"imageUri" db:"image_uri"`
+	Friend    bool      `json:"friend" db:"friend"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+type FollowRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// FeedItem is an activity of a followed user with who did it
+type FeedItem struct {
+	Activity
+	AuthorName     *string `json:"authorName" db:"author_name"`
+	AuthorImageUri *string `json:"authorImageUri" db:"author_image_uri"`
+}
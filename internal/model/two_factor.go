@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UserTOTP struct {
+	UserID          uuid.UUID  `db:"user_id"`
+	SecretEncrypted string     `db:"secret_encrypted"`
+	EnabledAt       *time.Time `db:"enabled_at"`
+	LastUsedStep    int64      `db:"last_used_step"`
+	CreatedAt       time.Time  `db:"created_at"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorLoginRequest completes a login, code is a TOTP or a recovery code
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
@@ -6,19 +6,30 @@ import (
 	"github.com/google/uuid"
 )
 
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleCoach Role = "coach"
+	RoleAdmin Role = "admin"
+)
+
 type User struct {
-	ID         uuid.UUID `json:"id" db:"id"`
-	Name       *string   `json:"name" db:"name"`
-	Email      string    `json:"email" db:"email"`
-	Preference string    `json:"preference" db:"preference"`
-	WeightUnit string    `json:"weightUnit" db:"weightUnit"`
-	HeightUnit string    `json:"heightUnit" db:"heightUnit"`
-	Weight     int       `json:"weight" db:"weight"`
-	Height     int       `json:"height" db:"height"`
-	ImageUri   string    `json:"imageUri" db:"imageUri"`
-	Password   string    `json:"password" db:"password"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+	ID         uuid.UUID  `json:"id" db:"id"`
+	Name       *string    `json:"name" db:"name"`
+	Email      string     `json:"email" db:"email"`
+	Preference string     `json:"preference" db:"preference"`
+	WeightUnit string     `json:"weightUnit" db:"weightUnit"`
+	HeightUnit string     `json:"heightUnit" db:"heightUnit"`
+	Weight     int        `json:"weight" db:"weight"`
+	Height     int        `json:"height" db:"height"`
+	ImageUri   string     `json:"imageUri" db:"imageUri"`
+	Password   string     `json:"password" db:"password"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt  *time.Time `json:"-" db:"deleted_at"`
+	DisabledAt *time.Time `json:"-" db:"disabled_at"`
+	Role       Role       `json:"-" db:"role"`
 }
 
 type UserResponse struct {
@@ -34,10 +45,20 @@ type UserResponse struct {
 
 type UpdateUserRequest struct {
 	Name       *string  `json:"name"`
-	Preference *string  `json:"preference" validate:"required,oneof=CARDIO WEIGHT"`
-	WeightUnit *string  `json:"weightUnit" validate:"required,oneof=KG LBS"`
-	HeightUnit *string  `json:"heightUnit" validate:"required,oneof=CM INCH"`
-	Weight     *float64 `json:"weight" validate:"required,gte=10,lte=1000"`
-	Height     *float64 `json:"height" validate:"required,gte=3,lte=250"`
+	Preference *string  `json:"preference" binding:"required,oneof=CARDIO WEIGHT"`
+	WeightUnit *string  `json:"weightUnit" binding:"required,oneof=KG LBS"`
+	HeightUnit *string  `json:"heightUnit" binding:"required,oneof=CM INCH"`
+	Weight     *float64 `json:"weight" binding:"required,gte=10,lte=1000"`
+	Height     *float64 `json:"height" binding:"required,gte=3,lte=250"`
 	ImageUri   *string  `json:"imageUri"`
 }
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required,min=8,max=32"`
+}
+
+type RestoreAccountRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
@@ -0,0 +1,32 @@
+package oauth
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseBool(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want bool
+	}{
+		{"true", `true`, true},
+		{"false", `false`, false},
+		{"string true", `"true"`, true},
+		{"string false", `"false"`, false},
+		{"string one", `"1"`, true},
+		{"string garbage", `"yes"`, false},
+		{"number", `1`, false},
+		{"null", `null`, false},
+		{"missing", ``, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseBool(json.RawMessage(tt.raw)); got != tt.want {
+				t.Errorf("parseBool(%s) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Rule allows Limit requests per sliding Window
+type Rule struct {
+	Limit  int
+	Window time.Duration
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// ParseRule parses "<limit>/<window>", e.g. "10/1m". An empty string disables the rule.
+func ParseRule(s string) (Rule, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Rule{}, nil
+	}
+	limit, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid rate limit rule %q", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil || n < 0 {
+		return Rule{}, fmt.Errorf("invalid rate limit %q", s)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil || d <= 0 {
+		return Rule{}, fmt.Errorf("invalid rate limit window %q", s)
+	}
+	return Rule{Limit: n, Window: d}, nil
+}
+
+func (r Rule) Enabled() bool {
+	return r.Limit > 0 && r.Window > 0
+}
+
+// slidingWindow keeps one sorted-set member per request scored by its timestamp.
+// KEYS[1] key, ARGV: now(ms), window(ms), limit, member
+var slidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	return {1, limit - count - 1, 0}
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local retry = window
+if oldest[2] then
+	retry = tonumber(oldest[2]) + window - now
+end
+return {0, 0, retry}
+`)
+
+// Limiter is a Redis backed sliding window rate limiter shared by all app instances
+type Limiter struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewLimiter(client redis.UniversalClient) *Limiter {
+	return &Limiter{client: client, prefix: "ratelimit:"}
+}
+
+func (l *Limiter) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	now := time.Now().UnixMilli()
+	res, err := slidingWindow.Run(ctx, l.client, []string{l.prefix + key},
+		now, rule.Window.Milliseconds(), rule.Limit, strconv.FormatInt(now, 10)+"-"+uuid.NewString(),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("error evaluating rate limit for %s: %w", key, err)
+	}
+
+	return Result{
+		Allowed:    res[0] == 1,
+		Limit:      rule.Limit,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,40 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Rule
+		wantErr bool
+	}{
+		{"per minute", "10/1m", Rule{Limit: 10, Window: time.Minute}, false},
+		{"spaces", " 5 / 30s ", Rule{Limit: 5, Window: 30 * time.Second}, false},
+		{"empty disables", "", Rule{}, false},
+		{"zero disables", "0/1m", Rule{Window: time.Minute}, false},
+		{"no window", "10", Rule{}, true},
+		{"negative limit", "-1/1m", Rule{}, true},
+		{"bad limit", "ten/1m", Rule{}, true},
+		{"bad window", "10/minute", Rule{}, true},
+		{"zero window", "10/0s", Rule{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRule(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRule(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRule(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+			if got.Enabled() != (got.Limit > 0) {
+				t.Errorf("ParseRule(%q).Enabled() = %v", tt.raw, got.Enabled())
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/database"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// lastUsedResolution limits how often a busy token rewrites last_used_at
+const lastUsedResolution = time.Minute
+
+type AccessTokenRepository struct {
+	db       *sqlx.DB
+	timeouts database.Timeouts
+}
+
+func NewAccessTokenRepository(db *sqlx.DB, timeouts database.Timeouts) *AccessTokenRepository {
+	return &AccessTokenRepository{db: db, timeouts: timeouts}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAccessToken(row rowScanner, extra ...any) (model.PersonalAccessToken, error) {
+	var token model.PersonalAccessToken
+	var scopes []string
+	dest := append([]any{&token.ID, &token.UserID, &token.Name, &token.Prefix, pq.Array(&scopes),
+		&token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return model.PersonalAccessToken{}, err
+	}
+
+	token.Scopes = make([]model.TokenScope, 0, len(scopes))
+	for _, scope := range scopes {
+		token.Scopes = append(token.Scopes, model.TokenScope(scope))
+	}
+	return token, nil
+}
+
+func (r *AccessTokenRepository) Create(ctx context.Context, token *model.PersonalAccessToken, tokenHash string) error {
+	query := `INSERT INTO personal_access_tokens (id, user_id, name, token_hash, token_prefix, scopes, expires_at, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	scopes := make([]string, 0, len(token.Scopes))
+	for _, scope := range token.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "AccessTokenRepository.Create", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "AccessTokenRepository.Create", "INSERT")
+	_, err := r.db.ExecContext(ctx, query, token.ID, token.UserID, token.Name, tokenHash, token.Prefix, pq.Array(scopes), token.ExpiresAt, token.CreatedAt)
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+func (r *AccessTokenRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]model.PersonalAccessToken, error) {
+	query := `SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at
+	          FROM personal_access_tokens WHERE user_id = $1 ORDER BY created_at DESC`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "AccessTokenRepository.ListByUser", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "AccessTokenRepository.ListByUser", "SELECT")
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, database.ContextError(ctx, err)
+	}
+	defer rows.Close()
+
+	tokens := []model.PersonalAccessToken{}
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			tracing.End(span, err)
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	err = rows.Err()
+	tracing.End(span, err)
+	if err != nil {
+		return nil, database.ContextError(ctx, err)
+	}
+
+	return tokens, nil
+}
+
+// GetByHash finds a token whose owner may still sign in, together with the
+// owner's role
+func (r *AccessTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*model.PersonalAccessToken, error) {
+	query := `SELECT t.id, t.user_id, t.name, t.token_prefix, t.scopes, t.expires_at, t.last_used_at, t.created_at, u.role
+	          FROM personal_access_tokens t
+	          JOIN users u ON u.id = t.user_id
+	          WHERE t.token_hash = $1 AND u.deleted_at IS NULL AND u.disabled_at IS NULL`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "AccessTokenRepository.GetByHash", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "AccessTokenRepository.GetByHash", "SELECT")
+	var role model.Role
+	token, err := scanAccessToken(r.db.QueryRowContext(ctx, query, tokenHash), &role)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	token.Role = role
+	return &token, nil
+}
+
+// Touch records a use, skipping the write when the last one is recent
+func (r *AccessTokenRepository) Touch(ctx context.Context, id uuid.UUID, usedAt time.Time) error {
+	query := `UPDATE personal_access_tokens SET last_used_at = $1
+	          WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "AccessTokenRepository.Touch", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "AccessTokenRepository.Touch", "UPDATE")
+	_, err := r.db.ExecContext(ctx, query, usedAt, id, usedAt.Add(-lastUsedResolution))
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+func (r *AccessTokenRepository) Delete(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	query := `DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "AccessTokenRepository.Delete", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "AccessTokenRepository.Delete", "DELETE")
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	tracing.End(span, err)
+	if err != nil {
+		return false, database.ContextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
@@ -1,35 +1,49 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/insanjati/fitbyte/internal/database"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
 	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/tracing"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type ActivityRepository struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	timeouts database.Timeouts
 }
 
-func NewActivityRepository(db *sqlx.DB) *ActivityRepository {
-	return &ActivityRepository{db: db}
+func NewActivityRepository(db *sqlx.DB, timeouts database.Timeouts) *ActivityRepository {
+	return &ActivityRepository{db: db, timeouts: timeouts}
 }
 
-func (r *ActivityRepository) CheckExistedUserById(id uuid.UUID) (bool, error) {
+func (r *ActivityRepository) CheckExistedUserById(ctx context.Context, id uuid.UUID) (bool, error) {
 	query := `SELECT 1 FROM users WHERE id = $1`
 
 	var exists int
-	err := r.db.QueryRow(query, id).Scan(&exists)
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "ActivityRepository.CheckExistedUserById", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "ActivityRepository.CheckExistedUserById", "SELECT")
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&exists)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
 
-	// Log query, id, and result
-	fmt.Printf("CheckExistedUserById | Query: %s | ID: %s | Result: %d | Error: %v\n",
-		query, id.String(), exists, err)
+	logger.FromContext(ctx).Debug("check user exists", "user", id.String(), "found", exists == 1, "error", err)
 
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
@@ -37,23 +51,28 @@ func (r *ActivityRepository) CheckExistedUserById(id uuid.UUID) (bool, error) {
 	return true, nil
 }
 
-func (r *ActivityRepository) CheckActivityOwnership(userID uuid.UUID, activityID uuid.UUID) (*model.Activity, error) {
-	query := `SELECT * FROM activities WHERE id = $1 AND user_id = $2`
+func (r *ActivityRepository) CheckActivityOwnership(ctx context.Context, userID uuid.UUID, activityID uuid.UUID) (*model.Activity, error) {
+	query := `SELECT id, user_id, activity_type, done_at, duration_in_minutes, calories_burned, visibility, created_at, updated_at FROM activities WHERE id = $1 AND user_id = $2`
 
 	var activity model.Activity
-	err := r.db.QueryRow(query, activityID, userID).Scan(
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "ActivityRepository.CheckActivityOwnership", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "ActivityRepository.CheckActivityOwnership", "SELECT")
+	err := r.db.QueryRowContext(ctx, query, activityID, userID).Scan(
 		&activity.ID,
 		&activity.UserID,
 		&activity.ActivityType,
 		&activity.DoneAt,
 		&activity.DurationInMinutes,
 		&activity.CaloriesBurned,
+		&activity.Visibility,
 		&activity.CreatedAt,
 		&activity.UpdatedAt,
 	)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
 
-	// Log query
-	fmt.Printf("CheckActivityOwnership | Query: %s | userID: %s | activityID: %s\n", query, userID, activityID)
+	logger.FromContext(ctx).Debug("check activity ownership", "activity_id", activityID.String(), "error", err)
 
 	if err != nil {
 		return nil, err
@@ -62,28 +81,34 @@ func (r *ActivityRepository) CheckActivityOwnership(userID uuid.UUID, activityID
 	return &activity, nil
 }
 
-func (r *ActivityRepository) CreateActivity(activity *model.Activity) error {
+func (r *ActivityRepository) CreateActivity(ctx context.Context, activity *model.Activity) error {
 	query := `
-		INSERT INTO activities (id, user_id, activity_type, done_at, duration_in_minutes, calories_burned, created_at, updated_at)
-        VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		INSERT INTO activities (id, user_id, activity_type, done_at, duration_in_minutes, calories_burned, visibility, created_at, updated_at)
+        VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
 	`
 
-	_, err := r.db.Exec(query,
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "ActivityRepository.CreateActivity", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "ActivityRepository.CreateActivity", "INSERT")
+	_, err := r.db.ExecContext(ctx, query,
 		activity.ID,
 		activity.UserID,
 		activity.ActivityType,
 		activity.DoneAt,
 		activity.DurationInMinutes,
 		activity.CaloriesBurned,
+		activity.Visibility,
 		activity.CreatedAt,
 		activity.UpdatedAt,
 	)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
 	return err
 }
 
-func (r *ActivityRepository) GetUserActivities(userID uuid.UUID, filter *model.ActivityFilter) ([]model.Activity, error) {
+func (r *ActivityRepository) GetUserActivities(ctx context.Context, userID uuid.UUID, filter *model.ActivityFilter) ([]model.Activity, error) {
 	query := `
-		SELECT id, user_id, activity_type, done_at, duration_in_minutes, calories_burned, created_at, updated_at
+		SELECT id, user_id, activity_type, done_at, duration_in_minutes, calories_burned, visibility, created_at, updated_at
 		FROM activities 
 		WHERE user_id = $1
 	`
@@ -159,7 +184,12 @@ func (r *ActivityRepository) GetUserActivities(userID uuid.UUID, filter *model.A
 	args = append(args, limit, offset)
 
 	var activities []model.Activity
-	err := r.db.Select(&activities, query, args...)
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "ActivityRepository.GetUserActivities", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "ActivityRepository.GetUserActivities", "SELECT")
+	err := r.db.SelectContext(ctx, &activities, query, args...)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
 	if err != nil {
 		return nil, err
 	}
@@ -167,7 +197,7 @@ func (r *ActivityRepository) GetUserActivities(userID uuid.UUID, filter *model.A
 	return activities, nil
 }
 
-func (r *ActivityRepository) UpdateActivity(userID uuid.UUID, activityID uuid.UUID, updatedAt time.Time, req *model.UpdateActivityRequest, caloriesBurned int) (*model.Activity, error) {
+func (r *ActivityRepository) UpdateActivity(ctx context.Context, userID uuid.UUID, activityID uuid.UUID, updatedAt time.Time, req *model.UpdateActivityRequest, caloriesBurned int) (*model.Activity, error) {
 	query := `
 		UPDATE activities
 		SET updated_at = $1
@@ -196,6 +226,12 @@ func (r *ActivityRepository) UpdateActivity(userID uuid.UUID, activityID uuid.UU
 		argIndex++
 	}
 
+	if req.Visibility != nil {
+		fields = append(fields, fmt.Sprintf(" visibility = $%d", argIndex))
+		args = append(args, *req.Visibility)
+		argIndex++
+	}
+
 	fields = append(fields, fmt.Sprintf(" calories_burned = $%d", argIndex))
 	args = append(args, caloriesBurned)
 	argIndex++
@@ -212,14 +248,15 @@ func (r *ActivityRepository) UpdateActivity(userID uuid.UUID, activityID uuid.UU
 	}
 
 	// Add WHERE clause
-	query += fmt.Sprintf(" WHERE user_id = $%d AND id = $%d RETURNING id, user_id, activity_type, done_at, duration_in_minutes, calories_burned, created_at, updated_at", argIndex, argIndex+1)
-	// Log query
-	fmt.Printf("UpdateActivity | Query: %s | userID: %s | activityID: %s\n", query, userID, activityID)
+	query += fmt.Sprintf(" WHERE user_id = $%d AND id = $%d RETURNING id, user_id, activity_type, done_at, duration_in_minutes, calories_burned, visibility, created_at, updated_at", argIndex, argIndex+1)
+	logger.FromContext(ctx).Debug("update activity", "activity_id", activityID.String(), "fields", len(fields))
 	args = append(args, userID, activityID)
 
-	// ini nanti ganti QueryRowContext (Get ni sama ndak kek QueryRow?)
 	var activity model.Activity
-	row := r.db.QueryRow(query, args...)
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "ActivityRepository.UpdateActivity", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "ActivityRepository.UpdateActivity", "UPDATE")
+	row := r.db.QueryRowContext(ctx, query, args...)
 	err := row.Scan(
 		&activity.ID,
 		&activity.UserID,
@@ -227,9 +264,12 @@ func (r *ActivityRepository) UpdateActivity(userID uuid.UUID, activityID uuid.UU
 		&activity.DoneAt,
 		&activity.DurationInMinutes,
 		&activity.CaloriesBurned,
+		&activity.Visibility,
 		&activity.CreatedAt,
 		&activity.UpdatedAt,
 	)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
 
 	if err != nil {
 		return nil, err
@@ -238,25 +278,116 @@ func (r *ActivityRepository) UpdateActivity(userID uuid.UUID, activityID uuid.UU
 	return &activity, nil
 }
 
-func (r *ActivityRepository) DeleteActivity(activityID uuid.UUID, userID uuid.UUID) error {
-	query := `
-		DELETE FROM activities 
-		WHERE id = $1 AND user_id = $2
-	`
+// activityAttachmentReference is the file_references entity type of
+// attachments, service.FileReferenceActivityAttachment
+const activityAttachmentReference = "activity_attachment"
+
+// DeleteActivity returns the deleted row so the change can be audited. The
+// attachments go with it through ON DELETE CASCADE and their files are
+// released in the same transaction. The activity is locked first, so an
+// attachment added meanwhile either waits and fails or is released too.
+func (r *ActivityRepository) DeleteActivity(ctx context.Context, activityID uuid.UUID, userID uuid.UUID) (*model.Activity, error) {
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "ActivityRepository.DeleteActivity", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "ActivityRepository.DeleteActivity", "DELETE")
 
-	result, err := r.db.Exec(query, activityID, userID)
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, database.ContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	var activity model.Activity
+	err = tx.GetContext(ctx, &activity,
+		`SELECT id, user_id, activity_type, done_at, duration_in_minutes, calories_burned, visibility, created_at, updated_at
+		 FROM activities WHERE id = $1 AND user_id = $2 FOR UPDATE`,
+		activityID, userID)
+
+	var released []uuid.UUID
+	if err == nil {
+		err = tx.SelectContext(ctx, &released,
+			`DELETE FROM file_references
+			 WHERE entity_type = $1 AND entity_id IN (SELECT id::text FROM activity_attachments WHERE activity_id = $2)
+			 RETURNING file_id`,
+			activityAttachmentReference, activityID)
+	}
+	if err == nil && len(released) > 0 {
+		_, err = tx.ExecContext(ctx,
+			`UPDATE files SET unreferenced_since = $1
+			 WHERE id = ANY($2::uuid[]) AND unreferenced_since IS NULL
+			 AND NOT EXISTS (SELECT 1 FROM file_references WHERE file_id = files.id)`,
+			time.Now(), pq.Array(released))
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM activities WHERE id = $1`, activityID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, appErrors.ErrActivityNotFound
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return &activity, nil
+}
+
+// GetActivityIDsByUser lists every activity ID of a user, used to evict caches
+func (r *ActivityRepository) GetActivityIDsByUser(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	query := `SELECT id FROM activities WHERE user_id = $1`
+
+	var ids []uuid.UUID
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "ActivityRepository.GetActivityIDsByUser", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "ActivityRepository.GetActivityIDsByUser", "SELECT")
+	err := r.db.SelectContext(ctx, &ids, query, userID)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if rowsAffected == 0 {
-		return errors.New("activity not found")
+	return ids, nil
+}
+
+// GetFeed lists the activities userID may see of the users they follow,
+// newest first. Each followee only contributes its latest limit+offset
+// visible activities through idx_activities_user_done_at, so the cost grows
+// with the number of followees and the page, not with their history.
+func (r *ActivityRepository) GetFeed(ctx context.Context, userID uuid.UUID, limit, offset int) ([]model.FeedItem, error) {
+	query := `
+		SELECT a.id, a.user_id, a.activity_type, a.done_at, a.duration_in_minutes, a.calories_burned, a.visibility,
+		       a.created_at, a.updated_at, u.name AS author_name, u.imageUri AS author_image_uri
+		FROM follows f
+		JOIN users u ON u.id = f.followee_id AND u.deleted_at IS NULL AND u.disabled_at IS NULL
+		LEFT JOIN follows back ON back.follower_id = f.followee_id AND back.followee_id = f.follower_id
+		CROSS JOIN LATERAL (
+			SELECT * FROM activities
+			WHERE user_id = f.followee_id
+			  AND (visibility = 'public' OR (visibility = 'friends' AND back.follower_id IS NOT NULL))
+			ORDER BY done_at DESC, id DESC
+			LIMIT $2
+		) a
+		WHERE f.follower_id = $1
+		ORDER BY a.done_at DESC, a.id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	items := []model.FeedItem{}
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "ActivityRepository.GetFeed", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "ActivityRepository.GetFeed", "SELECT")
+	err := r.db.SelectContext(ctx, &items, query, userID, limit+offset, limit, offset)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return items, nil
 }
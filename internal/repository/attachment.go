@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/database"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type AttachmentRepository struct {
+	db       *sqlx.DB
+	timeouts database.Timeouts
+}
+
+func NewAttachmentRepository(db *sqlx.DB, timeouts database.Timeouts) *AttachmentRepository {
+	return &AttachmentRepository{db: db, timeouts: timeouts}
+}
+
+func (r *AttachmentRepository) Create(ctx context.Context, attachment *model.ActivityAttachment) error {
+	query := `INSERT INTO activity_attachments (id, activity_id, file_id, name, created_at) VALUES ($1, $2, $3, $4, $5)`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "AttachmentRepository.Create", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "AttachmentRepository.Create", "INSERT")
+	_, err := r.db.ExecContext(ctx, query, attachment.ID, attachment.ActivityID, attachment.FileID, attachment.Name, attachment.CreatedAt)
+	tracing.End(span, err)
+
+	// The activity was deleted meanwhile
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return appErrors.ErrActivityNotFound.Wrap(err)
+	}
+	return database.ContextError(ctx, err)
+}
+
+func (r *AttachmentRepository) CountByActivity(ctx context.Context, activityID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM activity_attachments WHERE activity_id = $1`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "AttachmentRepository.CountByActivity", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "AttachmentRepository.CountByActivity", "SELECT")
+	var count int
+	err := r.db.GetContext(ctx, &count, query, activityID)
+	tracing.End(span, err)
+
+	return count, database.ContextError(ctx, err)
+}
+
+// ListByActivities returns the attachments of every activity in one query,
+// oldest first, with the objects of their files
+func (r *AttachmentRepository) ListByActivities(ctx context.Context, activityIDs []uuid.UUID) ([]model.ActivityAttachment, error) {
+	if len(activityIDs) == 0 {
+		return []model.ActivityAttachment{}, nil
+	}
+
+	query := `SELECT a.id, a.activity_id, a.file_id, a.name, f.content_type, f.size, a.created_at, f.scan_status, f.objects
+	          FROM activity_attachments a JOIN files f ON f.id = a.file_id
+	          WHERE a.activity_id = ANY($1::uuid[]) ORDER BY a.created_at, a.id`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "AttachmentRepository.ListByActivities", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "AttachmentRepository.ListByActivities", "SELECT")
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(activityIDs))
+	if err != nil {
+		tracing.End(span, err)
+		return nil, database.ContextError(ctx, err)
+	}
+	defer rows.Close()
+
+	attachments := []model.ActivityAttachment{}
+	for rows.Next() {
+		var attachment model.ActivityAttachment
+		var objects []byte
+		err := rows.Scan(&attachment.ID, &attachment.ActivityID, &attachment.FileID, &attachment.Name,
+			&attachment.ContentType, &attachment.Size, &attachment.CreatedAt, &attachment.ScanStatus, &objects)
+		if err == nil {
+			err = json.Unmarshal(objects, &attachment.Objects)
+		}
+		if err != nil {
+			tracing.End(span, err)
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	err = rows.Err()
+	tracing.End(span, err)
+
+	return attachments, database.ContextError(ctx, err)
+}
+
+// Delete reports false when the attachment does not belong to the activity
+func (r *AttachmentRepository) Delete(ctx context.Context, id, activityID uuid.UUID) (bool, error) {
+	query := `DELETE FROM activity_attachments WHERE id = $1 AND activity_id = $2`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "AttachmentRepository.Delete", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "AttachmentRepository.Delete", "DELETE")
+	result, err := r.db.ExecContext(ctx, query, id, activityID)
+	tracing.End(span, err)
+	if err != nil {
+		return false, database.ContextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
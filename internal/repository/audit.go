@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/insanjati/fitbyte/internal/database"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"github.com/jmoiron/sqlx"
+)
+
+// AuditRepository only inserts and reads, entries are never updated or deleted
+type AuditRepository struct {
+	db       *sqlx.DB
+	timeouts database.Timeouts
+}
+
+func NewAuditRepository(db *sqlx.DB, timeouts database.Timeouts) *AuditRepository {
+	return &AuditRepository{db: db, timeouts: timeouts}
+}
+
+func (r *AuditRepository) CreateEntry(ctx context.Context, entry *model.AuditEntry) error {
+	query := `INSERT INTO audit_log (id, actor_id, subject_id, action, entity_type, entity_id, before_data, after_data, metadata, ip_address, user_agent, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "AuditRepository.CreateEntry", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "AuditRepository.CreateEntry", "INSERT")
+	_, err := r.db.ExecContext(ctx, query, entry.ID, entry.ActorID, entry.SubjectID, entry.Action, entry.EntityType, entry.EntityID,
+		entry.Before, entry.After, entry.Metadata, entry.IPAddress, entry.UserAgent, entry.CreatedAt)
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+func (r *AuditRepository) ListEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	query := `SELECT id, actor_id, subject_id, action, entity_type, entity_id, before_data, after_data, metadata, ip_address, user_agent, created_at
+	          FROM audit_log WHERE 1=1`
+
+	args := []interface{}{}
+	argIndex := 1
+
+	if filter.ActorID != nil {
+		query += fmt.Sprintf(" AND actor_id = $%d", argIndex)
+		args = append(args, *filter.ActorID)
+		argIndex++
+	}
+	if filter.SubjectID != nil {
+		query += fmt.Sprintf(" AND subject_id = $%d", argIndex)
+		args = append(args, *filter.SubjectID)
+		argIndex++
+	}
+	if filter.Action != "" {
+		query += fmt.Sprintf(" AND action = $%d", argIndex)
+		args = append(args, filter.Action)
+		argIndex++
+	}
+	if filter.EntityType != "" {
+		query += fmt.Sprintf(" AND entity_type = $%d", argIndex)
+		args = append(args, filter.EntityType)
+		argIndex++
+	}
+
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, filter.Limit, filter.Offset)
+
+	entries := []model.AuditEntry{}
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "AuditRepository.ListEntries", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "AuditRepository.ListEntries", "SELECT")
+	err := r.db.SelectContext(ctx, &entries, query, args...)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/database"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const coachingSelect = `SELECT r.id, r.coach_id, c.email AS coach_email, r.trainee_id, t.email AS trainee_email,
+	       r.scope, r.status, r.created_at, r.accepted_at
+	FROM coaching_relationships r
+	JOIN users c ON c.id = r.coach_id
+	JOIN users t ON t.id = r.trainee_id`
+
+type CoachingRepository struct {
+	db       *sqlx.DB
+	timeouts database.Timeouts
+}
+
+func NewCoachingRepository(db *sqlx.DB, timeouts database.Timeouts) *CoachingRepository {
+	return &CoachingRepository{db: db, timeouts: timeouts}
+}
+
+func (r *CoachingRepository) CreateInvitation(ctx context.Context, rel *model.CoachingRelationship) error {
+	query := `INSERT INTO coaching_relationships (id, coach_id, trainee_id, scope, status, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6)`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "CoachingRepository.CreateInvitation", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "CoachingRepository.CreateInvitation", "INSERT")
+	_, err := r.db.ExecContext(ctx, query, rel.ID, rel.CoachID, rel.TraineeID, rel.Scope, rel.Status, rel.CreatedAt)
+	tracing.End(span, err)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return appErrors.ErrCoachingExists.Wrap(err)
+	}
+	return database.ContextError(ctx, err)
+}
+
+func (r *CoachingRepository) GetRelationship(ctx context.Context, id uuid.UUID) (*model.CoachingRelationship, error) {
+	query := coachingSelect + ` WHERE r.id = $1`
+
+	var rel model.CoachingRelationship
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "CoachingRepository.GetRelationship", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "CoachingRepository.GetRelationship", "SELECT")
+	err := r.db.GetContext(ctx, &rel, query, id)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &rel, nil
+}
+
+// ListForUser returns relationships where the user is coach or trainee
+func (r *CoachingRepository) ListForUser(ctx context.Context, userID uuid.UUID) ([]model.CoachingRelationship, error) {
+	query := coachingSelect + ` WHERE r.coach_id = $1 OR r.trainee_id = $1 ORDER BY r.created_at DESC`
+
+	rels := []model.CoachingRelationship{}
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "CoachingRepository.ListForUser", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "CoachingRepository.ListForUser", "SELECT")
+	err := r.db.SelectContext(ctx, &rels, query, userID)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return rels, nil
+}
+
+// Accept activates a pending invitation addressed to traineeID
+func (r *CoachingRepository) Accept(ctx context.Context, id, traineeID uuid.UUID, acceptedAt time.Time) (bool, error) {
+	query := `UPDATE coaching_relationships SET status = 'active', accepted_at = $1
+	          WHERE id = $2 AND trainee_id = $3 AND status = 'pending'`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "CoachingRepository.Accept", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "CoachingRepository.Accept", "UPDATE")
+	result, err := r.db.ExecContext(ctx, query, acceptedAt, id, traineeID)
+	tracing.End(span, err)
+	if err != nil {
+		return false, database.ContextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// Delete removes a relationship either side belongs to, used to decline,
+// withdraw and end
+func (r *CoachingRepository) Delete(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	query := `DELETE FROM coaching_relationships WHERE id = $1 AND (coach_id = $2 OR trainee_id = $2)`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "CoachingRepository.Delete", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "CoachingRepository.Delete", "DELETE")
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	tracing.End(span, err)
+	if err != nil {
+		return false, database.ContextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// GetActiveScope returns sql.ErrNoRows when coachID does not coach traineeID
+func (r *CoachingRepository) GetActiveScope(ctx context.Context, coachID, traineeID uuid.UUID) (model.CoachingScope, error) {
+	query := `SELECT scope FROM coaching_relationships WHERE coach_id = $1 AND trainee_id = $2 AND status = 'active'`
+
+	var scope model.CoachingScope
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "CoachingRepository.GetActiveScope", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "CoachingRepository.GetActiveScope", "SELECT")
+	err := r.db.QueryRowContext(ctx, query, coachID, traineeID).Scan(&scope)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+
+	if err != nil {
+		return "", err
+	}
+
+	return scope, nil
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// openTestDB connects to the migrated database in TEST_DATABASE_URL, tests
+// that need Postgres are skipped without it
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sqlx.Connect("postgres", url)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createTestUser inserts a user removed again, with everything referencing
+// it, when the test ends
+func createTestUser(t *testing.T, db *sqlx.DB) uuid.UUID {
+	t.Helper()
+
+	id := uuid.New()
+	_, err := db.Exec(`INSERT INTO users (id, email, password) VALUES ($1, $2, 'x')`, id, id.String()+"@example.com")
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.ExecContext(context.Background(), `DELETE FROM users WHERE id = $1`, id); err != nil {
+			t.Errorf("failed to remove test user: %v", err)
+		}
+	})
+	return id
+}
@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/database"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const fileColumns = `id, owner_id, content_type, size, objects, created_at, unreferenced_since, scan_status, scan_attempts, scanned_at`
+
+type FileRepository struct {
+	db       *sqlx.DB
+	timeouts database.Timeouts
+}
+
+func NewFileRepository(db *sqlx.DB, timeouts database.Timeouts) *FileRepository {
+	return &FileRepository{db: db, timeouts: timeouts}
+}
+
+func scanFile(row rowScanner) (model.File, error) {
+	var file model.File
+	var objects []byte
+	if err := row.Scan(&file.ID, &file.OwnerID, &file.ContentType, &file.Size, &objects, &file.CreatedAt, &file.UnreferencedSince,
+		&file.ScanStatus, &file.ScanAttempts, &file.ScannedAt); err != nil {
+		return model.File{}, err
+	}
+	if err := json.Unmarshal(objects, &file.Objects); err != nil {
+		return model.File{}, err
+	}
+	return file, nil
+}
+
+// CreateWithinQuota stores a new upload unless it takes its owner over the
+// quota of their role, it reports whether the row was created. Uploads of one
+// owner are serialized on their user row so concurrent uploads cannot both
+// slip under the limit. A new upload counts as unreferenced from its creation.
+func (r *FileRepository) CreateWithinQuota(ctx context.Context, file *model.File, quotas map[model.Role]model.StorageQuota) (bool, error) {
+	objects, err := json.Marshal(file.Objects)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "FileRepository.CreateWithinQuota", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "FileRepository.CreateWithinQuota", "INSERT")
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		tracing.End(span, err)
+		return false, database.ContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	var role model.Role
+	var usedBytes, usedFiles int64
+	err = tx.QueryRowContext(ctx, `SELECT role FROM users WHERE id = $1 FOR NO KEY UPDATE`, file.OwnerID).Scan(&role)
+	if err == nil {
+		err = tx.QueryRowContext(ctx, `SELECT COALESCE(SUM(size), 0)::BIGINT, COUNT(*) FROM files WHERE owner_id = $1`, file.OwnerID).Scan(&usedBytes, &usedFiles)
+	}
+	if err != nil {
+		tracing.End(span, err)
+		return false, database.ContextError(ctx, err)
+	}
+
+	quota := quotas[role]
+	if quota.MaxBytes > 0 && usedBytes+file.Size > quota.MaxBytes || quota.MaxFiles > 0 && usedFiles+1 > quota.MaxFiles {
+		tracing.End(span, nil)
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO files (id, owner_id, content_type, size, objects, created_at, unreferenced_since, scan_status)
+		 VALUES ($1, $2, $3, $4, $5, $6, $6, $7)`,
+		file.ID, file.OwnerID, file.ContentType, file.Size, objects, file.CreatedAt, file.ScanStatus)
+	if err == nil {
+		err = tx.Commit()
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return false, database.ContextError(ctx, err)
+	}
+	return true, nil
+}
+
+// Usage sums the size and number of files ownerID stores
+func (r *FileRepository) Usage(ctx context.Context, ownerID uuid.UUID) (int64, int64, error) {
+	query := `SELECT COALESCE(SUM(size), 0)::BIGINT, COUNT(*) FROM files WHERE owner_id = $1`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "FileRepository.Usage", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "FileRepository.Usage", "SELECT")
+	var bytes, files int64
+	err := r.db.QueryRowContext(ctx, query, ownerID).Scan(&bytes, &files)
+	tracing.End(span, err)
+
+	return bytes, files, database.ContextError(ctx, err)
+}
+
+func (r *FileRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.File, error) {
+	query := `SELECT ` + fileColumns + ` FROM files WHERE id = $1`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "FileRepository.GetByID", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "FileRepository.GetByID", "SELECT")
+	file, err := scanFile(r.db.QueryRowContext(ctx, query, id))
+	tracing.End(span, err)
+	if err != nil {
+		return nil, database.ContextError(ctx, err)
+	}
+	return &file, nil
+}
+
+// SetReference points the entity at fileID, or at nothing when fileID is nil.
+// A file the entity used before is marked unreferenced once nothing else uses it.
+func (r *FileRepository) SetReference(ctx context.Context, entityType, entityID string, fileID *uuid.UUID, at time.Time) error {
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "FileRepository.SetReference", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "FileRepository.SetReference", "UPDATE")
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		tracing.End(span, err)
+		return database.ContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	var released []uuid.UUID
+	err = tx.SelectContext(ctx, &released,
+		`DELETE FROM file_references WHERE entity_type = $1 AND entity_id = $2 RETURNING file_id`,
+		entityType, entityID)
+	if err == nil && fileID != nil {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO file_references (file_id, entity_type, entity_id, created_at) VALUES ($1, $2, $3, $4)`,
+			*fileID, entityType, entityID, at)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `UPDATE files SET unreferenced_since = NULL WHERE id = $1`, *fileID)
+		}
+	}
+	if err == nil && len(released) > 0 {
+		_, err = tx.ExecContext(ctx,
+			`UPDATE files SET unreferenced_since = $1
+			 WHERE id = ANY($2::uuid[]) AND unreferenced_since IS NULL
+			 AND NOT EXISTS (SELECT 1 FROM file_references WHERE file_id = files.id)`,
+			at, pq.Array(released))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+// ClaimPendingScans hands up to limit files waiting for their malware scan to
+// one worker. A claim older than staleBefore is taken over, the worker holding
+// it failed or crashed. Claimed files count one more attempt.
+func (r *FileRepository) ClaimPendingScans(ctx context.Context, now, staleBefore time.Time, limit int) ([]model.File, error) {
+	query := `UPDATE files SET scan_started_at = $1, scan_attempts = scan_attempts + 1
+	          WHERE id IN (
+	              SELECT id FROM files
+	              WHERE scan_status = 'pending' AND (scan_started_at IS NULL OR scan_started_at < $2)
+	              ORDER BY created_at LIMIT $3
+	              FOR UPDATE SKIP LOCKED
+	          )
+	          RETURNING ` + fileColumns
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "FileRepository.ClaimPendingScans", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "FileRepository.ClaimPendingScans", "UPDATE")
+	rows, err := r.db.QueryContext(ctx, query, now, staleBefore, limit)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, database.ContextError(ctx, err)
+	}
+	defer rows.Close()
+
+	files := []model.File{}
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			tracing.End(span, err)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	err = rows.Err()
+	tracing.End(span, err)
+
+	return files, database.ContextError(ctx, err)
+}
+
+// FinishScan records the outcome of the malware scan of a file
+func (r *FileRepository) FinishScan(ctx context.Context, id uuid.UUID, status model.ScanStatus, signature string, at time.Time) error {
+	query := `UPDATE files SET scan_status = $2, scan_signature = NULLIF($3, ''), scanned_at = $4, scan_started_at = NULL
+	          WHERE id = $1`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "FileRepository.FinishScan", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "FileRepository.FinishScan", "UPDATE")
+	_, err := r.db.ExecContext(ctx, query, id, status, signature, at)
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+// ListUnreferencedBefore returns files nothing referenced since before cutoff
+func (r *FileRepository) ListUnreferencedBefore(ctx context.Context, cutoff time.Time, limit int) ([]model.File, error) {
+	query := `SELECT ` + fileColumns + ` FROM files
+	          WHERE unreferenced_since < $1 ORDER BY unreferenced_since LIMIT $2`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "FileRepository.ListUnreferencedBefore", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "FileRepository.ListUnreferencedBefore", "SELECT")
+	rows, err := r.db.QueryContext(ctx, query, cutoff, limit)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, database.ContextError(ctx, err)
+	}
+	defer rows.Close()
+
+	files := []model.File{}
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			tracing.End(span, err)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	err = rows.Err()
+	tracing.End(span, err)
+
+	return files, database.ContextError(ctx, err)
+}
+
+// DeleteUnreferenced removes the row unless a reference was added meanwhile,
+// it reports whether the row was removed
+func (r *FileRepository) DeleteUnreferenced(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `DELETE FROM files WHERE id = $1 AND unreferenced_since IS NOT NULL
+	          AND NOT EXISTS (SELECT 1 FROM file_references WHERE file_id = files.id)`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "FileRepository.DeleteUnreferenced", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "FileRepository.DeleteUnreferenced", "DELETE")
+	result, err := r.db.ExecContext(ctx, query, id)
+	tracing.End(span, err)
+	if err != nil {
+		return false, database.ContextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/database"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"github.com/jmoiron/sqlx"
+)
+
+// followSelect is completed with a join on users u, the other side of the
+// follow being listed
+const followSelect = `SELECT u.id AS user_id, u.name, u.imageUri AS image_uri, f.created_at,
+	       EXISTS (SELECT 1 FROM follows b WHERE b.follower_id = f.followee_id AND b.followee_id = f.follower_id) AS friend
+	FROM follows f`
+
+type FollowRepository struct {
+	db       *sqlx.DB
+	timeouts database.Timeouts
+}
+
+func NewFollowRepository(db *sqlx.DB, timeouts database.Timeouts) *FollowRepository {
+	return &FollowRepository{db: db, timeouts: timeouts}
+}
+
+// Create makes followerID follow followeeID, following again keeps the
+// original date
+func (r *FollowRepository) Create(ctx context.Context, followerID, followeeID uuid.UUID, createdAt time.Time) error {
+	query := `INSERT INTO follows (follower_id, followee_id, created_at) VALUES ($1, $2, $3)
+	          ON CONFLICT (follower_id, followee_id) DO NOTHING`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "FollowRepository.Create", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "FollowRepository.Create", "INSERT")
+	_, err := r.db.ExecContext(ctx, query, followerID, followeeID, createdAt)
+	tracing.End(span, err)
+	return database.ContextError(ctx, err)
+}
+
+func (r *FollowRepository) Delete(ctx context.Context, followerID, followeeID uuid.UUID) (bool, error) {
+	query := `DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "FollowRepository.Delete", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "FollowRepository.Delete", "DELETE")
+	result, err := r.db.ExecContext(ctx, query, followerID, followeeID)
+	tracing.End(span, err)
+	if err != nil {
+		return false, database.ContextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// Get returns the follow of followerID on followeeID as the follower lists it
+func (r *FollowRepository) Get(ctx context.Context, followerID, followeeID uuid.UUID) (*model.Follow, error) {
+	query := followSelect + ` JOIN users u ON u.id = f.followee_id
+	          WHERE f.follower_id = $1 AND f.followee_id = $2`
+
+	var follow model.Follow
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "FollowRepository.Get", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "FollowRepository.Get", "SELECT")
+	err := r.db.GetContext(ctx, &follow, query, followerID, followeeID)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &follow, nil
+}
+
+// ListFollowing returns the users userID follows, newest first
+func (r *FollowRepository) ListFollowing(ctx context.Context, userID uuid.UUID, limit, offset int) ([]model.Follow, error) {
+	query := followSelect + ` JOIN users u ON u.id = f.followee_id AND u.deleted_at IS NULL AND u.disabled_at IS NULL
+	          WHERE f.follower_id = $1
+	          ORDER BY f.created_at DESC
+	          LIMIT $2 OFFSET $3`
+
+	return r.list(ctx, "FollowRepository.ListFollowing", query, userID, limit, offset)
+}
+
+// ListFollowers returns the users following userID, newest first
+func (r *FollowRepository) ListFollowers(ctx context.Context, userID uuid.UUID, limit, offset int) ([]model.Follow, error) {
+	query := followSelect + ` JOIN users u ON u.id = f.follower_id AND u.deleted_at IS NULL AND u.disabled_at IS NULL
+	          WHERE f.followee_id = $1
+	          ORDER BY f.created_at DESC
+	          LIMIT $2 OFFSET $3`
+
+	return r.list(ctx, "FollowRepository.ListFollowers", query, userID, limit, offset)
+}
+
+func (r *FollowRepository) list(ctx context.Context, name, query string, userID uuid.UUID, limit, offset int) ([]model.Follow, error) {
+	follows := []model.Follow{}
+	ctx, cancel := r.timeouts.WithTimeout(ctx, name, database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, name, "SELECT")
+	err := r.db.SelectContext(ctx, &follows, query, userID, limit, offset)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return follows, nil
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/database"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"github.com/jmoiron/sqlx"
+)
+
+type TwoFactorRepository struct {
+	db       *sqlx.DB
+	timeouts database.Timeouts
+}
+
+func NewTwoFactorRepository(db *sqlx.DB, timeouts database.Timeouts) *TwoFactorRepository {
+	return &TwoFactorRepository{db: db, timeouts: timeouts}
+}
+
+func (r *TwoFactorRepository) GetTOTP(ctx context.Context, userID uuid.UUID) (*model.UserTOTP, error) {
+	query := `SELECT user_id, secret_encrypted, enabled_at, last_used_step, created_at FROM user_totp WHERE user_id = $1`
+
+	var totp model.UserTOTP
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "TwoFactorRepository.GetTOTP", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "TwoFactorRepository.GetTOTP", "SELECT")
+	err := r.db.GetContext(ctx, &totp, query, userID)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &totp, nil
+}
+
+// SavePendingTOTP stores a new secret that is not enabled yet, replacing an
+// earlier unfinished enrollment
+func (r *TwoFactorRepository) SavePendingTOTP(ctx context.Context, userID uuid.UUID, secretEncrypted string) error {
+	query := `INSERT INTO user_totp (user_id, secret_encrypted, created_at) VALUES ($1, $2, $3)
+	          ON CONFLICT (user_id) DO UPDATE SET secret_encrypted = EXCLUDED.secret_encrypted, last_used_step = 0, created_at = EXCLUDED.created_at
+	          WHERE user_totp.enabled_at IS NULL`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "TwoFactorRepository.SavePendingTOTP", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "TwoFactorRepository.SavePendingTOTP", "INSERT")
+	_, err := r.db.ExecContext(ctx, query, userID, secretEncrypted, time.Now())
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+// UseStep records step as the last accepted one, it reports false when an
+// equal or later step was already used
+func (r *TwoFactorRepository) UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	query := `UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "TwoFactorRepository.UseStep", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "TwoFactorRepository.UseStep", "UPDATE")
+	result, err := r.db.ExecContext(ctx, query, step, userID)
+	tracing.End(span, err)
+	if err != nil {
+		return false, database.ContextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// EnableTOTP turns 2FA on and replaces the recovery codes in one transaction
+func (r *TwoFactorRepository) EnableTOTP(ctx context.Context, userID uuid.UUID, enabledAt time.Time, codeHashes []string) error {
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "TwoFactorRepository.EnableTOTP", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "TwoFactorRepository.EnableTOTP", "UPDATE")
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		tracing.End(span, err)
+		return database.ContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE user_totp SET enabled_at = $1 WHERE user_id = $2`, enabledAt, userID)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID)
+	}
+	for _, hash := range codeHashes {
+		if err != nil {
+			break
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO user_recovery_codes (id, user_id, code_hash, created_at) VALUES ($1, $2, $3, $4)`,
+			uuid.New(), userID, hash, enabledAt)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+// DisableTOTP removes the secret and every recovery code
+func (r *TwoFactorRepository) DisableTOTP(ctx context.Context, userID uuid.UUID) error {
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "TwoFactorRepository.DisableTOTP", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "TwoFactorRepository.DisableTOTP", "DELETE")
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		tracing.End(span, err)
+		return database.ContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+// UseRecoveryCode burns an unused recovery code, it reports false when none matched
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, usedAt time.Time) (bool, error) {
+	query := `UPDATE user_recovery_codes SET used_at = $1
+	          WHERE id = (SELECT id FROM user_recovery_codes WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL LIMIT 1)
+	          AND used_at IS NULL`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "TwoFactorRepository.UseRecoveryCode", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "TwoFactorRepository.UseRecoveryCode", "UPDATE")
+	result, err := r.db.ExecContext(ctx, query, usedAt, userID, codeHash)
+	tracing.End(span, err)
+	if err != nil {
+		return false, database.ContextError(ctx, err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
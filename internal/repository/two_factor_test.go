@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/database"
+)
+
+func TestUseStep(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewTwoFactorRepository(db, database.Timeouts{})
+	ctx := context.Background()
+
+	userID := createTestUser(t, db)
+	if _, err := db.Exec(`INSERT INTO user_totp (user_id, secret_encrypted, enabled_at) VALUES ($1, 'x', NOW())`, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Runs in order, each use sees the steps accepted before it
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		step   int64
+		want   bool
+	}{
+		{"first use", userID, 100, true},
+		{"replay", userID, 100, false},
+		{"earlier step", userID, 99, false},
+		{"next step", userID, 101, true},
+		{"skipped ahead", userID, 105, true},
+		{"replay after skip", userID, 101, false},
+		{"not enrolled", uuid.New(), 200, false},
+	}
+
+	for _, tt := range tests {
+		fresh, err := repo.UseStep(ctx, tt.userID, tt.step)
+		if err != nil {
+			t.Fatalf("%s: UseStep() error = %v", tt.name, err)
+		}
+		if fresh != tt.want {
+			t.Errorf("%s: UseStep(%d) = %v, want %v", tt.name, tt.step, fresh, tt.want)
+		}
+	}
+}
+
+// The same code sent twice at once must still be accepted only once
+func TestUseStepConcurrent(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewTwoFactorRepository(db, database.Timeouts{})
+
+	userID := createTestUser(t, db)
+	if _, err := db.Exec(`INSERT INTO user_totp (user_id, secret_encrypted, enabled_at) VALUES ($1, 'x', NOW())`, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	const attempts = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fresh, err := repo.UseStep(context.Background(), userID, 100)
+			if err != nil {
+				t.Errorf("UseStep() error = %v", err)
+				return
+			}
+			if fresh {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted != 1 {
+		t.Errorf("step accepted %d times, want once", accepted)
+	}
+}
@@ -2,27 +2,43 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/database"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
 	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/tracing"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+// Postgres error code raised when the users.email unique constraint is hit
+const uniqueViolation = "23505"
+
+// Postgres error code raised when a referenced row does not exist
+const foreignKeyViolation = "23503"
+
 type UserRepository struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	timeouts database.Timeouts
 }
 
-func NewUserRepository(db *sqlx.DB) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *sqlx.DB, timeouts database.Timeouts) *UserRepository {
+	return &UserRepository{db: db, timeouts: timeouts}
 }
 
-func (r *UserRepository) GetUserById(id uuid.UUID) (*model.UserResponse, error) {
+func (r *UserRepository) GetUserById(ctx context.Context, id uuid.UUID) (*model.UserResponse, error) {
 	query := `SELECT name, email, preference, weightUnit, heightUnit, weight, height, imageUri FROM users WHERE id = $1`
 
 	var user model.UserResponse
-	err := r.db.QueryRow(query, id).Scan(
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.GetUserById", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.GetUserById", "SELECT")
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.Name,
 		&user.Email,
 		&user.Preference,
@@ -32,6 +48,8 @@ func (r *UserRepository) GetUserById(id uuid.UUID) (*model.UserResponse, error)
 		&user.Height,
 		&user.ImageUri,
 	)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
 
 	if err != nil {
 		return nil, err
@@ -40,7 +58,7 @@ func (r *UserRepository) GetUserById(id uuid.UUID) (*model.UserResponse, error)
 	return &user, nil
 }
 
-func (r *UserRepository) UpdateUser(id uuid.UUID, user *model.UpdateUserRequest) (*model.UserResponse, error) {
+func (r *UserRepository) UpdateUser(ctx context.Context, id uuid.UUID, user *model.UpdateUserRequest) (*model.UserResponse, error) {
 	query := `UPDATE users 
 	          SET name = $1, preference = $2, weightUnit = $3, heightUnit = $4, 
 	              weight = $5, height = $6, imageUri = $7 
@@ -48,7 +66,10 @@ func (r *UserRepository) UpdateUser(id uuid.UUID, user *model.UpdateUserRequest)
 	          RETURNING name, email, preference, weightUnit, heightUnit, weight, height, imageUri`
 
 	var updated model.UserResponse
-	err := r.db.QueryRow(query,
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.UpdateUser", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.UpdateUser", "UPDATE")
+	err := r.db.QueryRowContext(ctx, query,
 		user.Name,
 		user.Preference,
 		user.WeightUnit,
@@ -67,6 +88,8 @@ func (r *UserRepository) UpdateUser(id uuid.UUID, user *model.UpdateUserRequest)
 		&updated.Height,
 		&updated.ImageUri,
 	)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
 
 	if err != nil {
 		return nil, err
@@ -84,17 +107,26 @@ func (r *UserRepository) RegisterNewUser(c context.Context, payload model.User)
 	//Query for insert new user data
 	query := `INSERT INTO Users(id, email, password, created_at, updated_at) 
 				VALUES($1, $2, $3, $4, $5) 
-				RETURNING id, email`
+				RETURNING id, email, role`
 
 	//Execute query that is expected to return at most one row and copy few results into variables
-	err := r.db.QueryRowContext(c, query, newId, payload.Email, payload.Password, time.Now(), time.Now()).Scan(&user.ID, &user.Email)
+	ctx, cancel := r.timeouts.WithTimeout(c, "UserRepository.RegisterNewUser", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.RegisterNewUser", "INSERT")
+	err := r.db.QueryRowContext(ctx, query, newId, payload.Email, payload.Password, time.Now(), time.Now()).Scan(&user.ID, &user.Email, &user.Role)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
 	if err != nil { //error exists
 
 		if c.Err() != nil { //if error from context exists
 
-			return model.User{}, fmt.Errorf("context error: %w", c.Err()) //return context error only
+			return model.User{}, fmt.Errorf("context error: %w", database.ContextError(c, c.Err())) //return context error only
 
 		}
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return model.User{}, appErrors.ErrEmailExists.Wrap(err)
+		}
 		return model.User{}, fmt.Errorf("operation failed: %w", err) // return operation failed error
 	}
 
@@ -104,15 +136,260 @@ func (r *UserRepository) RegisterNewUser(c context.Context, payload model.User)
 func (r *UserRepository) GetUserByEmail(c context.Context, email string) (model.User, error) {
 	var user model.User
 
-	query := `SELECT id, name, email, password FROM users WHERE email=$1`
-	fmt.Println(email)
-	err := r.db.QueryRowContext(c, query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Password)
+	query := `SELECT id, name, email, COALESCE(password, ''), role, disabled_at, deleted_at FROM users WHERE email=$1`
+	logger.FromContext(c).Debug("get user by email", "email", email)
+	ctx, cancel := r.timeouts.WithTimeout(c, "UserRepository.GetUserByEmail", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.GetUserByEmail", "SELECT")
+	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &user.DisabledAt, &user.DeletedAt)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
 
 	if err != nil {
 		if c.Err() != nil {
-			return model.User{}, c.Err()
+			return model.User{}, database.ContextError(c, c.Err())
+		}
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	query := `UPDATE users SET password = $1, updated_at = $2 WHERE id = $3`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.UpdatePassword", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.UpdatePassword", "UPDATE")
+	_, err := r.db.ExecContext(ctx, query, passwordHash, time.Now(), id)
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID, verifiedAt time.Time) error {
+	query := `UPDATE users SET email_verified_at = $1 WHERE id = $2 AND email_verified_at IS NULL`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.MarkEmailVerified", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.MarkEmailVerified", "UPDATE")
+	_, err := r.db.ExecContext(ctx, query, verifiedAt, id)
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+func (r *UserRepository) IsEmailVerified(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1`
+
+	var verified bool
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.IsEmailVerified", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.IsEmailVerified", "SELECT")
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&verified)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+
+	if err != nil {
+		return false, err
+	}
+
+	return verified, nil
+}
+
+// GetPasswordHash returns an empty hash for accounts created through social login
+func (r *UserRepository) GetPasswordHash(ctx context.Context, id uuid.UUID) (string, error) {
+	query := `SELECT COALESCE(password, '') FROM users WHERE id = $1`
+
+	var hash string
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.GetPasswordHash", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.GetPasswordHash", "SELECT")
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&hash)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+
+	if err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// RevokeSessions invalidates every token issued before revokedAt
+func (r *UserRepository) RevokeSessions(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	query := `UPDATE users SET sessions_revoked_at = $1 WHERE id = $2`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.RevokeSessions", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.RevokeSessions", "UPDATE")
+	_, err := r.db.ExecContext(ctx, query, revokedAt, id)
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+// GetSessionsRevokedAt returns nil when the user never revoked their sessions
+func (r *UserRepository) GetSessionsRevokedAt(ctx context.Context, id uuid.UUID) (*time.Time, error) {
+	query := `SELECT sessions_revoked_at FROM users WHERE id = $1`
+
+	var revokedAt *time.Time
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.GetSessionsRevokedAt", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.GetSessionsRevokedAt", "SELECT")
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&revokedAt)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return revokedAt, nil
+}
+
+// MarkDeleted starts the deletion grace period, the row stays until PurgeUser
+func (r *UserRepository) MarkDeleted(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	query := `UPDATE users SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.MarkDeleted", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.MarkDeleted", "UPDATE")
+	_, err := r.db.ExecContext(ctx, query, deletedAt, id)
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+func (r *UserRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE users SET deleted_at = NULL WHERE id = $1`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.Restore", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.Restore", "UPDATE")
+	_, err := r.db.ExecContext(ctx, query, id)
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+// GetDeletedBefore lists accounts whose grace period ended before cutoff
+func (r *UserRepository) GetDeletedBefore(ctx context.Context, cutoff time.Time, limit int) ([]model.User, error) {
+	query := `SELECT id, email FROM users
+	          WHERE deleted_at IS NOT NULL AND deleted_at < $1
+	          ORDER BY deleted_at LIMIT $2`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.GetDeletedBefore", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.GetDeletedBefore", "SELECT")
+	rows, err := r.db.QueryContext(ctx, query, cutoff, limit)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, database.ContextError(ctx, err)
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		var user model.User
+		if err := rows.Scan(&user.ID, &user.Email); err != nil {
+			tracing.End(span, err)
+			return nil, err
 		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	tracing.End(span, err)
+
+	return users, database.ContextError(ctx, err)
+}
+
+// PurgeUser removes the row for good, activities go with it through ON DELETE CASCADE
+func (r *UserRepository) PurgeUser(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM users WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.PurgeUser", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.PurgeUser", "DELETE")
+	_, err := r.db.ExecContext(ctx, query, id)
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+// GetUserAuth loads what a token is issued from
+func (r *UserRepository) GetUserAuth(ctx context.Context, id uuid.UUID) (model.User, error) {
+	query := `SELECT id, email, role, disabled_at, deleted_at FROM users WHERE id = $1`
+
+	var user model.User
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.GetUserAuth", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.GetUserAuth", "SELECT")
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Email, &user.Role, &user.DisabledAt, &user.DeletedAt)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+
+	if err != nil {
 		return model.User{}, err
 	}
+
 	return user, nil
 }
+
+func (r *UserRepository) SearchUsers(ctx context.Context, filter model.AdminUserFilter) ([]model.AdminUser, error) {
+	query := `SELECT id, name, email, role, email_verified_at, disabled_at, deleted_at, created_at FROM users WHERE 1=1`
+
+	args := []interface{}{}
+	argIndex := 1
+
+	if filter.Search != "" {
+		query += fmt.Sprintf(" AND (email ILIKE $%d OR name ILIKE $%d)", argIndex, argIndex)
+		args = append(args, "%"+filter.Search+"%")
+		argIndex++
+	}
+	if filter.Role != nil {
+		query += fmt.Sprintf(" AND role = $%d", argIndex)
+		args = append(args, *filter.Role)
+		argIndex++
+	}
+
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, filter.Limit, filter.Offset)
+
+	users := []model.AdminUser{}
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.SearchUsers", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.SearchUsers", "SELECT")
+	err := r.db.SelectContext(ctx, &users, query, args...)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r *UserRepository) UpdateRole(ctx context.Context, id uuid.UUID, role model.Role) error {
+	query := `UPDATE users SET role = $1, updated_at = $2 WHERE id = $3`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.UpdateRole", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.UpdateRole", "UPDATE")
+	_, err := r.db.ExecContext(ctx, query, role, time.Now(), id)
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+// SetDisabled disables the account at disabledAt, nil enables it again
+func (r *UserRepository) SetDisabled(ctx context.Context, id uuid.UUID, disabledAt *time.Time) error {
+	query := `UPDATE users SET disabled_at = $1, updated_at = $2 WHERE id = $3`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserRepository.SetDisabled", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserRepository.SetDisabled", "UPDATE")
+	_, err := r.db.ExecContext(ctx, query, disabledAt, time.Now(), id)
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/insanjati/fitbyte/internal/database"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type UserIdentityRepository struct {
+	db       *sqlx.DB
+	timeouts database.Timeouts
+}
+
+func NewUserIdentityRepository(db *sqlx.DB, timeouts database.Timeouts) *UserIdentityRepository {
+	return &UserIdentityRepository{db: db, timeouts: timeouts}
+}
+
+// GetUserByIdentity returns the user linked to provider and subject
+func (r *UserIdentityRepository) GetUserByIdentity(ctx context.Context, provider, subject string) (model.User, error) {
+	query := `SELECT u.id, u.email, u.role, u.disabled_at, u.deleted_at FROM users u
+	          JOIN user_identities i ON i.user_id = u.id
+	          WHERE i.provider = $1 AND i.subject = $2`
+
+	var user model.User
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserIdentityRepository.GetUserByIdentity", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserIdentityRepository.GetUserByIdentity", "SELECT")
+	err := r.db.QueryRowContext(ctx, query, provider, subject).Scan(&user.ID, &user.Email, &user.Role, &user.DisabledAt, &user.DeletedAt)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+
+	if err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+func (r *UserIdentityRepository) LinkIdentity(ctx context.Context, identity *model.UserIdentity) error {
+	query := `INSERT INTO user_identities (id, user_id, provider, subject, email, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6)`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserIdentityRepository.LinkIdentity", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserIdentityRepository.LinkIdentity", "INSERT")
+	_, err := r.db.ExecContext(ctx, query, identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt)
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+// CreateUserWithIdentity registers a passwordless user and links the identity
+// in one transaction. verified marks the email as confirmed by the provider.
+func (r *UserIdentityRepository) CreateUserWithIdentity(ctx context.Context, user *model.User, identity *model.UserIdentity, verified bool) error {
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserIdentityRepository.CreateUserWithIdentity", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserIdentityRepository.CreateUserWithIdentity", "INSERT")
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		tracing.End(span, err)
+		return database.ContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	var verifiedAt *time.Time
+	if verified {
+		verifiedAt = &user.CreatedAt
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO users (id, name, email, password, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, NULL, $4, $5, $5)`,
+		user.ID, user.Name, user.Email, verifiedAt, user.CreatedAt)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO user_identities (id, user_id, provider, subject, email, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	tracing.End(span, err)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return appErrors.ErrEmailExists.Wrap(err)
+	}
+	return database.ContextError(ctx, err)
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/database"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+)
+
+func TestRegisterNewUser(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewUserRepository(db, database.Timeouts{})
+	ctx := context.Background()
+
+	email := uuid.NewString() + "@example.com"
+	t.Cleanup(func() {
+		if _, err := db.Exec(`DELETE FROM users WHERE email = $1`, email); err != nil {
+			t.Errorf("failed to remove test user: %v", err)
+		}
+	})
+
+	user, err := repo.RegisterNewUser(ctx, model.User{Email: email, Password: "hash"})
+	if err != nil {
+		t.Fatalf("RegisterNewUser() error = %v", err)
+	}
+	if user.Email != email {
+		t.Errorf("Email = %q, want %q", user.Email, email)
+	}
+	if user.Role != model.RoleUser {
+		t.Errorf("Role = %q, want %q", user.Role, model.RoleUser)
+	}
+
+	stored, err := repo.GetUserAuth(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserAuth() error = %v", err)
+	}
+	if stored.Role != user.Role {
+		t.Errorf("stored role = %q, returned %q", stored.Role, user.Role)
+	}
+
+	if _, err := repo.RegisterNewUser(ctx, model.User{Email: email, Password: "hash"}); !errors.Is(err, appErrors.ErrEmailExists) {
+		t.Errorf("RegisterNewUser() with a taken email error = %v, want %v", err, appErrors.ErrEmailExists)
+	}
+}
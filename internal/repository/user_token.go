@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/database"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"github.com/jmoiron/sqlx"
+)
+
+type UserTokenRepository struct {
+	db       *sqlx.DB
+	timeouts database.Timeouts
+}
+
+func NewUserTokenRepository(db *sqlx.DB, timeouts database.Timeouts) *UserTokenRepository {
+	return &UserTokenRepository{db: db, timeouts: timeouts}
+}
+
+// CreateToken stores a new token and invalidates older unused ones of the same purpose
+func (r *UserTokenRepository) CreateToken(ctx context.Context, token *model.UserToken) error {
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserTokenRepository.CreateToken", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserTokenRepository.CreateToken", "INSERT")
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		tracing.End(span, err)
+		return database.ContextError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE user_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		token.UserID, token.Purpose)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO user_tokens (id, user_id, purpose, token_hash, expires_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			token.ID, token.UserID, token.Purpose, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	tracing.End(span, err)
+
+	return database.ContextError(ctx, err)
+}
+
+func (r *UserTokenRepository) GetToken(ctx context.Context, id uuid.UUID, purpose model.TokenPurpose) (*model.UserToken, error) {
+	query := `SELECT id, user_id, purpose, token_hash, expires_at, used_at, created_at FROM user_tokens WHERE id = $1 AND purpose = $2`
+
+	var token model.UserToken
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserTokenRepository.GetToken", database.Read)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserTokenRepository.GetToken", "SELECT")
+	err := r.db.GetContext(ctx, &token, query, id, purpose)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkUsed consumes the token, returning false if it was already used
+func (r *UserTokenRepository) MarkUsed(ctx context.Context, id uuid.UUID, usedAt time.Time) (bool, error) {
+	query := `UPDATE user_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL`
+
+	ctx, cancel := r.timeouts.WithTimeout(ctx, "UserTokenRepository.MarkUsed", database.Write)
+	defer cancel()
+	ctx, span := tracing.StartDB(ctx, "UserTokenRepository.MarkUsed", "UPDATE")
+	result, err := r.db.ExecContext(ctx, query, usedAt, id)
+	tracing.End(span, err)
+	err = database.ContextError(ctx, err)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
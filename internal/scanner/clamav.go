@@ -0,0 +1,132 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/insanjati/fitbyte/internal/tracing"
+)
+
+// clamdChunkSize is how much content goes into one INSTREAM chunk
+const clamdChunkSize = 64 * 1024
+
+type ClamAVConfig struct {
+	// Address of clamd, "tcp://clamav:3310" or "unix:///run/clamav/clamd.sock"
+	Address string
+	// Timeout bounds a whole scan when the context has no earlier deadline
+	Timeout time.Duration
+}
+
+// ClamAV streams content to clamd with the INSTREAM command
+type ClamAV struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+func NewClamAV(config ClamAVConfig) (*ClamAV, error) {
+	u, err := url.Parse(config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clamd address: %w", err)
+	}
+
+	scanner := &ClamAV{network: u.Scheme, timeout: config.Timeout}
+	switch u.Scheme {
+	case "tcp":
+		scanner.address = u.Host
+	case "unix":
+		scanner.address = u.Path
+	default:
+		return nil, fmt.Errorf("clamd address must start with tcp:// or unix://, got %q", config.Address)
+	}
+	return scanner, nil
+}
+
+func (c *ClamAV) Scan(ctx context.Context, data io.Reader) (Result, error) {
+	ctx, span := tracing.Start(ctx, "ClamAV.Scan")
+	result, err := c.scan(ctx, data)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (c *ClamAV) scan(ctx context.Context, data io.Reader) (Result, error) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return Result{}, err
+	}
+
+	// clamd may hang up early, for example past its StreamMaxLength, and
+	// still explain why in its reply
+	writeErr := c.stream(conn, data)
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		if writeErr != nil {
+			return Result{}, fmt.Errorf("failed to stream to clamd: %w", writeErr)
+		}
+		return Result{}, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// stream sends data as length prefixed chunks ended by an empty one
+func (c *ClamAV) stream(conn net.Conn, data io.Reader) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := io.ReadFull(data, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseReply reads "stream: OK", "stream: <signature> FOUND" or
+// "<reason> ERROR"
+func parseReply(reply string) (Result, error) {
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return Result{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(reply, " FOUND")
+		if i := strings.Index(signature, ": "); i >= 0 {
+			signature = signature[i+2:]
+		}
+		return Result{Signature: signature}, nil
+	default:
+		return Result{}, fmt.Errorf("clamd: %s", reply)
+	}
+}
@@ -0,0 +1,161 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    Result
+		wantErr bool
+	}{
+		{"clean", "stream: OK", Result{Clean: true}, false},
+		{"infected", "stream: Eicar-Test-Signature FOUND", Result{Signature: "Eicar-Test-Signature"}, false},
+		{"signature with spaces", "stream: Win.Test EICAR_HDB-1 FOUND", Result{Signature: "Win.Test EICAR_HDB-1"}, false},
+		{"size limit", "INSTREAM size limit exceeded. ERROR", Result{}, true},
+		{"empty", "", Result{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseReply(tt.reply)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseReply(%q) error = %v, wantErr %v", tt.reply, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseReply(%q) = %+v, want %+v", tt.reply, got, tt.want)
+			}
+		})
+	}
+}
+
+// readInstream plays clamd's side of INSTREAM, returning the content
+// received and checking the framing along the way
+func readInstream(t *testing.T, conn net.Conn) []byte {
+	t.Helper()
+
+	command := make([]byte, len("zINSTREAM\x00"))
+	if _, err := io.ReadFull(conn, command); err != nil {
+		t.Errorf("failed to read command: %v", err)
+		return nil
+	}
+	if string(command) != "zINSTREAM\x00" {
+		t.Errorf("command = %q, want %q", command, "zINSTREAM\x00")
+		return nil
+	}
+
+	var content []byte
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			t.Errorf("failed to read chunk size: %v", err)
+			return nil
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n == 0 {
+			return content
+		}
+		if n > clamdChunkSize {
+			t.Errorf("chunk of %d bytes, want at most %d", n, clamdChunkSize)
+			return nil
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(conn, chunk); err != nil {
+			t.Errorf("failed to read chunk: %v", err)
+			return nil
+		}
+		content = append(content, chunk...)
+	}
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"small", []byte("hello")},
+		{"one chunk", bytes.Repeat([]byte("a"), clamdChunkSize)},
+		{"several chunks", bytes.Repeat([]byte("b"), 2*clamdChunkSize+7)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+
+			received := make(chan []byte, 1)
+			go func() {
+				defer server.Close()
+				received <- readInstream(t, server)
+			}()
+
+			if err := (&ClamAV{}).stream(client, bytes.NewReader(tt.data)); err != nil {
+				t.Fatalf("stream() error = %v", err)
+			}
+			if got := <-received; !bytes.Equal(got, tt.data) {
+				t.Errorf("clamd received %d bytes, want %d", len(got), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		reply   string
+		want    Result
+		wantErr bool
+	}{
+		{"clean", "hello", "stream: OK\x00", Result{Clean: true}, false},
+		{"infected", EICAR, "stream: Eicar-Test-Signature FOUND\x00", Result{Signature: "Eicar-Test-Signature"}, false},
+		{"error", "hello", "INSTREAM size limit exceeded. ERROR\x00", Result{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer listener.Close()
+
+			received := make(chan []byte, 1)
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					received <- nil
+					return
+				}
+				defer conn.Close()
+				content := readInstream(t, conn)
+				_, _ = conn.Write([]byte(tt.reply))
+				received <- content
+			}()
+
+			clamav, err := NewClamAV(ClamAVConfig{Address: "tcp://" + listener.Addr().String(), Timeout: 5 * time.Second})
+			if err != nil {
+				t.Fatalf("NewClamAV() error = %v", err)
+			}
+			got, err := clamav.Scan(t.Context(), strings.NewReader(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Scan() = %+v, want %+v", got, tt.want)
+			}
+			if content := <-received; string(content) != tt.data {
+				t.Errorf("clamd received %q, want %q", content, tt.data)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// EICAR is the standard antivirus test file
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// Fake flags content containing the EICAR test string, for tests and local
+// development without clamd
+type Fake struct{}
+
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+func (f *Fake) Scan(ctx context.Context, data io.Reader) (Result, error) {
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return Result{}, err
+	}
+	if bytes.Contains(content, []byte(EICAR)) {
+		return Result{Signature: "Eicar-Test-Signature"}, nil
+	}
+	return Result{Clean: true}, nil
+}
@@ -0,0 +1,17 @@
+package scanner
+
+import (
+	"context"
+	"io"
+)
+
+// Result of scanning one object. Signature names the malware found.
+type Result struct {
+	Clean     bool
+	Signature string
+}
+
+// Scanner checks uploaded content for malware before it is served
+type Scanner interface {
+	Scan(ctx context.Context, data io.Reader) (Result, error)
+}
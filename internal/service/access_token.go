@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/tracing"
+)
+
+const (
+	// AccessTokenPrefix tells personal access tokens apart from JWTs
+	AccessTokenPrefix = "fbp_"
+	// accessTokenDisplayLength characters are kept in clear to recognise a token
+	accessTokenDisplayLength = 12
+)
+
+// AccessTokenService manages personal access tokens for scripts and
+// integrations
+type AccessTokenService struct {
+	repo  *repository.AccessTokenRepository
+	audit *AuditService
+}
+
+func NewAccessTokenService(repo *repository.AccessTokenRepository, audit *AuditService) *AccessTokenService {
+	return &AccessTokenService{repo: repo, audit: audit}
+}
+
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create returns the new token, its plain value is never shown again
+func (s *AccessTokenService) Create(ctx context.Context, userID uuid.UUID, req model.CreateAccessTokenRequest) (*model.CreatedAccessToken, error) {
+	ctx, span := tracing.Start(ctx, "AccessTokenService.Create")
+	defer span.End()
+
+	secret, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	plain := AccessTokenPrefix + secret
+
+	now := time.Now()
+	token := model.PersonalAccessToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    plain[:accessTokenDisplayLength],
+		Scopes:    req.Scopes,
+		CreatedAt: now,
+	}
+	if req.ExpiresInDays != nil {
+		expiresAt := now.AddDate(0, 0, *req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.Create(ctx, &token, hashAccessToken(plain)); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    userID,
+		SubjectID:  userID,
+		Action:     "access_token.created",
+		EntityType: "access_token",
+		EntityID:   token.ID.String(),
+		After:      token,
+	})
+	return &model.CreatedAccessToken{PersonalAccessToken: token, Token: plain}, nil
+}
+
+func (s *AccessTokenService) List(ctx context.Context, userID uuid.UUID) ([]model.PersonalAccessToken, error) {
+	ctx, span := tracing.Start(ctx, "AccessTokenService.List")
+	defer span.End()
+
+	return s.repo.ListByUser(ctx, userID)
+}
+
+func (s *AccessTokenService) Revoke(ctx context.Context, userID, tokenID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "AccessTokenService.Revoke")
+	defer span.End()
+
+	removed, err := s.repo.Delete(ctx, tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return appErrors.ErrAccessTokenNotFound
+	}
+
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    userID,
+		SubjectID:  userID,
+		Action:     "access_token.revoked",
+		EntityType: "access_token",
+		EntityID:   tokenID.String(),
+	})
+	return nil
+}
+
+// Authenticate resolves a plain token presented in the Authorization header
+func (s *AccessTokenService) Authenticate(ctx context.Context, plain string) (*model.PersonalAccessToken, error) {
+	if !strings.HasPrefix(plain, AccessTokenPrefix) {
+		return nil, appErrors.ErrInvalidToken
+	}
+
+	token, err := s.repo.GetByHash(ctx, hashAccessToken(plain))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, appErrors.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, appErrors.ErrExpiredToken
+	}
+
+	if err := s.repo.Touch(ctx, token.ID, now); err != nil {
+		logger.FromContext(ctx).Warn("failed to record access token use", "token_id", token.ID.String(), "error", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/cache"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/mailer"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"github.com/insanjati/fitbyte/internal/utils"
+)
+
+type AccountConfig struct {
+	// SigningKey is the HMAC key tokens are signed with before being stored
+	SigningKey       string
+	BaseURL          string
+	VerificationTTL  time.Duration
+	PasswordResetTTL time.Duration
+	// Lockout is the login lockout a password reset lifts
+	Lockout LockoutConfig
+}
+
+// AccountService handles email verification and password reset tokens
+type AccountService struct {
+	userRepo   *repository.UserRepository
+	tokenRepo  *repository.UserTokenRepository
+	cache      *cache.Redis
+	mailer     mailer.Mailer
+	sessions   *SessionService
+	hasher     utils.PasswordHasher
+	loginGuard *loginGuard
+	config     AccountConfig
+}
+
+func NewAccountService(userRepo *repository.UserRepository, tokenRepo *repository.UserTokenRepository, cache *cache.Redis, mailer mailer.Mailer, sessions *SessionService, config AccountConfig) *AccountService {
+	return &AccountService{
+		userRepo:   userRepo,
+		tokenRepo:  tokenRepo,
+		cache:      cache,
+		mailer:     mailer,
+		sessions:   sessions,
+		hasher:     utils.NewPasswordHasher(),
+		loginGuard: &loginGuard{cache: cache, config: config.Lockout},
+		config:     config,
+	}
+}
+
+func (s *AccountService) getVerifiedKey(userID uuid.UUID) string {
+	return fmt.Sprintf("user_verified:%s", userID.String())
+}
+
+// issueToken creates a single-use token. The client receives "<id>.<secret>",
+// only the HMAC of the secret is stored.
+func (s *AccountService) issueToken(ctx context.Context, userID uuid.UUID, purpose model.TokenPurpose, ttl time.Duration) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	token := &model.UserToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: s.sign(encoded),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := s.tokenRepo.CreateToken(ctx, token); err != nil {
+		return "", err
+	}
+
+	return token.ID.String() + "." + encoded, nil
+}
+
+// consumeToken validates and burns a token, returning the owning user
+func (s *AccountService) consumeToken(ctx context.Context, raw string, purpose model.TokenPurpose) (uuid.UUID, error) {
+	idPart, secret, ok := strings.Cut(raw, ".")
+	if !ok {
+		return uuid.Nil, appErrors.ErrInvalidAccountToken
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return uuid.Nil, appErrors.ErrInvalidAccountToken.Wrap(err)
+	}
+
+	token, err := s.tokenRepo.GetToken(ctx, id, purpose)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, appErrors.ErrInvalidAccountToken
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if !hmac.Equal([]byte(token.TokenHash), []byte(s.sign(secret))) {
+		return uuid.Nil, appErrors.ErrInvalidAccountToken
+	}
+	if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return uuid.Nil, appErrors.ErrInvalidAccountToken
+	}
+
+	used, err := s.tokenRepo.MarkUsed(ctx, token.ID, time.Now())
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !used {
+		return uuid.Nil, appErrors.ErrInvalidAccountToken
+	}
+
+	return token.UserID, nil
+}
+
+func (s *AccountService) sign(secret string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.SigningKey))
+	mac.Write([]byte(secret))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *AccountService) SendVerification(ctx context.Context, userID uuid.UUID, email string) error {
+	ctx, span := tracing.Start(ctx, "AccountService.SendVerification")
+	defer span.End()
+
+	token, err := s.issueToken(ctx, userID, model.TokenPurposeEmailVerification, s.config.VerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your FitByte email",
+		Body: fmt.Sprintf("Welcome to FitByte!\n\nConfirm your email address by opening the link below:\n%s/verify-email?token=%s\n\nThe link expires in %s.",
+			s.config.BaseURL, token, s.config.VerificationTTL),
+	})
+}
+
+// ResendVerification sends a fresh link to the user's current email
+func (s *AccountService) ResendVerification(ctx context.Context, userID uuid.UUID) error {
+	verified, err := s.IsEmailVerified(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if verified {
+		return appErrors.ErrEmailAlreadyVerified
+	}
+
+	user, err := s.userRepo.GetUserById(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return appErrors.ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.SendVerification(ctx, userID, user.Email)
+}
+
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := tracing.Start(ctx, "AccountService.VerifyEmail")
+	defer span.End()
+
+	userID, err := s.consumeToken(ctx, token, model.TokenPurposeEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.MarkEmailVerified(ctx, userID, time.Now()); err != nil {
+		return err
+	}
+
+	_ = s.cache.Delete(ctx, s.getVerifiedKey(userID))
+	return nil
+}
+
+// ForgotPassword mails a reset link. Unknown emails are silently ignored so the
+// endpoint cannot be used to enumerate accounts.
+func (s *AccountService) ForgotPassword(ctx context.Context, email string) error {
+	ctx, span := tracing.Start(ctx, "AccountService.ForgotPassword")
+	defer span.End()
+
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.FromContext(ctx).Info("password reset requested for unknown email", "email", email)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.DeletedAt != nil {
+		logger.FromContext(ctx).Info("password reset requested for deleted account", "email", email)
+		return nil
+	}
+
+	token, err := s.issueToken(ctx, user.ID, model.TokenPurposePasswordReset, s.config.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your FitByte password",
+		Body: fmt.Sprintf("We received a request to reset your password.\n\nChoose a new password here:\n%s/reset-password?token=%s\n\nThe link expires in %s. If you did not ask for this, ignore this email.",
+			s.config.BaseURL, token, s.config.PasswordResetTTL),
+	})
+}
+
+func (s *AccountService) ResetPassword(ctx context.Context, token, password string) error {
+	ctx, span := tracing.Start(ctx, "AccountService.ResetPassword")
+	defer span.End()
+
+	userID, err := s.consumeToken(ctx, token, model.TokenPurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hasher.EncryptPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt password: %w", err)
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		return err
+	}
+
+	// Whoever knew the old password must not keep a session
+	if err := s.sessions.Revoke(ctx, userID); err != nil {
+		return err
+	}
+
+	// Receiving the reset mail proves ownership of the address
+	if err := s.userRepo.MarkEmailVerified(ctx, userID, time.Now()); err != nil {
+		return err
+	}
+	_ = s.cache.Delete(ctx, s.getVerifiedKey(userID))
+
+	// The new password is known to the owner, failures with the old one no
+	// longer count against them
+	user, err := s.userRepo.GetUserAuth(ctx, userID)
+	if err != nil {
+		return err
+	}
+	s.loginGuard.reset(ctx, user.Email)
+	return nil
+}
+
+func (s *AccountService) IsEmailVerified(ctx context.Context, userID uuid.UUID) (bool, error) {
+	cacheKey := s.getVerifiedKey(userID)
+
+	var verified bool
+	if err := s.cache.GetAs(ctx, cacheKey, &verified); err == nil {
+		return verified, nil
+	}
+
+	verified, err := s.userRepo.IsEmailVerified(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, appErrors.ErrUserNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_ = s.cache.SetExp(ctx, cacheKey, verified, 5*time.Minute)
+	return verified, nil
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/cache"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"github.com/insanjati/fitbyte/internal/utils"
+)
+
+// purgeBatchSize bounds how many accounts one purge run removes
+const purgeBatchSize = 100
+
+type DeletionConfig struct {
+	// GracePeriod is how long a deleted account can still be restored, zero
+	// deletes immediately
+	GracePeriod   time.Duration
+	PurgeInterval time.Duration
+	// Lockout is shared with logins, restoring checks the password too
+	Lockout LockoutConfig
+}
+
+// UserFileRemover deletes every object uploaded by a user
+type UserFileRemover interface {
+	RemoveUserFiles(ctx context.Context, ownerID uuid.UUID) error
+}
+
+// AccountDeletionService soft deletes accounts and purges them, together with
+// their uploads and cached data, once the grace period is over
+type AccountDeletionService struct {
+	userRepo     *repository.UserRepository
+	activityRepo *repository.ActivityRepository
+	sessions     *SessionService
+	cache        *cache.Redis
+	files        UserFileRemover
+	audit        *AuditService
+	hasher       utils.PasswordHasher
+	loginGuard   *loginGuard
+	config       DeletionConfig
+}
+
+func NewAccountDeletionService(userRepo *repository.UserRepository, activityRepo *repository.ActivityRepository, sessions *SessionService, cache *cache.Redis, files UserFileRemover, audit *AuditService, config DeletionConfig) *AccountDeletionService {
+	return &AccountDeletionService{
+		userRepo:     userRepo,
+		activityRepo: activityRepo,
+		sessions:     sessions,
+		cache:        cache,
+		files:        files,
+		audit:        audit,
+		hasher:       utils.NewPasswordHasher(),
+		loginGuard:   &loginGuard{cache: cache, config: config.Lockout},
+		config:       config,
+	}
+}
+
+// DeleteAccount signs the user out everywhere and schedules the purge
+func (s *AccountDeletionService) DeleteAccount(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "AccountDeletionService.DeleteAccount")
+	defer span.End()
+
+	user, err := s.userRepo.GetUserById(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return appErrors.ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.MarkDeleted(ctx, userID, time.Now()); err != nil {
+		return err
+	}
+	if err := s.sessions.Revoke(ctx, userID); err != nil {
+		return err
+	}
+	logger.FromContext(ctx).Info("account scheduled for deletion", "grace_period", s.config.GracePeriod.String())
+
+	if s.config.GracePeriod > 0 {
+		return nil
+	}
+
+	imageURI := ""
+	if user.ImageUri != nil {
+		imageURI = *user.ImageUri
+	}
+	return s.purge(ctx, model.User{ID: userID, Email: user.Email, ImageUri: imageURI})
+}
+
+// RestoreAccount cancels a pending deletion. The password is required since
+// every session was revoked when the account was deleted. Attempts count
+// towards the login lockout, and accounts that are not pending deletion get
+// the same answer as a wrong password so the route cannot check passwords.
+func (s *AccountDeletionService) RestoreAccount(ctx context.Context, email, password string) error {
+	ctx, span := tracing.Start(ctx, "AccountDeletionService.RestoreAccount")
+	defer span.End()
+
+	if err := s.loginGuard.check(ctx, email); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = s.hasher.ComparePasswordHash(dummyPasswordHash, password)
+		s.loginGuard.fail(ctx, email)
+		return appErrors.ErrInvalidCredentials
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.hasher.ComparePasswordHash(user.Password, password); err != nil {
+		s.loginGuard.fail(ctx, email)
+		s.audit.Record(ctx, AuditEvent{
+			SubjectID:  user.ID,
+			Action:     "user.login_failed",
+			EntityType: "user",
+			EntityID:   user.ID.String(),
+			Metadata:   map[string]string{"method": "account_restore", "reason": "invalid_password"},
+		})
+		return appErrors.ErrInvalidCredentials.Wrap(err)
+	}
+
+	if user.DeletedAt == nil {
+		s.loginGuard.fail(ctx, email)
+		return appErrors.ErrInvalidCredentials
+	}
+	if time.Since(*user.DeletedAt) > s.config.GracePeriod {
+		// Waiting for the next purge run
+		return appErrors.ErrUserNotFound
+	}
+
+	if err := s.userRepo.Restore(ctx, user.ID); err != nil {
+		return err
+	}
+	s.loginGuard.reset(ctx, email)
+	logger.FromContext(ctx).Info("account restored", "user_id", user.ID.String())
+	return nil
+}
+
+// PurgeExpired removes accounts whose grace period has ended
+func (s *AccountDeletionService) PurgeExpired(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "AccountDeletionService.PurgeExpired")
+	defer span.End()
+
+	users, err := s.userRepo.GetDeletedBefore(ctx, time.Now().Add(-s.config.GracePeriod), purgeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		if err := s.purge(ctx, user); err != nil {
+			logger.FromContext(ctx).Error("failed to purge account", "user_id", user.ID.String(), "error", err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Run purges expired accounts every PurgeInterval until ctx is cancelled
+func (s *AccountDeletionService) Run(ctx context.Context) {
+	if s.config.PurgeInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.PurgeExpired(ctx)
+			if err != nil {
+				logger.FromContext(ctx).Error("account purge failed", "error", err)
+				continue
+			}
+			if purged > 0 {
+				logger.FromContext(ctx).Info("purged deleted accounts", "count", purged)
+			}
+		}
+	}
+}
+
+// purge removes uploads first so a failure leaves the row around to retry
+func (s *AccountDeletionService) purge(ctx context.Context, user model.User) error {
+	if err := s.files.RemoveUserFiles(ctx, user.ID); err != nil {
+		return err
+	}
+
+	activityIDs, err := s.activityRepo.GetActivityIDsByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	// Activities go with the row through ON DELETE CASCADE
+	if err := s.userRepo.PurgeUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	s.purgeCache(ctx, user, activityIDs)
+	return nil
+}
+
+func (s *AccountDeletionService) purgeCache(ctx context.Context, user model.User, activityIDs []uuid.UUID) {
+	guard := &loginGuard{cache: s.cache}
+	keys := []string{
+		fmt.Sprintf("user:id:%s", user.ID.String()),
+		fmt.Sprintf("user_exists:%s", user.ID.String()),
+		fmt.Sprintf("user_verified:%s", user.ID.String()),
+		s.sessions.getRevokedKey(user.ID),
+		guard.failuresKey(user.Email),
+		guard.lockKey(user.Email),
+	}
+	for _, id := range activityIDs {
+		keys = append(keys, fmt.Sprintf("activity:%s", id.String()))
+	}
+
+	for _, key := range keys {
+		if err := s.cache.Delete(ctx, key); err != nil {
+			logger.FromContext(ctx).Warn("failed to purge cache key", "key", key, "error", err)
+		}
+	}
+	if err := s.cache.DeletePattern(ctx, fmt.Sprintf("user_activities:%s*", user.ID.String())); err != nil {
+		logger.FromContext(ctx).Warn("failed to purge activity lists", "error", err)
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"time"
@@ -9,19 +10,29 @@ import (
 	"github.com/google/uuid"
 	"github.com/insanjati/fitbyte/internal/cache"
 	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/metrics"
 	"github.com/insanjati/fitbyte/internal/model"
 	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ActivityService struct {
 	activityRepo *repository.ActivityRepository
 	cache        *cache.Redis
+	coaching     *CoachingService
+	attachments  *AttachmentService
+	audit        *AuditService
 }
 
-func NewActivityService(activityRepo *repository.ActivityRepository, cache *cache.Redis) *ActivityService {
+func NewActivityService(activityRepo *repository.ActivityRepository, cache *cache.Redis, coaching *CoachingService, attachments *AttachmentService, audit *AuditService) *ActivityService {
 	return &ActivityService{
 		activityRepo: activityRepo,
 		cache:        cache,
+		coaching:     coaching,
+		attachments:  attachments,
+		audit:        audit,
 	}
 }
 
@@ -68,13 +79,21 @@ func (s *ActivityService) getUserActivitiesPattern(userID uuid.UUID) string {
 func (s *ActivityService) calculateCalories(activityType *model.ActivityType, durationInMinutes *int) (*int, error) {
 	calsPerMinute, ok := model.ActivityTypeCalories[*activityType]
 	if !ok {
-		return nil, errors.New("invalid activityType")
+		return nil, appErrors.ErrInvalidActivityType
 	}
 	calories := calsPerMinute * (*durationInMinutes)
 	return &calories, nil
 }
 
 func (s *ActivityService) CreateActivity(ctx context.Context, userID uuid.UUID, req model.CreateActivityRequest) (*model.Activity, error) {
+	ctx, span := tracing.Start(ctx, "ActivityService.CreateActivity")
+	defer span.End()
+
+	return s.createActivity(ctx, userID, userID, req)
+}
+
+// createActivity adds an activity to userID, actorID is who asked for it
+func (s *ActivityService) createActivity(ctx context.Context, actorID, userID uuid.UUID, req model.CreateActivityRequest) (*model.Activity, error) {
 	isUserExists, err := s.checkUserExistsWithCache(ctx, userID)
 	if err != nil {
 		return nil, err
@@ -85,7 +104,7 @@ func (s *ActivityService) CreateActivity(ctx context.Context, userID uuid.UUID,
 
 	doneAt, err := time.Parse(time.RFC3339, req.DoneAt)
 	if err != nil {
-		return nil, errors.New("invalid doneAt")
+		return nil, appErrors.ErrInvalidDoneAt.Wrap(err)
 	}
 
 	calories, err := s.calculateCalories(&req.ActivityType, &req.DurationInMinutes)
@@ -93,6 +112,11 @@ func (s *ActivityService) CreateActivity(ctx context.Context, userID uuid.UUID,
 		return nil, err
 	}
 
+	visibility := req.Visibility
+	if visibility == "" {
+		visibility = model.ActivityVisibilityPrivate
+	}
+
 	activity := &model.Activity{
 		ID:                uuid.New(),
 		UserID:            userID,
@@ -100,13 +124,15 @@ func (s *ActivityService) CreateActivity(ctx context.Context, userID uuid.UUID,
 		DoneAt:            doneAt,
 		DurationInMinutes: req.DurationInMinutes,
 		CaloriesBurned:    *calories,
+		Visibility:        visibility,
 		CreatedAt:         time.Now(),
 		UpdatedAt:         time.Now(),
 	}
 
-	if err := s.activityRepo.CreateActivity(activity); err != nil {
+	if err := s.activityRepo.CreateActivity(ctx, activity); err != nil {
 		return nil, err
 	}
+	metrics.ActivitiesCreatedTotal.WithLabelValues(string(activity.ActivityType)).Inc()
 
 	activityKey := s.getActivityKey(activity.ID)
 	_ = s.cache.SetExp(ctx, activityKey, activity, 1*time.Hour)
@@ -114,37 +140,53 @@ func (s *ActivityService) CreateActivity(ctx context.Context, userID uuid.UUID,
 	pattern := s.getUserActivitiesPattern(userID)
 	_ = s.cache.DeletePattern(ctx, pattern)
 
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    actorID,
+		SubjectID:  userID,
+		Action:     "activity.created",
+		EntityType: "activity",
+		EntityID:   activity.ID.String(),
+		After:      activity,
+	})
 	return activity, nil
 }
 
 func (s *ActivityService) GetUserActivities(ctx context.Context, userID uuid.UUID, filter *model.ActivityFilter) ([]model.Activity, error) {
+	ctx, span := tracing.Start(ctx, "ActivityService.GetUserActivities")
+	defer span.End()
+
 	cacheKey := s.getUserActivitiesKey(userID, filter)
 	var cachedActivities []model.Activity
 
 	err := s.cache.GetAs(ctx, cacheKey, &cachedActivities)
 	if err == nil {
-		// log.Printf("[CACHE HIT] UserActivities - Key: %s, UserID: %s", cacheKey, userID.String())
-		return cachedActivities, nil
+		logger.FromContext(ctx).Debug("cache hit", "key", cacheKey)
+		return cachedActivities, s.attachments.Load(ctx, cachedActivities)
 	}
 
-	// log.Printf("[CACHE MISS] UserActivities - Key: %s, UserID: %s, Error: %v", cacheKey, userID.String(), err)
+	logger.FromContext(ctx).Debug("cache miss", "key", cacheKey, "error", err)
 
-	activities, err := s.activityRepo.GetUserActivities(userID, filter)
+	activities, err := s.activityRepo.GetUserActivities(ctx, userID, filter)
 	if err != nil {
 		return nil, err
 	}
 
-	_ = s.cache.SetExp(ctx, cacheKey, activities, 30*time.Minute)
-	// if cacheErr != nil {
-	// 	log.Printf("[CACHE SET ERROR] Key: %s, Error: %v", cacheKey, cacheErr)
-	// } else {
-	// 	log.Printf("[CACHE SET] Key: %s, Records: %d", cacheKey, len(activities))
-	// }
+	if err := s.cache.SetExp(ctx, cacheKey, activities, 30*time.Minute); err != nil {
+		logger.FromContext(ctx).Warn("failed to cache user activities", "key", cacheKey, "error", err)
+	}
 
-	return activities, nil
+	return activities, s.attachments.Load(ctx, activities)
 }
 
 func (s *ActivityService) UpdateActivity(ctx context.Context, userID uuid.UUID, activityID uuid.UUID, req model.UpdateActivityRequest) (*model.Activity, error) {
+	ctx, span := tracing.Start(ctx, "ActivityService.UpdateActivity", attribute.String("activity.id", activityID.String()))
+	defer span.End()
+
+	return s.updateActivity(ctx, userID, userID, activityID, req)
+}
+
+// updateActivity changes an activity owned by userID, actorID is who asked for it
+func (s *ActivityService) updateActivity(ctx context.Context, actorID, userID uuid.UUID, activityID uuid.UUID, req model.UpdateActivityRequest) (*model.Activity, error) {
 	isUserExists, err := s.checkUserExistsWithCache(ctx, userID)
 	if err != nil {
 		return nil, err
@@ -164,7 +206,10 @@ func (s *ActivityService) UpdateActivity(ctx context.Context, userID uuid.UUID,
 		}
 		existedActivity = &cachedActivity
 	} else {
-		existedActivity, err = s.activityRepo.CheckActivityOwnership(userID, activityID)
+		existedActivity, err = s.activityRepo.CheckActivityOwnership(ctx, userID, activityID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, appErrors.ErrActivityNotFound
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -172,6 +217,7 @@ func (s *ActivityService) UpdateActivity(ctx context.Context, userID uuid.UUID,
 			return nil, appErrors.ErrForbidden
 		}
 	}
+	before := *existedActivity
 
 	if req.ActivityType != nil {
 		existedActivity.ActivityType = *req.ActivityType
@@ -179,23 +225,26 @@ func (s *ActivityService) UpdateActivity(ctx context.Context, userID uuid.UUID,
 	if req.DoneAt != nil {
 		doneAt, err := time.Parse(time.RFC3339, *req.DoneAt)
 		if err != nil {
-			return nil, errors.New("invalid doneAt")
+			return nil, appErrors.ErrInvalidDoneAt.Wrap(err)
 		}
 		existedActivity.DoneAt = doneAt
 	}
 	if req.DurationInMinutes != nil {
 		if *req.DurationInMinutes < 1 {
-			return nil, errors.New("durationInMinutes must be >= 1")
+			return nil, appErrors.ErrInvalidDuration
 		}
 		existedActivity.DurationInMinutes = *req.DurationInMinutes
 	}
+	if req.Visibility != nil {
+		existedActivity.Visibility = *req.Visibility
+	}
 
 	calories, err := s.calculateCalories(&existedActivity.ActivityType, &existedActivity.DurationInMinutes)
 	if err != nil {
 		return nil, err
 	}
 
-	activity, err := s.activityRepo.UpdateActivity(userID, activityID, time.Now(), &req, *calories)
+	activity, err := s.activityRepo.UpdateActivity(ctx, userID, activityID, time.Now(), &req, *calories)
 	if err != nil {
 		return nil, err
 	}
@@ -205,11 +254,29 @@ func (s *ActivityService) UpdateActivity(ctx context.Context, userID uuid.UUID,
 	pattern := s.getUserActivitiesPattern(userID)
 	_ = s.cache.DeletePattern(ctx, pattern)
 
-	return activity, nil
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    actorID,
+		SubjectID:  userID,
+		Action:     "activity.updated",
+		EntityType: "activity",
+		EntityID:   activity.ID.String(),
+		Before:     before,
+		After:      activity,
+	})
+
+	loaded := []model.Activity{*activity}
+	if err := s.attachments.Load(ctx, loaded); err != nil {
+		return nil, err
+	}
+	return &loaded[0], nil
 }
 
 func (s *ActivityService) DeleteActivity(ctx context.Context, activityID uuid.UUID, userID uuid.UUID) error {
-	err := s.activityRepo.DeleteActivity(activityID, userID)
+	ctx, span := tracing.Start(ctx, "ActivityService.DeleteActivity", attribute.String("activity.id", activityID.String()))
+	defer span.End()
+
+	// Attachments go with the activity, releasing their files
+	deleted, err := s.activityRepo.DeleteActivity(ctx, activityID, userID)
 	if err != nil {
 		return err
 	}
@@ -220,9 +287,55 @@ func (s *ActivityService) DeleteActivity(ctx context.Context, activityID uuid.UU
 	pattern := s.getUserActivitiesPattern(userID)
 	_ = s.cache.DeletePattern(ctx, pattern)
 
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    userID,
+		SubjectID:  userID,
+		Action:     "activity.deleted",
+		EntityType: "activity",
+		EntityID:   activityID.String(),
+		Before:     deleted,
+	})
 	return nil
 }
 
+// GetTraineeActivities lists the activities of a trainee for their coach
+func (s *ActivityService) GetTraineeActivities(ctx context.Context, coachID, traineeID uuid.UUID, filter *model.ActivityFilter) ([]model.Activity, error) {
+	ctx, span := tracing.Start(ctx, "ActivityService.GetTraineeActivities")
+	defer span.End()
+
+	if err := s.coaching.CheckAccess(ctx, coachID, traineeID, false); err != nil {
+		return nil, err
+	}
+
+	return s.GetUserActivities(ctx, traineeID, filter)
+}
+
+// CreateTraineeActivity records an activity on behalf of a trainee, the coach
+// is kept in the audit log as the actor
+func (s *ActivityService) CreateTraineeActivity(ctx context.Context, coachID, traineeID uuid.UUID, req model.CreateActivityRequest) (*model.Activity, error) {
+	ctx, span := tracing.Start(ctx, "ActivityService.CreateTraineeActivity")
+	defer span.End()
+
+	if err := s.coaching.CheckAccess(ctx, coachID, traineeID, true); err != nil {
+		return nil, err
+	}
+
+	return s.createActivity(ctx, coachID, traineeID, req)
+}
+
+// UpdateTraineeActivity changes an activity of a trainee, the ownership check
+// of UpdateActivity still applies to the trainee
+func (s *ActivityService) UpdateTraineeActivity(ctx context.Context, coachID, traineeID, activityID uuid.UUID, req model.UpdateActivityRequest) (*model.Activity, error) {
+	ctx, span := tracing.Start(ctx, "ActivityService.UpdateTraineeActivity", attribute.String("activity.id", activityID.String()))
+	defer span.End()
+
+	if err := s.coaching.CheckAccess(ctx, coachID, traineeID, true); err != nil {
+		return nil, err
+	}
+
+	return s.updateActivity(ctx, coachID, traineeID, activityID, req)
+}
+
 func (s *ActivityService) checkUserExistsWithCache(ctx context.Context, userID uuid.UUID) (bool, error) {
 	cacheKey := s.getUserExistsKey(userID)
 
@@ -232,7 +345,7 @@ func (s *ActivityService) checkUserExistsWithCache(ctx context.Context, userID u
 		return exists, nil
 	}
 
-	isUserExists, err := s.activityRepo.CheckExistedUserById(userID)
+	isUserExists, err := s.activityRepo.CheckExistedUserById(ctx, userID)
 	if err != nil {
 		return false, err
 	}
@@ -242,9 +355,7 @@ func (s *ActivityService) checkUserExistsWithCache(ctx context.Context, userID u
 	return isUserExists, nil
 }
 
-func (s *ActivityService) GetActivityByID(userID uuid.UUID, activityID uuid.UUID) (*model.Activity, error) {
-	ctx := context.Background()
-
+func (s *ActivityService) GetActivityByID(ctx context.Context, userID uuid.UUID, activityID uuid.UUID) (*model.Activity, error) {
 	activityKey := s.getActivityKey(activityID)
 	var cachedActivity model.Activity
 
@@ -256,7 +367,10 @@ func (s *ActivityService) GetActivityByID(userID uuid.UUID, activityID uuid.UUID
 		return &cachedActivity, nil
 	}
 
-	activity, err := s.activityRepo.CheckActivityOwnership(userID, activityID)
+	activity, err := s.activityRepo.CheckActivityOwnership(ctx, userID, activityID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, appErrors.ErrActivityNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
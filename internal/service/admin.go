@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/tracing"
+)
+
+// AdminService backs the /admin routes, every call is made on behalf of
+// actorID and changes are written to the audit log
+type AdminService struct {
+	userRepo   *repository.UserRepository
+	activities *ActivityService
+	sessions   *SessionService
+	audit      *AuditService
+}
+
+func NewAdminService(userRepo *repository.UserRepository, activities *ActivityService, sessions *SessionService, audit *AuditService) *AdminService {
+	return &AdminService{
+		userRepo:   userRepo,
+		activities: activities,
+		sessions:   sessions,
+		audit:      audit,
+	}
+}
+
+func (s *AdminService) ListUsers(ctx context.Context, filter model.AdminUserFilter) ([]model.AdminUser, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.ListUsers")
+	defer span.End()
+
+	return s.userRepo.SearchUsers(ctx, filter)
+}
+
+// SetRole changes the role and signs the user out so the next token carries it
+func (s *AdminService) SetRole(ctx context.Context, actorID, userID uuid.UUID, role model.Role) error {
+	ctx, span := tracing.Start(ctx, "AdminService.SetRole")
+	defer span.End()
+
+	user, err := s.getManagedUser(ctx, actorID, userID)
+	if err != nil {
+		return err
+	}
+	if user.Role == role {
+		return nil
+	}
+
+	if err := s.userRepo.UpdateRole(ctx, userID, role); err != nil {
+		return err
+	}
+	if err := s.sessions.Revoke(ctx, userID); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    actorID,
+		SubjectID:  userID,
+		Action:     "user.role_changed",
+		EntityType: "user",
+		EntityID:   userID.String(),
+		Before:     map[string]model.Role{"role": user.Role},
+		After:      map[string]model.Role{"role": role},
+	})
+	return nil
+}
+
+func (s *AdminService) DisableUser(ctx context.Context, actorID, userID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "AdminService.DisableUser")
+	defer span.End()
+
+	user, err := s.getManagedUser(ctx, actorID, userID)
+	if err != nil {
+		return err
+	}
+	if user.DisabledAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if err := s.userRepo.SetDisabled(ctx, userID, &now); err != nil {
+		return err
+	}
+	if err := s.sessions.Revoke(ctx, userID); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, AuditEvent{ActorID: actorID, SubjectID: userID, Action: "user.disabled", EntityType: "user", EntityID: userID.String()})
+	return nil
+}
+
+func (s *AdminService) EnableUser(ctx context.Context, actorID, userID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "AdminService.EnableUser")
+	defer span.End()
+
+	user, err := s.getManagedUser(ctx, actorID, userID)
+	if err != nil {
+		return err
+	}
+	if user.DisabledAt == nil {
+		return nil
+	}
+
+	if err := s.userRepo.SetDisabled(ctx, userID, nil); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, AuditEvent{ActorID: actorID, SubjectID: userID, Action: "user.enabled", EntityType: "user", EntityID: userID.String()})
+	return nil
+}
+
+// GetUserActivities reads another user's activities, the access is audited
+func (s *AdminService) GetUserActivities(ctx context.Context, actorID, userID uuid.UUID, filter *model.ActivityFilter) ([]model.Activity, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.GetUserActivities")
+	defer span.End()
+
+	if _, err := s.userRepo.GetUserAuth(ctx, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, appErrors.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	activities, err := s.activities.GetUserActivities(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, AuditEvent{ActorID: actorID, SubjectID: userID, Action: "user.activities_viewed", EntityType: "user", EntityID: userID.String()})
+	return activities, nil
+}
+
+func (s *AdminService) ListAudit(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.ListAudit")
+	defer span.End()
+
+	return s.audit.List(ctx, filter)
+}
+
+// getManagedUser loads userID, admins cannot lock themselves out
+func (s *AdminService) getManagedUser(ctx context.Context, actorID, userID uuid.UUID) (model.User, error) {
+	if actorID == userID {
+		return model.User{}, appErrors.ErrAccessDenied.WithMessage("admins cannot change their own account")
+	}
+
+	user, err := s.userRepo.GetUserAuth(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.User{}, appErrors.ErrUserNotFound
+	}
+	if err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/imaging"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/tracing"
+)
+
+const (
+	// MaxAttachmentsPerActivity bounds how many files one activity carries
+	MaxAttachmentsPerActivity = 10
+	// attachmentNameMaxLength matches activity_attachments.name
+	attachmentNameMaxLength = 255
+)
+
+// AttachmentService attaches photos, route screenshots and workout sheets to
+// activities. Images go through the same sanitizing as profile pictures, PDF
+// documents are stored as they are.
+type AttachmentService struct {
+	repo         *repository.AttachmentRepository
+	activityRepo *repository.ActivityRepository
+	images       *ImageService
+	files        *FileService
+	audit        *AuditService
+}
+
+func NewAttachmentService(repo *repository.AttachmentRepository, activityRepo *repository.ActivityRepository, images *ImageService, files *FileService, audit *AuditService) *AttachmentService {
+	return &AttachmentService{
+		repo:         repo,
+		activityRepo: activityRepo,
+		images:       images,
+		files:        files,
+		audit:        audit,
+	}
+}
+
+func (s *AttachmentService) Upload(ctx context.Context, userID, activityID uuid.UUID, name string, file io.Reader) (*model.ActivityAttachment, error) {
+	ctx, span := tracing.Start(ctx, "AttachmentService.Upload")
+	defer span.End()
+
+	if err := s.checkCapacity(ctx, userID, activityID); err != nil {
+		return nil, err
+	}
+
+	data, err := readImage(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored *model.File
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png":
+		stored, err = s.images.StoreFile(ctx, userID, data)
+	case "application/pdf":
+		stored, err = s.files.Store(ctx, userID, "application/pdf", ".pdf", map[string][]byte{imaging.OriginalVariant: data})
+	default:
+		err = appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "file", Tag: "mimetype", Message: "only JPEG, PNG and PDF files are allowed"})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.attach(ctx, userID, activityID, stored, name)
+}
+
+// AttachFile attaches a file userID uploaded before, like a finished
+// resumable upload
+func (s *AttachmentService) AttachFile(ctx context.Context, userID, activityID uuid.UUID, req model.AttachFileRequest) (*model.ActivityAttachment, error) {
+	ctx, span := tracing.Start(ctx, "AttachmentService.AttachFile")
+	defer span.End()
+
+	if err := s.checkCapacity(ctx, userID, activityID); err != nil {
+		return nil, err
+	}
+
+	file, err := s.files.Owned(ctx, userID, req.FileID)
+	if err != nil {
+		return nil, err
+	}
+	name := req.Name
+	if name == "" {
+		name = path.Base(file.Objects[imaging.OriginalVariant])
+	}
+	return s.attach(ctx, userID, activityID, file, name)
+}
+
+func (s *AttachmentService) attach(ctx context.Context, userID, activityID uuid.UUID, stored *model.File, name string) (*model.ActivityAttachment, error) {
+	attachment := &model.ActivityAttachment{
+		ID:          uuid.New(),
+		ActivityID:  activityID,
+		FileID:      stored.ID,
+		Name:        attachmentName(name),
+		ContentType: stored.ContentType,
+		Size:        stored.Size,
+		CreatedAt:   time.Now(),
+		ScanStatus:  stored.ScanStatus,
+		Objects:     stored.Objects,
+	}
+	// The reference comes first: deleting the activity releases the files of
+	// its attachments, an attachment without one would keep its file forever
+	if err := s.files.SetReference(ctx, FileReferenceActivityAttachment, attachment.ID.String(), stored); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, attachment); err != nil {
+		if releaseErr := s.files.SetReference(ctx, FileReferenceActivityAttachment, attachment.ID.String(), nil); releaseErr != nil {
+			logger.FromContext(ctx).Error("failed to release attachment file", "attachment_id", attachment.ID.String(), "error", releaseErr)
+		}
+		return nil, err
+	}
+	if err := s.sign(ctx, attachment); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    userID,
+		SubjectID:  userID,
+		Action:     "activity.attachment_added",
+		EntityType: "activity",
+		EntityID:   activityID.String(),
+		After:      attachment,
+	})
+	return attachment, nil
+}
+
+func (s *AttachmentService) List(ctx context.Context, userID, activityID uuid.UUID) ([]model.ActivityAttachment, error) {
+	ctx, span := tracing.Start(ctx, "AttachmentService.List")
+	defer span.End()
+
+	if err := s.checkOwnership(ctx, userID, activityID); err != nil {
+		return nil, err
+	}
+
+	activities := []model.Activity{{ID: activityID}}
+	if err := s.Load(ctx, activities); err != nil {
+		return nil, err
+	}
+	return activities[0].Attachments, nil
+}
+
+func (s *AttachmentService) Delete(ctx context.Context, userID, activityID, attachmentID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "AttachmentService.Delete")
+	defer span.End()
+
+	if err := s.checkOwnership(ctx, userID, activityID); err != nil {
+		return err
+	}
+
+	deleted, err := s.repo.Delete(ctx, attachmentID, activityID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return appErrors.ErrAttachmentNotFound
+	}
+	if err := s.files.SetReference(ctx, FileReferenceActivityAttachment, attachmentID.String(), nil); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    userID,
+		SubjectID:  userID,
+		Action:     "activity.attachment_removed",
+		EntityType: "activity",
+		EntityID:   activityID.String(),
+		Metadata:   map[string]string{"attachmentId": attachmentID.String()},
+	})
+	return nil
+}
+
+// Load fills the attachments of activities, with fresh links, in one query
+func (s *AttachmentService) Load(ctx context.Context, activities []model.Activity) error {
+	ids := make([]uuid.UUID, 0, len(activities))
+	for _, activity := range activities {
+		ids = append(ids, activity.ID)
+	}
+
+	attachments, err := s.repo.ListByActivities(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	byActivity := make(map[uuid.UUID][]model.ActivityAttachment, len(activities))
+	for i := range attachments {
+		if err := s.sign(ctx, &attachments[i]); err != nil {
+			return err
+		}
+		byActivity[attachments[i].ActivityID] = append(byActivity[attachments[i].ActivityID], attachments[i])
+	}
+	for i := range activities {
+		activities[i].Attachments = byActivity[activities[i].ID]
+		if activities[i].Attachments == nil {
+			activities[i].Attachments = []model.ActivityAttachment{}
+		}
+	}
+	return nil
+}
+
+// checkCapacity makes sure userID may add another attachment to the activity
+func (s *AttachmentService) checkCapacity(ctx context.Context, userID, activityID uuid.UUID) error {
+	if err := s.checkOwnership(ctx, userID, activityID); err != nil {
+		return err
+	}
+	count, err := s.repo.CountByActivity(ctx, activityID)
+	if err != nil {
+		return err
+	}
+	if count >= MaxAttachmentsPerActivity {
+		return appErrors.ErrTooManyAttachments
+	}
+	return nil
+}
+
+func (s *AttachmentService) checkOwnership(ctx context.Context, userID, activityID uuid.UUID) error {
+	_, err := s.activityRepo.CheckActivityOwnership(ctx, userID, activityID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return appErrors.ErrActivityNotFound
+	}
+	return err
+}
+
+func (s *AttachmentService) sign(ctx context.Context, attachment *model.ActivityAttachment) error {
+	file := &model.File{ID: attachment.FileID, Objects: attachment.Objects, ScanStatus: attachment.ScanStatus}
+	attachment.URI = s.files.URL(file, imaging.OriginalVariant)
+
+	var err error
+	attachment.Links, err = s.files.SignedURLs(ctx, file)
+	return err
+}
+
+// attachmentName keeps the base name of the uploaded file without control
+// characters
+func attachmentName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+
+	runes := []rune(name)
+	if len(runes) > attachmentNameMaxLength {
+		name = string(runes[:attachmentNameMaxLength])
+	}
+	return name
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/repository"
+)
+
+// userAgentMaxLength matches audit_log.user_agent, in characters
+const userAgentMaxLength = 512
+
+type clientInfoKey struct{}
+
+// ClientInfo identifies the client a request came from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// WithClientInfo stores the client of the current request for audit entries
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+func clientInfoFromContext(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
+
+// auditUserAgent makes a header Postgres accepts into the column: invalid
+// UTF-8 is replaced and the length is cut on a character boundary
+func auditUserAgent(userAgent string) string {
+	userAgent = strings.ToValidUTF8(userAgent, "\uFFFD")
+	runes := []rune(userAgent)
+	if len(runes) > userAgentMaxLength {
+		userAgent = string(runes[:userAgentMaxLength])
+	}
+	return userAgent
+}
+
+// AuditEvent describes one change for Record. Before and After are snapshots
+// of the entity, only the fields that differ end up in the log.
+type AuditEvent struct {
+	ActorID uuid.UUID
+	// SubjectID is the user the change concerns, it makes the entry visible to them
+	SubjectID  uuid.UUID
+	Action     string
+	EntityType string
+	EntityID   string
+	Before     any
+	After      any
+	Metadata   any
+}
+
+// AuditService writes the append-only audit log
+type AuditService struct {
+	repo *repository.AuditRepository
+}
+
+func NewAuditService(repo *repository.AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record stores an entry. The action already happened, so a failure is logged
+// instead of failing the request.
+func (s *AuditService) Record(ctx context.Context, event AuditEvent) {
+	entry := &model.AuditEntry{
+		ID:         uuid.New(),
+		Action:     event.Action,
+		EntityType: event.EntityType,
+		CreatedAt:  time.Now(),
+	}
+	if event.ActorID != uuid.Nil {
+		entry.ActorID = &event.ActorID
+	}
+	if event.SubjectID != uuid.Nil {
+		entry.SubjectID = &event.SubjectID
+	}
+	if event.EntityID != "" {
+		entry.EntityID = &event.EntityID
+	}
+
+	client := clientInfoFromContext(ctx)
+	if client.IP != "" {
+		entry.IPAddress = &client.IP
+	}
+	if client.UserAgent != "" {
+		userAgent := auditUserAgent(client.UserAgent)
+		entry.UserAgent = &userAgent
+	}
+
+	var err error
+	if entry.Before, entry.After, err = diffSnapshots(event.Before, event.After); err == nil {
+		entry.Metadata, err = encodeAuditJSON(event.Metadata)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to encode audit entry", "action", event.Action, "error", err)
+	}
+
+	if err := s.repo.CreateEntry(ctx, entry); err != nil {
+		logger.FromContext(ctx).Error("failed to write audit entry", "action", event.Action, "entity_id", event.EntityID, "error", err)
+	}
+}
+
+// ListForUser returns the entries about userID. IP address and user agent of
+// other actors, like admins, are not disclosed.
+func (s *AuditService) ListForUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]model.AuditEntry, error) {
+	entries, err := s.repo.ListEntries(ctx, model.AuditFilter{SubjectID: &userID, Limit: limit, Offset: offset})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		if entries[i].ActorID == nil || *entries[i].ActorID != userID {
+			entries[i].IPAddress = nil
+			entries[i].UserAgent = nil
+		}
+	}
+	return entries, nil
+}
+
+func (s *AuditService) List(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	return s.repo.ListEntries(ctx, filter)
+}
+
+func encodeAuditJSON(v any) (*json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	msg := json.RawMessage(raw)
+	return &msg, nil
+}
+
+// diffSnapshots drops the fields both snapshots agree on. Snapshots that are
+// not JSON objects are kept whole.
+func diffSnapshots(before, after any) (*json.RawMessage, *json.RawMessage, error) {
+	if before != nil && after != nil {
+		var beforeFields, afterFields map[string]any
+		if err := remarshal(before, &beforeFields); err != nil {
+			return nil, nil, err
+		}
+		if err := remarshal(after, &afterFields); err != nil {
+			return nil, nil, err
+		}
+
+		if beforeFields != nil && afterFields != nil {
+			for key, value := range beforeFields {
+				if other, ok := afterFields[key]; ok && reflect.DeepEqual(value, other) {
+					delete(beforeFields, key)
+					delete(afterFields, key)
+				}
+			}
+			before, after = beforeFields, afterFields
+		}
+	}
+
+	b, err := encodeAuditJSON(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := encodeAuditJSON(after)
+	return b, a, err
+}
+
+// remarshal converts v to its JSON form, out stays nil when v is not an object
+func remarshal(v any, out *map[string]any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(raw) == 0 || raw[0] != '{' {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
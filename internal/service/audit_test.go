@@ -0,0 +1,36 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestAuditUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{"short", "curl/8.5.0", "curl/8.5.0"},
+		{"at limit", strings.Repeat("a", userAgentMaxLength), strings.Repeat("a", userAgentMaxLength)},
+		{"over limit", strings.Repeat("a", userAgentMaxLength+10), strings.Repeat("a", userAgentMaxLength)},
+		// 511 ASCII bytes then a 3 byte rune, a byte cut would split it
+		{"rune across the byte limit", strings.Repeat("a", userAgentMaxLength-1) + "日本", strings.Repeat("a", userAgentMaxLength-1) + "日"},
+		{"multi-byte under the character limit", strings.Repeat("日", userAgentMaxLength), strings.Repeat("日", userAgentMaxLength)},
+		{"multi-byte over the character limit", strings.Repeat("日", userAgentMaxLength+1), strings.Repeat("日", userAgentMaxLength)},
+		{"invalid utf-8", "agent\xff\xfe/1.0", "agent�/1.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := auditUserAgent(tt.userAgent)
+			if got != tt.want {
+				t.Errorf("auditUserAgent() = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) || utf8.RuneCountInString(got) > userAgentMaxLength {
+				t.Errorf("auditUserAgent() = %q is not valid for the column", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/tracing"
+)
+
+// CoachingService links coaches to trainees. A coach invites a trainee by
+// email and the link only grants access once the trainee accepted it.
+type CoachingService struct {
+	repo     *repository.CoachingRepository
+	userRepo *repository.UserRepository
+	audit    *AuditService
+}
+
+func NewCoachingService(repo *repository.CoachingRepository, userRepo *repository.UserRepository, audit *AuditService) *CoachingService {
+	return &CoachingService{
+		repo:     repo,
+		userRepo: userRepo,
+		audit:    audit,
+	}
+}
+
+func (s *CoachingService) Invite(ctx context.Context, coachID uuid.UUID, req model.CoachingInvitationRequest) (*model.CoachingRelationship, error) {
+	ctx, span := tracing.Start(ctx, "CoachingService.Invite")
+	defer span.End()
+
+	trainee, err := s.userRepo.GetUserByEmail(ctx, req.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, appErrors.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if trainee.DeletedAt != nil || trainee.DisabledAt != nil {
+		return nil, appErrors.ErrUserNotFound
+	}
+	if trainee.ID == coachID {
+		return nil, appErrors.ErrAccessDenied.WithMessage("you cannot coach yourself")
+	}
+
+	rel := &model.CoachingRelationship{
+		ID:        uuid.New(),
+		CoachID:   coachID,
+		TraineeID: trainee.ID,
+		Scope:     req.Scope,
+		Status:    model.CoachingStatusPending,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.CreateInvitation(ctx, rel); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    coachID,
+		SubjectID:  trainee.ID,
+		Action:     "coaching.invited",
+		EntityType: "coaching",
+		EntityID:   rel.ID.String(),
+		After:      rel,
+	})
+	return s.repo.GetRelationship(ctx, rel.ID)
+}
+
+// List returns the invitations and links of userID from both sides
+func (s *CoachingService) List(ctx context.Context, userID uuid.UUID) ([]model.CoachingRelationship, error) {
+	ctx, span := tracing.Start(ctx, "CoachingService.List")
+	defer span.End()
+
+	return s.repo.ListForUser(ctx, userID)
+}
+
+// Accept is called by the invited trainee
+func (s *CoachingService) Accept(ctx context.Context, traineeID, relationshipID uuid.UUID) (*model.CoachingRelationship, error) {
+	ctx, span := tracing.Start(ctx, "CoachingService.Accept")
+	defer span.End()
+
+	accepted, err := s.repo.Accept(ctx, relationshipID, traineeID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !accepted {
+		return nil, appErrors.ErrCoachingNotFound
+	}
+
+	s.audit.Record(ctx, AuditEvent{ActorID: traineeID, SubjectID: traineeID, Action: "coaching.accepted", EntityType: "coaching", EntityID: relationshipID.String()})
+	return s.repo.GetRelationship(ctx, relationshipID)
+}
+
+// Remove lets either side decline, withdraw or end a relationship
+func (s *CoachingService) Remove(ctx context.Context, userID, relationshipID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "CoachingService.Remove")
+	defer span.End()
+
+	removed, err := s.repo.Delete(ctx, relationshipID, userID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return appErrors.ErrCoachingNotFound
+	}
+
+	s.audit.Record(ctx, AuditEvent{ActorID: userID, SubjectID: userID, Action: "coaching.removed", EntityType: "coaching", EntityID: relationshipID.String()})
+	return nil
+}
+
+// CheckAccess fails unless coachID actively coaches traineeID with a scope
+// that covers the request
+func (s *CoachingService) CheckAccess(ctx context.Context, coachID, traineeID uuid.UUID, write bool) error {
+	scope, err := s.repo.GetActiveScope(ctx, coachID, traineeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return appErrors.ErrAccessDenied
+	}
+	if err != nil {
+		return err
+	}
+	if write && scope != model.CoachingScopeReadWrite {
+		return appErrors.ErrCoachingReadOnly
+	}
+	return nil
+}
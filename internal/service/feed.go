@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/cache"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/tracing"
+)
+
+const (
+	// feedCacheTTL bounds how long a new or changed activity takes to show
+	// up in followers' feeds, which are built on read and not evicted then
+	feedCacheTTL = time.Minute
+	// maxFeedDepth is how far back the feed can be paged
+	maxFeedDepth = 1000
+)
+
+// FeedService lets users follow each other and builds the feed of the
+// activities they may see from the users they follow
+type FeedService struct {
+	follows     *repository.FollowRepository
+	activities  *repository.ActivityRepository
+	userRepo    *repository.UserRepository
+	cache       *cache.Redis
+	files       *FileService
+	attachments *AttachmentService
+	audit       *AuditService
+}
+
+func NewFeedService(follows *repository.FollowRepository, activities *repository.ActivityRepository, userRepo *repository.UserRepository, cache *cache.Redis, files *FileService, attachments *AttachmentService, audit *AuditService) *FeedService {
+	return &FeedService{
+		follows:     follows,
+		activities:  activities,
+		userRepo:    userRepo,
+		cache:       cache,
+		files:       files,
+		attachments: attachments,
+		audit:       audit,
+	}
+}
+
+func (s *FeedService) getFeedKey(userID uuid.UUID, limit, offset int) string {
+	return fmt.Sprintf("feed:%s_limit_%d_offset_%d", userID.String(), limit, offset)
+}
+
+func (s *FeedService) getFeedPattern(userID uuid.UUID) string {
+	return fmt.Sprintf("feed:%s*", userID.String())
+}
+
+// Follow makes userID follow the user with the email, following someone
+// again changes nothing
+func (s *FeedService) Follow(ctx context.Context, userID uuid.UUID, req model.FollowRequest) (*model.Follow, error) {
+	ctx, span := tracing.Start(ctx, "FeedService.Follow")
+	defer span.End()
+
+	followee, err := s.userRepo.GetUserByEmail(ctx, req.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, appErrors.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if followee.DeletedAt != nil || followee.DisabledAt != nil {
+		return nil, appErrors.ErrUserNotFound
+	}
+	if followee.ID == userID {
+		return nil, appErrors.ErrAccessDenied.WithMessage("you cannot follow yourself")
+	}
+
+	if err := s.follows.Create(ctx, userID, followee.ID, time.Now()); err != nil {
+		return nil, err
+	}
+	s.evictFeeds(ctx, userID, followee.ID)
+
+	follow, err := s.follows.Get(ctx, userID, followee.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    userID,
+		SubjectID:  userID,
+		Action:     "follow.created",
+		EntityType: "follow",
+		EntityID:   followee.ID.String(),
+	})
+	s.sign(ctx, follow)
+	return follow, nil
+}
+
+func (s *FeedService) Unfollow(ctx context.Context, userID, followeeID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "FeedService.Unfollow")
+	defer span.End()
+
+	deleted, err := s.follows.Delete(ctx, userID, followeeID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return appErrors.ErrNotFollowing
+	}
+	s.evictFeeds(ctx, userID, followeeID)
+
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    userID,
+		SubjectID:  userID,
+		Action:     "follow.deleted",
+		EntityType: "follow",
+		EntityID:   followeeID.String(),
+	})
+	return nil
+}
+
+func (s *FeedService) ListFollowing(ctx context.Context, userID uuid.UUID, limit, offset int) ([]model.Follow, error) {
+	ctx, span := tracing.Start(ctx, "FeedService.ListFollowing")
+	defer span.End()
+
+	follows, err := s.follows.ListFollowing(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := range follows {
+		s.sign(ctx, &follows[i])
+	}
+	return follows, nil
+}
+
+func (s *FeedService) ListFollowers(ctx context.Context, userID uuid.UUID, limit, offset int) ([]model.Follow, error) {
+	ctx, span := tracing.Start(ctx, "FeedService.ListFollowers")
+	defer span.End()
+
+	follows, err := s.follows.ListFollowers(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := range follows {
+		s.sign(ctx, &follows[i])
+	}
+	return follows, nil
+}
+
+// Feed returns a page of the activities userID may see from the users they
+// follow, newest first: public ones, and friends ones when the follow goes
+// both ways
+func (s *FeedService) Feed(ctx context.Context, userID uuid.UUID, limit, offset int) ([]model.FeedItem, error) {
+	ctx, span := tracing.Start(ctx, "FeedService.Feed")
+	defer span.End()
+
+	if offset >= maxFeedDepth {
+		return []model.FeedItem{}, nil
+	}
+	limit = min(limit, maxFeedDepth-offset)
+
+	cacheKey := s.getFeedKey(userID, limit, offset)
+	var items []model.FeedItem
+	err := s.cache.GetAs(ctx, cacheKey, &items)
+	if err == nil {
+		logger.FromContext(ctx).Debug("cache hit", "key", cacheKey)
+	} else {
+		logger.FromContext(ctx).Debug("cache miss", "key", cacheKey, "error", err)
+
+		items, err = s.activities.GetFeed(ctx, userID, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.cache.SetExp(ctx, cacheKey, items, feedCacheTTL); err != nil {
+			logger.FromContext(ctx).Warn("failed to cache feed", "key", cacheKey, "error", err)
+		}
+	}
+
+	// Links expire, so they are added after the cache
+	activities := make([]model.Activity, len(items))
+	for i := range items {
+		activities[i] = items[i].Activity
+	}
+	if err := s.attachments.Load(ctx, activities); err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].Attachments = activities[i].Attachments
+		if items[i].AuthorImageUri != nil {
+			signed := s.files.SignURI(ctx, *items[i].AuthorImageUri)
+			items[i].AuthorImageUri = &signed
+		}
+	}
+	return items, nil
+}
+
+// evictFeeds drops the cached feeds of both sides of a follow, the friends
+// activities either may see depend on it
+func (s *FeedService) evictFeeds(ctx context.Context, userIDs ...uuid.UUID) {
+	for _, userID := range userIDs {
+		if err := s.cache.DeletePattern(ctx, s.getFeedPattern(userID)); err != nil {
+			logger.FromContext(ctx).Warn("failed to evict feed", "user_id", userID.String(), "error", err)
+		}
+	}
+}
+
+func (s *FeedService) sign(ctx context.Context, follow *model.Follow) {
+	if follow.ImageUri != nil {
+		signed := s.files.SignURI(ctx, *follow.ImageUri)
+		follow.ImageUri = &signed
+	}
+}
@@ -1,49 +1,600 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
-	"fmt"
-	"mime/multipart"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/imaging"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/metrics"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/scanner"
+	"github.com/insanjati/fitbyte/internal/storage"
+	"github.com/insanjati/fitbyte/internal/tracing"
 )
 
-type FileStorage interface {
-	Upload(ctx context.Context, objectKey, contentType string, file multipart.File, size int64) (string, error)
+// collectBatchSize bounds how many files one garbage collection run removes
+const collectBatchSize = 100
+
+const (
+	// scanBatchSize bounds how many files one scan run claims
+	scanBatchSize = 20
+	// scanLease is how long a claimed scan is left to its worker before another
+	// one retries it
+	scanLease = 5 * time.Minute
+	// maxScanAttempts is how often a file is tried before it is marked failed
+	maxScanAttempts = 5
+)
+
+// Entity types that reference files, deleting an activity releases
+// attachments by the same name in the repository
+const (
+	FileReferenceUserImage          = "user_image"
+	FileReferenceActivityAttachment = "activity_attachment"
+)
+
+type FileConfig struct {
+	// BaseURL is where GET /file/:fileId is served, stored file URLs start with it
+	BaseURL string
+	// SignedURLTTL is how long links to private objects stay valid
+	SignedURLTTL time.Duration
+	// GCGracePeriod is how long a file stays unreferenced before it is removed,
+	// it gives clients time to use a fresh upload
+	GCGracePeriod time.Duration
+	GCInterval    time.Duration
+	// ScanInterval is how often quarantined uploads are looked for, new
+	// uploads wake the scanner right away
+	ScanInterval time.Duration
+	// Quotas limits what users of each role store, roles without an entry
+	// are unlimited
+	Quotas map[model.Role]model.StorageQuota
 }
 
+// FileService tracks who uploaded which file, who may see it, what uses it,
+// and removes the files nothing uses anymore. Objects are private, clients
+// get short-lived signed links. With a scanner, uploads wait in quarantine
+// until the scan promotes them.
 type FileService struct {
-	db      *sql.DB
-	storage FileStorage
+	repo     *repository.FileRepository
+	storage  storage.Storage
+	coaching *CoachingService
+	scanner  scanner.Scanner
+	scanWake chan struct{}
+	config   FileConfig
+}
+
+// NewFileService stores uploads unscanned when scanner is nil
+func NewFileService(repo *repository.FileRepository, storage storage.Storage, coaching *CoachingService, scanner scanner.Scanner, config FileConfig) *FileService {
+	return &FileService{
+		repo:     repo,
+		storage:  storage,
+		coaching: coaching,
+		scanner:  scanner,
+		scanWake: make(chan struct{}, 1),
+		config:   config,
+	}
+}
+
+// servable reports whether the objects of a file may be handed out
+func servable(status model.ScanStatus) bool {
+	return status == model.ScanStatusClean || status == model.ScanStatusUnscanned
 }
 
-func NewFileService(db *sql.DB, storage FileStorage) *FileService {
-	return &FileService{db: db, storage: storage}
+// URL is the stable address of a file variant, it redirects to a signed link
+func (s *FileService) URL(file *model.File, variant string) string {
+	uri := s.config.BaseURL + "/" + file.ID.String()
+	if variant != imaging.OriginalVariant {
+		uri += "?" + url.Values{"variant": {variant}}.Encode()
+	}
+	return uri
 }
 
-func (s *FileService) UploadFile(ctx context.Context, userID uuid.UUID, fh *multipart.FileHeader) (string, error) {
-	file, err := fh.Open()
+// SignedURL returns a short-lived link to an object of a file
+func (s *FileService) SignedURL(ctx context.Context, objectName string) (string, error) {
+	return s.storage.PresignedGet(ctx, objectName, s.config.SignedURLTTL)
+}
+
+// SignedURLs returns a short-lived link to every variant of file, none while
+// the file is not servable
+func (s *FileService) SignedURLs(ctx context.Context, file *model.File) (map[string]string, error) {
+	links := make(map[string]string, len(file.Objects))
+	if !servable(file.ScanStatus) {
+		return links, nil
+	}
+	for variant, object := range file.Objects {
+		link, err := s.SignedURL(ctx, object)
+		if err != nil {
+			return nil, err
+		}
+		links[variant] = link
+	}
+	return links, nil
+}
+
+// SignURI swaps a stored file URL for a signed link, URLs outside the store
+// are returned as they are, and so are files the scan has not let through
+func (s *FileService) SignURI(ctx context.Context, uri string) string {
+	file, object, err := s.lookup(ctx, uri)
+	if err != nil || object == "" || file != nil && !servable(file.ScanStatus) {
+		return uri
+	}
+
+	signed, err := s.SignedURL(ctx, object)
 	if err != nil {
-		return "", err
+		logger.FromContext(ctx).Warn("failed to sign file url", "object", object, "error", err)
+		return uri
 	}
-	defer file.Close()
+	return signed
+}
 
-	objectKey := fmt.Sprintf("uploads/%s_%s", userID.String(), fh.Filename)
+// Download returns a signed link to a variant of the file when viewerID may
+// see it: the owner, an admin, or a coach of the owner
+func (s *FileService) Download(ctx context.Context, viewerID uuid.UUID, role model.Role, fileID uuid.UUID, variant string) (string, error) {
+	ctx, span := tracing.Start(ctx, "FileService.Download")
+	defer span.End()
 
-	key, err := s.storage.Upload(ctx, objectKey, fh.Header.Get("Content-Type"), file, fh.Size)
+	file, err := s.get(ctx, viewerID, role, fileID)
 	if err != nil {
 		return "", err
 	}
 
-	// Save metadata in DB
-	_, err = s.db.ExecContext(ctx, `
-        INSERT INTO files (user_id, object_key, mime_type, size)
-        VALUES ($1, $2, $3, $4)`,
-		userID, key, fh.Header.Get("Content-Type"), fh.Size)
+	switch file.ScanStatus {
+	case model.ScanStatusPending:
+		return "", appErrors.ErrFilePending
+	case model.ScanStatusInfected, model.ScanStatusFailed:
+		return "", appErrors.ErrFileRejected
+	}
+
+	object, ok := file.Objects[variant]
+	if !ok {
+		return "", appErrors.ErrFileNotFound
+	}
+	return s.SignedURL(ctx, object)
+}
+
+// Metadata returns the file, its scan status included, to whoever may
+// download it
+func (s *FileService) Metadata(ctx context.Context, viewerID uuid.UUID, role model.Role, fileID uuid.UUID) (*model.File, error) {
+	ctx, span := tracing.Start(ctx, "FileService.Metadata")
+	defer span.End()
+
+	return s.get(ctx, viewerID, role, fileID)
+}
+
+func (s *FileService) get(ctx context.Context, viewerID uuid.UUID, role model.Role, fileID uuid.UUID) (*model.File, error) {
+	file, err := s.repo.GetByID(ctx, fileID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, appErrors.ErrFileNotFound
+	}
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if file.OwnerID != viewerID && role != model.RoleAdmin {
+		// Files of others are reported missing rather than forbidden
+		err := s.coaching.CheckAccess(ctx, viewerID, file.OwnerID, false)
+		if errors.Is(err, appErrors.ErrAccessDenied) {
+			return nil, appErrors.ErrFileNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+// Store records a new file owned by ownerID and uploads its variants, keyed
+// by variant name, to uploads/<owner>/<file id>/<variant><extension>. With a
+// scanner they go to quarantine first and the file stays pending.
+func (s *FileService) Store(ctx context.Context, ownerID uuid.UUID, contentType, extension string, variants map[string][]byte) (*model.File, error) {
+	file := &model.File{
+		ID:          uuid.New(),
+		OwnerID:     ownerID,
+		ContentType: contentType,
+		Objects:     make(map[string]string, len(variants)),
+		CreatedAt:   time.Now(),
+	}
+	for name, data := range variants {
+		file.Objects[name] = storage.UserObjectName(ownerID, file.ID.String()+"/"+name+extension)
+		file.Size += int64(len(data))
+	}
+
+	// The row comes first so objects of a failed upload are collected later
+	quarantined := s.scanner != nil
+	if err := s.Register(ctx, file, quarantined); err != nil {
+		return nil, err
+	}
+	for name, data := range variants {
+		object, _ := s.UploadTarget(ownerID, file.Objects[name])
+		if err := s.storage.PutObject(ctx, object, contentType, bytes.NewReader(data), int64(len(data))); err != nil {
+			return nil, err
+		}
+	}
+
+	s.queueScan(file)
+	return file, nil
+}
+
+// UploadTarget is where an object of a new file is written: its served name,
+// or its quarantine when uploads are scanned
+func (s *FileService) UploadTarget(ownerID uuid.UUID, objectName string) (string, bool) {
+	if s.scanner == nil {
+		return objectName, false
+	}
+	return storage.QuarantineObjectName(ownerID, objectName), true
+}
+
+// Register records a file whose objects the caller writes itself, to the
+// names UploadTarget gave, within the storage quota of its owner
+func (s *FileService) Register(ctx context.Context, file *model.File, quarantined bool) error {
+	file.ScanStatus = model.ScanStatusUnscanned
+	if quarantined {
+		file.ScanStatus = model.ScanStatusPending
 	}
 
-	return key, nil
+	created, err := s.repo.CreateWithinQuota(ctx, file, s.config.Quotas)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return appErrors.ErrStorageQuotaExceeded
+	}
+	return nil
+}
+
+// queueScan wakes the scanner once the objects of a pending file are written
+func (s *FileService) queueScan(file *model.File) {
+	if file.ScanStatus != model.ScanStatusPending {
+		return
+	}
+	select {
+	case s.scanWake <- struct{}{}:
+	default:
+	}
+}
+
+// Owned returns a file of ownerID that may be used, for attaching it
+func (s *FileService) Owned(ctx context.Context, ownerID, fileID uuid.UUID) (*model.File, error) {
+	file, err := s.repo.GetByID(ctx, fileID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, appErrors.ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if file.OwnerID != ownerID {
+		return nil, appErrors.ErrFileNotFound
+	}
+	if file.ScanStatus == model.ScanStatusInfected || file.ScanStatus == model.ScanStatusFailed {
+		return nil, appErrors.ErrFileRejected
+	}
+	return file, nil
+}
+
+// Usage reports what userID stores against the quota of role
+func (s *FileService) Usage(ctx context.Context, userID uuid.UUID, role model.Role) (*model.StorageUsage, error) {
+	ctx, span := tracing.Start(ctx, "FileService.Usage")
+	defer span.End()
+
+	usedBytes, usedFiles, err := s.repo.Usage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &model.StorageUsage{UsedBytes: usedBytes, UsedFiles: usedFiles}
+	quota := s.config.Quotas[role]
+	if quota.MaxBytes > 0 {
+		usage.MaxBytes = &quota.MaxBytes
+	}
+	if quota.MaxFiles > 0 {
+		usage.MaxFiles = &quota.MaxFiles
+	}
+	return usage, nil
+}
+
+// CheckQuota rejects an upload of size bytes that would take userID over the
+// quota of role before any work is spent on it. Store checks again with the
+// size actually stored.
+func (s *FileService) CheckQuota(ctx context.Context, userID uuid.UUID, role model.Role, size int64) error {
+	quota := s.config.Quotas[role]
+	if quota.MaxBytes <= 0 && quota.MaxFiles <= 0 {
+		return nil
+	}
+
+	usage, err := s.Usage(ctx, userID, role)
+	if err != nil {
+		return err
+	}
+	if quota.MaxBytes > 0 && usage.UsedBytes+size > quota.MaxBytes || quota.MaxFiles > 0 && usage.UsedFiles+1 > quota.MaxFiles {
+		return appErrors.ErrStorageQuotaExceeded
+	}
+	return nil
+}
+
+// ResolveURI returns the file of ownerID a URL points to, or nil for URLs
+// outside the store. URLs into the store must name a file of ownerID.
+func (s *FileService) ResolveURI(ctx context.Context, ownerID uuid.UUID, uri string) (*model.File, error) {
+	file, object, err := s.lookup(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	if object == "" {
+		return nil, nil
+	}
+	if file == nil || file.OwnerID != ownerID {
+		return nil, appErrors.ErrInvalidImageURI
+	}
+	if file.ScanStatus == model.ScanStatusInfected || file.ScanStatus == model.ScanStatusFailed {
+		return nil, appErrors.ErrFileRejected
+	}
+	return file, nil
+}
+
+// lookup finds the object a URL points to, either a file URL or an unsigned
+// object URL handed out while objects were public. object is empty for URLs
+// outside the store, file is nil for objects uploaded before files were
+// tracked.
+func (s *FileService) lookup(ctx context.Context, uri string) (*model.File, string, error) {
+	var fileID uuid.UUID
+	variant := imaging.OriginalVariant
+	var legacyObject string
+
+	if rest, ok := strings.CutPrefix(uri, s.config.BaseURL+"/"); ok {
+		id, rawQuery, _ := strings.Cut(rest, "?")
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return nil, "", appErrors.ErrInvalidImageURI
+		}
+		if v := query.Get("variant"); v != "" {
+			variant = v
+		}
+		if fileID, err = uuid.Parse(id); err != nil {
+			return nil, "", appErrors.ErrInvalidImageURI
+		}
+	} else if name, ok := s.storage.ObjectName(uri); ok {
+		// Objects are stored as uploads/<owner>/<file id>/<variant>
+		legacyObject = name
+		parts := strings.Split(name, "/")
+		if len(parts) < 4 || parts[0] != "uploads" {
+			return nil, legacyObject, nil
+		}
+		if fileID, _ = uuid.Parse(parts[2]); fileID == uuid.Nil {
+			return nil, legacyObject, nil
+		}
+	} else {
+		return nil, "", nil
+	}
+
+	file, err := s.repo.GetByID(ctx, fileID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if legacyObject != "" {
+			return nil, legacyObject, nil
+		}
+		return nil, "", appErrors.ErrInvalidImageURI
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if legacyObject != "" {
+		for _, object := range file.Objects {
+			if object == legacyObject {
+				return file, object, nil
+			}
+		}
+		return nil, legacyObject, nil
+	}
+	object, ok := file.Objects[variant]
+	if !ok {
+		return nil, "", appErrors.ErrInvalidImageURI
+	}
+	return file, object, nil
+}
+
+// SetReference records that the entity uses file, nil releases the file it
+// used before
+func (s *FileService) SetReference(ctx context.Context, entityType, entityID string, file *model.File) error {
+	var fileID *uuid.UUID
+	if file != nil {
+		fileID = &file.ID
+	}
+	return s.repo.SetReference(ctx, entityType, entityID, fileID, time.Now())
+}
+
+// CollectGarbage removes files that stayed unreferenced for the grace period
+func (s *FileService) CollectGarbage(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "FileService.CollectGarbage")
+	defer span.End()
+
+	files, err := s.repo.ListUnreferencedBefore(ctx, time.Now().Add(-s.config.GCGracePeriod), collectBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, file := range files {
+		// The row goes first so a file referenced meanwhile is kept
+		deleted, err := s.repo.DeleteUnreferenced(ctx, file.ID)
+		if err != nil {
+			logger.FromContext(ctx).Error("failed to delete file", "file_id", file.ID.String(), "error", err)
+			continue
+		}
+		if !deleted {
+			continue
+		}
+
+		for _, object := range file.Objects {
+			if !servable(file.ScanStatus) {
+				object = storage.QuarantineObjectName(file.OwnerID, object)
+			}
+			if err := s.storage.RemoveObject(ctx, object); err != nil {
+				logger.FromContext(ctx).Error("failed to remove file object", "file_id", file.ID.String(), "object", object, "error", err)
+			}
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Run collects garbage every GCInterval until ctx is cancelled
+func (s *FileService) Run(ctx context.Context) {
+	if s.config.GCInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.GCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := s.CollectGarbage(ctx)
+			if err != nil {
+				logger.FromContext(ctx).Error("file garbage collection failed", "error", err)
+				continue
+			}
+			if removed > 0 {
+				logger.FromContext(ctx).Info("removed unreferenced files", "count", removed)
+			}
+		}
+	}
+}
+
+// ScanPending scans a batch of quarantined uploads and promotes the clean ones
+func (s *FileService) ScanPending(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "FileService.ScanPending")
+	defer span.End()
+
+	now := time.Now()
+	files, err := s.repo.ClaimPendingScans(ctx, now, now.Add(-scanLease), scanBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	scanned := 0
+	for _, file := range files {
+		if err := s.scan(ctx, &file); err != nil {
+			metrics.FileScansTotal.WithLabelValues("error").Inc()
+			logger.FromContext(ctx).Error("failed to scan file", "file_id", file.ID.String(), "attempt", file.ScanAttempts, "error", err)
+			if file.ScanAttempts >= maxScanAttempts {
+				if err := s.repo.FinishScan(ctx, file.ID, model.ScanStatusFailed, "", time.Now()); err != nil {
+					logger.FromContext(ctx).Error("failed to record scan failure", "file_id", file.ID.String(), "error", err)
+				}
+			}
+			continue
+		}
+		scanned++
+	}
+	return scanned, nil
+}
+
+// scan checks every quarantined object of file. Clean files are moved to
+// their served names, infected ones are removed right away. A failed scan is
+// retried once its claim went stale, objects an earlier attempt already
+// promoted are not scanned or moved again.
+func (s *FileService) scan(ctx context.Context, file *model.File) error {
+	promoted := make(map[string]bool, len(file.Objects))
+	for _, object := range file.Objects {
+		result, err := s.scanObject(ctx, storage.QuarantineObjectName(file.OwnerID, object))
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			if promoted[object], err = s.isPromoted(ctx, object); err != nil {
+				return err
+			}
+			if promoted[object] {
+				continue
+			}
+			return storage.ErrObjectNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if result.Clean {
+			continue
+		}
+
+		metrics.FileScansTotal.WithLabelValues("infected").Inc()
+		logger.FromContext(ctx).Warn("malware found in upload", "file_id", file.ID.String(), "owner_id", file.OwnerID.String(), "signature", result.Signature)
+		for _, object := range file.Objects {
+			name := storage.QuarantineObjectName(file.OwnerID, object)
+			if promoted[object] {
+				name = object
+			}
+			if err := s.storage.RemoveObject(ctx, name); err != nil {
+				logger.FromContext(ctx).Error("failed to remove infected object", "file_id", file.ID.String(), "object", object, "error", err)
+			}
+		}
+		return s.repo.FinishScan(ctx, file.ID, model.ScanStatusInfected, result.Signature, time.Now())
+	}
+
+	for _, object := range file.Objects {
+		if promoted[object] {
+			continue
+		}
+		if err := s.storage.MoveObject(ctx, storage.QuarantineObjectName(file.OwnerID, object), object); err != nil {
+			return err
+		}
+	}
+	metrics.FileScansTotal.WithLabelValues("clean").Inc()
+	return s.repo.FinishScan(ctx, file.ID, model.ScanStatusClean, "", time.Now())
+}
+
+// isPromoted reports whether object already sits at its served name, left
+// there by a scan that failed before promoting every object
+func (s *FileService) isPromoted(ctx context.Context, object string) (bool, error) {
+	_, err := s.storage.StatObject(ctx, object)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *FileService) scanObject(ctx context.Context, objectName string) (scanner.Result, error) {
+	object, err := s.storage.GetObject(ctx, objectName)
+	if err != nil {
+		return scanner.Result{}, err
+	}
+	defer object.Close()
+
+	return s.scanner.Scan(ctx, object)
+}
+
+// RunScanner scans quarantined uploads every ScanInterval, and as soon as a
+// new upload arrives, until ctx is cancelled
+func (s *FileService) RunScanner(ctx context.Context) {
+	if s.scanner == nil || s.config.ScanInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.ScanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.scanWake:
+		}
+
+		// Drain the batch so a burst of uploads does not wait for the ticker
+		for {
+			scanned, err := s.ScanPending(ctx)
+			if err != nil {
+				logger.FromContext(ctx).Error("file scan failed", "error", err)
+			}
+			if err != nil || scanned < scanBatchSize {
+				break
+			}
+		}
+	}
 }
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/database"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/scanner"
+	"github.com/insanjati/fitbyte/internal/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+// A scan that failed halfway leaves some objects promoted, retrying it must
+// finish the file instead of failing on the missing quarantine names
+func TestScanResumesPromotion(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sqlx.Connect("postgres", url)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ownerID := uuid.New()
+	if _, err := db.Exec(`INSERT INTO users (id, email, password) VALUES ($1, $2, 'x')`, ownerID, ownerID.String()+"@example.com"); err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.Exec(`DELETE FROM users WHERE id = $1`, ownerID); err != nil {
+			t.Errorf("failed to remove test user: %v", err)
+		}
+	})
+
+	store, err := storage.NewLocalStorage(&storage.LocalConfig{Root: t.TempDir(), BaseURL: "http://localhost/files", SigningKey: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewFileRepository(db, database.Timeouts{})
+	files := NewFileService(repo, store, nil, scanner.NewFake(), FileConfig{})
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		quarantine []string
+		promoted   []string
+		wantErr    error
+		wantStatus model.ScanStatus
+	}{
+		{"nothing promoted", []string{"original", "thumb"}, nil, nil, model.ScanStatusClean},
+		{"partly promoted", []string{"thumb"}, []string{"original"}, nil, model.ScanStatusClean},
+		{"all promoted", nil, []string{"original", "thumb"}, nil, model.ScanStatusClean},
+		{"object lost", []string{"thumb"}, nil, storage.ErrObjectNotFound, model.ScanStatusPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := model.File{
+				ID:          uuid.New(),
+				OwnerID:     ownerID,
+				ContentType: "image/png",
+				Objects:     map[string]string{},
+				CreatedAt:   time.Now(),
+				ScanStatus:  model.ScanStatusPending,
+			}
+			for _, variant := range []string{"original", "thumb"} {
+				file.Objects[variant] = storage.UserObjectName(ownerID, "images/"+file.ID.String()+"-"+variant+".png")
+			}
+			if _, err := repo.CreateWithinQuota(ctx, &file, nil); err != nil {
+				t.Fatal(err)
+			}
+			for _, variant := range tt.quarantine {
+				if err := store.PutObject(ctx, storage.QuarantineObjectName(ownerID, file.Objects[variant]), "image/png", strings.NewReader(variant), int64(len(variant))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, variant := range tt.promoted {
+				if err := store.PutObject(ctx, file.Objects[variant], "image/png", strings.NewReader(variant), int64(len(variant))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := files.scan(ctx, &file); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("scan() error = %v, want %v", err, tt.wantErr)
+			}
+
+			stored, err := repo.GetByID(ctx, file.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.ScanStatus != tt.wantStatus {
+				t.Errorf("ScanStatus = %q, want %q", stored.ScanStatus, tt.wantStatus)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			for variant, object := range file.Objects {
+				if _, err := store.StatObject(ctx, object); err != nil {
+					t.Errorf("%s not promoted: %v", variant, err)
+				}
+				if _, err := store.StatObject(ctx, storage.QuarantineObjectName(ownerID, object)); !errors.Is(err, storage.ErrObjectNotFound) {
+					t.Errorf("%s still in quarantine: %v", variant, err)
+				}
+			}
+		})
+	}
+}
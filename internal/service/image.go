@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/cache"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/imaging"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/storage"
+	"github.com/insanjati/fitbyte/internal/tracing"
+)
+
+// MaxImageSize is the largest image upload accepted, in bytes
+const MaxImageSize = 10 * 1024 * 1024
+
+// imageSizes are rendered for every upload next to the sanitized original
+var imageSizes = []imaging.Size{
+	{Name: "thumbnail", MaxDimension: 128},
+	{Name: "small", MaxDimension: 320},
+	{Name: "medium", MaxDimension: 800},
+}
+
+type ImageConfig struct {
+	// PresignTTL is how long a presigned upload URL stays valid
+	PresignTTL time.Duration
+}
+
+// pendingUpload is kept in Redis between presigning and completion
+type pendingUpload struct {
+	OwnerID     uuid.UUID `json:"ownerId"`
+	ObjectName  string    `json:"objectName"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+}
+
+func pendingUploadKey(uploadID string) string {
+	return "pending_upload:" + uploadID
+}
+
+// ImageService sanitizes uploaded images and stores them with their variants
+type ImageService struct {
+	storage storage.Storage
+	files   *FileService
+	cache   *cache.Redis
+	config  ImageConfig
+}
+
+func NewImageService(storage storage.Storage, files *FileService, cache *cache.Redis, config ImageConfig) *ImageService {
+	return &ImageService{storage: storage, files: files, cache: cache, config: config}
+}
+
+// Upload stores the image under uploads/<owner>/<image id>/<variant>
+func (s *ImageService) Upload(ctx context.Context, ownerID uuid.UUID, file io.Reader) (*model.UploadedImage, error) {
+	ctx, span := tracing.Start(ctx, "ImageService.Upload")
+	defer span.End()
+
+	data, err := readImage(file)
+	if err != nil {
+		return nil, err
+	}
+	return s.store(ctx, ownerID, data)
+}
+
+// Presign lets the client upload a file straight to storage. The object lands
+// in an incoming folder and is only usable once Complete processed it.
+func (s *ImageService) Presign(ctx context.Context, ownerID uuid.UUID, req model.PresignUploadRequest) (*model.PresignedUpload, error) {
+	ctx, span := tracing.Start(ctx, "ImageService.Presign")
+	defer span.End()
+
+	uploadID := uuid.New().String()
+	pending := pendingUpload{
+		OwnerID:     ownerID,
+		ObjectName:  storage.UserObjectName(ownerID, "incoming/"+uploadID),
+		ContentType: req.ContentType,
+		Size:        req.Size,
+	}
+
+	expiresAt := time.Now().Add(s.config.PresignTTL)
+	url, formData, err := s.storage.PresignedPost(ctx, pending.ObjectName, pending.ContentType, pending.Size, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Completion may come a little after the URL expired for slow uploads
+	if err := s.cache.SetExp(ctx, pendingUploadKey(uploadID), pending, 2*s.config.PresignTTL); err != nil {
+		return nil, fmt.Errorf("failed to store pending upload: %w", err)
+	}
+
+	return &model.PresignedUpload{
+		UploadID:  uploadID,
+		URL:       url,
+		Method:    http.MethodPost,
+		FormData:  formData,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Complete checks the uploaded object against what was presigned and turns it
+// into a sanitized image like Upload does
+func (s *ImageService) Complete(ctx context.Context, ownerID uuid.UUID, uploadID string) (*model.UploadedImage, error) {
+	ctx, span := tracing.Start(ctx, "ImageService.Complete")
+	defer span.End()
+
+	key := pendingUploadKey(uploadID)
+	var pending pendingUpload
+	err := s.cache.GetAs(ctx, key, &pending)
+	if errors.Is(err, cache.ErrKeyNotExist) {
+		return nil, appErrors.ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pending.OwnerID != ownerID {
+		return nil, appErrors.ErrUploadNotFound
+	}
+
+	size, err := s.storage.StatObject(ctx, pending.ObjectName)
+	if errors.Is(err, storage.ErrObjectNotFound) {
+		return nil, appErrors.ErrUploadIncomplete
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// From here on the upload is consumed whatever the outcome
+	defer func() {
+		if err := s.storage.RemoveObject(ctx, pending.ObjectName); err != nil {
+			logger.FromContext(ctx).Warn("failed to remove incoming upload", "object", pending.ObjectName, "error", err)
+		}
+		if err := s.cache.Delete(ctx, key); err != nil {
+			logger.FromContext(ctx).Warn("failed to delete pending upload", "upload_id", uploadID, "error", err)
+		}
+	}()
+
+	if size != pending.Size {
+		return nil, appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "size", Tag: "eq", Message: "uploaded file size does not match the announced size"})
+	}
+
+	object, err := s.storage.GetObject(ctx, pending.ObjectName)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	data, err := readImage(object)
+	if err != nil {
+		return nil, err
+	}
+	if format, err := imaging.Detect(data); err != nil || format.ContentType() != pending.ContentType {
+		return nil, appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "contentType", Tag: "mimetype", Message: "uploaded file does not match the announced content type"})
+	}
+
+	return s.store(ctx, ownerID, data)
+}
+
+func readImage(file io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(file, MaxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if len(data) > MaxImageSize {
+		return nil, appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "file", Tag: "max", Message: "file size exceeds 10MB limit"})
+	}
+	return data, nil
+}
+
+func (s *ImageService) store(ctx context.Context, ownerID uuid.UUID, data []byte) (*model.UploadedImage, error) {
+	file, err := s.StoreFile(ctx, ownerID, data)
+	if err != nil {
+		return nil, err
+	}
+
+	uploaded := &model.UploadedImage{
+		ID:         file.ID,
+		URI:        s.files.URL(file, imaging.OriginalVariant),
+		Variants:   make(map[string]string, len(file.Objects)),
+		ScanStatus: file.ScanStatus,
+	}
+	if uploaded.Links, err = s.files.SignedURLs(ctx, file); err != nil {
+		return nil, err
+	}
+	for variant := range file.Objects {
+		uploaded.Variants[variant] = s.files.URL(file, variant)
+	}
+	return uploaded, nil
+}
+
+// StoreFile sanitizes an image held in memory and stores it with its variants
+func (s *ImageService) StoreFile(ctx context.Context, ownerID uuid.UUID, data []byte) (*model.File, error) {
+	result, err := imaging.Process(data, imageSizes)
+	if errors.Is(err, imaging.ErrTooManyPixels) {
+		return nil, appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "file", Tag: "max", Message: "image dimensions are too large"}).Wrap(err)
+	}
+	if err != nil {
+		return nil, appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "file", Tag: "mimetype", Message: "only JPEG and PNG images are allowed"}).Wrap(err)
+	}
+
+	variants := make(map[string][]byte, len(result.Variants)+1)
+	for _, variant := range append([]imaging.Variant{result.Original}, result.Variants...) {
+		variants[variant.Name] = variant.Data
+	}
+	return s.files.Store(ctx, ownerID, result.Format.ContentType(), result.Format.Extension(), variants)
+}
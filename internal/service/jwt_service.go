@@ -4,6 +4,7 @@ import (
 	"errors"
 	"time"
 
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
 	"github.com/insanjati/fitbyte/internal/model"
 	
 	"github.com/golang-jwt/jwt/v5"
@@ -29,6 +30,7 @@ type jwtService struct {
 type JwtTokenClaims struct {
 	jwt.RegisteredClaims
 	UserId uuid.UUID `json:"user_id"`
+	Role   model.Role `json:"role"`
 }
 
 // GenerateToken implements JwtService.
@@ -40,6 +42,10 @@ func (j *jwtService) GenerateToken(payload *model.User) (string, error) {
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 		UserId: payload.ID,
+		Role:   payload.Role,
+	}
+	if claims.Role == "" {
+		claims.Role = model.RoleUser
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -62,17 +68,20 @@ func (j *jwtService) VerifyToken(tokenString string) (jwt.MapClaims, error) {
 	})
 
 	if err != nil {
-		return nil, errors.New("failed to parse token")
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, appErrors.ErrExpiredToken.Wrap(err)
+		}
+		return nil, appErrors.ErrInvalidToken.Wrap(err)
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !token.Valid || !ok {
-		return nil, errors.New("invalid token or claims")
+		return nil, appErrors.ErrInvalidToken.Wrap(errors.New("invalid token or claims"))
 	}
 
 	// Verify issuer
 	if iss, ok := claims["iss"].(string); !ok || iss != j.config.Issues {
-		return nil, errors.New("invalid issuer")
+		return nil, appErrors.ErrInvalidToken.Wrap(errors.New("invalid issuer"))
 	}
 
 	return claims, nil
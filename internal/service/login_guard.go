@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/insanjati/fitbyte/internal/cache"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
+)
+
+// LockoutConfig controls progressive lockout after failed logins for an email.
+// Once MaxAttempts failures happen within Window the email is locked for
+// BaseLockout, doubling with every further failure up to MaxLockout. Without
+// MaxLockout the lockout stays at BaseLockout.
+type LockoutConfig struct {
+	MaxAttempts int
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+// dummyPasswordHash is compared against when the email has no account, it
+// uses bcrypt.DefaultCost like the stored hashes
+const dummyPasswordHash = "$2a$10$AIx.VrMoU0uuXz8w4TJFreIhubhn72pHniX2kF87IxHDmZmad1s0S"
+
+type loginGuard struct {
+	cache  *cache.Redis
+	config LockoutConfig
+}
+
+func (g *loginGuard) enabled() bool {
+	return g.config.MaxAttempts > 0 && g.config.BaseLockout > 0
+}
+
+func (g *loginGuard) failuresKey(email string) string {
+	return fmt.Sprintf("login_failures:%s", strings.ToLower(email))
+}
+
+func (g *loginGuard) lockKey(email string) string {
+	return fmt.Sprintf("login_lock:%s", strings.ToLower(email))
+}
+
+// check returns ErrLoginLocked while the email is locked out
+func (g *loginGuard) check(ctx context.Context, email string) error {
+	if !g.enabled() {
+		return nil
+	}
+
+	ttl, err := g.cache.TTL(ctx, g.lockKey(email))
+	if errors.Is(err, cache.ErrKeyNotExist) {
+		return nil
+	}
+	if err != nil {
+		// Fail open, the route level rate limit still applies
+		logger.FromContext(ctx).Warn("failed to check login lockout", "error", err)
+		return nil
+	}
+
+	return appErrors.ErrLoginLocked.WithRetryAfter(ttl)
+}
+
+// fail records a failed attempt and locks the email when the threshold is hit
+func (g *loginGuard) fail(ctx context.Context, email string) {
+	if !g.enabled() {
+		return
+	}
+
+	failures, err := g.cache.Incr(ctx, g.failuresKey(email), g.config.Window)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to record login failure", "error", err)
+		return
+	}
+	if failures < int64(g.config.MaxAttempts) {
+		return
+	}
+
+	lockout := g.config.BaseLockout
+	for i := int64(g.config.MaxAttempts); i < failures && lockout < g.config.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if g.config.MaxLockout > 0 && lockout > g.config.MaxLockout {
+		lockout = g.config.MaxLockout
+	}
+
+	if err := g.cache.SetExp(ctx, g.lockKey(email), failures, lockout); err != nil {
+		logger.FromContext(ctx).Warn("failed to lock login", "error", err)
+		return
+	}
+	logger.FromContext(ctx).Warn("login locked", "email", email, "failures", failures, "lockout", lockout.String())
+}
+
+// reset clears the failure counter and any lockout, after a successful login
+// or a password reset
+func (g *loginGuard) reset(ctx context.Context, email string) {
+	if !g.enabled() {
+		return
+	}
+	for _, key := range []string{g.failuresKey(email), g.lockKey(email)} {
+		if err := g.cache.Delete(ctx, key); err != nil {
+			logger.FromContext(ctx).Warn("failed to reset login failures", "error", err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/insanjati/fitbyte/internal/cache"
+	"github.com/insanjati/fitbyte/internal/cache/redistest"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+)
+
+func newTestLoginGuard(t *testing.T, config LockoutConfig) *loginGuard {
+	t.Helper()
+	redis, err := cache.NewRedis(cache.RedisConfig{DB: redistest.NewServer(t).Client(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &loginGuard{cache: redis, config: config}
+}
+
+func TestLoginGuardLockout(t *testing.T) {
+	config := LockoutConfig{MaxAttempts: 3, Window: time.Hour, BaseLockout: time.Minute, MaxLockout: 4 * time.Minute}
+
+	tests := []struct {
+		name        string
+		config      LockoutConfig
+		failures    int
+		wantLockout time.Duration
+	}{
+		{"no failures", config, 0, 0},
+		{"below threshold", config, 2, 0},
+		{"at threshold", config, 3, time.Minute},
+		{"doubles", config, 4, 2 * time.Minute},
+		{"doubles again", config, 5, 4 * time.Minute},
+		{"capped", config, 8, 4 * time.Minute},
+		{"no max lockout", LockoutConfig{MaxAttempts: 3, Window: time.Hour, BaseLockout: time.Minute}, 5, time.Minute},
+		{"disabled", LockoutConfig{}, 10, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			guard := newTestLoginGuard(t, tt.config)
+			for range tt.failures {
+				guard.fail(ctx, "runner@example.com")
+			}
+
+			err := guard.check(ctx, "runner@example.com")
+			if tt.wantLockout == 0 {
+				if err != nil {
+					t.Fatalf("check() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var appErr *appErrors.AppError
+			if !errors.As(err, &appErr) || !errors.Is(err, appErrors.ErrLoginLocked) {
+				t.Fatalf("check() error = %v, want %v", err, appErrors.ErrLoginLocked)
+			}
+			if diff := tt.wantLockout - appErr.RetryAfter; diff < 0 || diff > 2*time.Second {
+				t.Errorf("RetryAfter = %v, want about %v", appErr.RetryAfter, tt.wantLockout)
+			}
+		})
+	}
+}
+
+func TestLoginGuardIgnoresEmailCase(t *testing.T) {
+	ctx := context.Background()
+	guard := newTestLoginGuard(t, LockoutConfig{MaxAttempts: 2, Window: time.Hour, BaseLockout: time.Minute})
+
+	guard.fail(ctx, "Runner@Example.com")
+	guard.fail(ctx, "runner@example.com")
+
+	if err := guard.check(ctx, "RUNNER@EXAMPLE.COM"); !errors.Is(err, appErrors.ErrLoginLocked) {
+		t.Errorf("check() error = %v, want %v", err, appErrors.ErrLoginLocked)
+	}
+	if err := guard.check(ctx, "other@example.com"); err != nil {
+		t.Errorf("check() of another email error = %v, want nil", err)
+	}
+}
+
+func TestLoginGuardResetClearsFailures(t *testing.T) {
+	ctx := context.Background()
+	guard := newTestLoginGuard(t, LockoutConfig{MaxAttempts: 3, Window: time.Hour, BaseLockout: time.Minute})
+
+	guard.fail(ctx, "runner@example.com")
+	guard.fail(ctx, "runner@example.com")
+	guard.reset(ctx, "runner@example.com")
+	guard.fail(ctx, "runner@example.com")
+
+	if err := guard.check(ctx, "runner@example.com"); err != nil {
+		t.Errorf("check() after reset error = %v, want nil", err)
+	}
+}
+
+func TestLoginGuardWindowExpires(t *testing.T) {
+	ctx := context.Background()
+	guard := newTestLoginGuard(t, LockoutConfig{MaxAttempts: 2, Window: time.Second, BaseLockout: time.Minute})
+
+	guard.fail(ctx, "runner@example.com")
+	time.Sleep(1100 * time.Millisecond)
+	guard.fail(ctx, "runner@example.com")
+
+	if err := guard.check(ctx, "runner@example.com"); err != nil {
+		t.Errorf("check() with failures in separate windows error = %v, want nil", err)
+	}
+}
+
+func TestLoginGuardResetLiftsLockout(t *testing.T) {
+	ctx := context.Background()
+	guard := newTestLoginGuard(t, LockoutConfig{MaxAttempts: 2, Window: time.Hour, BaseLockout: time.Minute})
+
+	guard.fail(ctx, "runner@example.com")
+	guard.fail(ctx, "runner@example.com")
+	if err := guard.check(ctx, "runner@example.com"); !errors.Is(err, appErrors.ErrLoginLocked) {
+		t.Fatalf("check() error = %v, want %v", err, appErrors.ErrLoginLocked)
+	}
+
+	guard.reset(ctx, "runner@example.com")
+	if err := guard.check(ctx, "runner@example.com"); err != nil {
+		t.Errorf("check() after reset error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/cache"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/metrics"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/oauth"
+	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"golang.org/x/oauth2"
+)
+
+// oauthStateTTL bounds how long a user may take at the provider login page
+const oauthStateTTL = 10 * time.Minute
+
+// oauthState is kept in Redis between the redirect and the callback
+type oauthState struct {
+	Provider string `json:"provider"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+}
+
+// OAuthService signs users in through external OIDC providers and issues the
+// regular fitbyte JWT
+type OAuthService struct {
+	providers    map[string]*oauth.Provider
+	userRepo     *repository.UserRepository
+	identityRepo *repository.UserIdentityRepository
+	cache        *cache.Redis
+	twoFactor    *TwoFactorService
+}
+
+func NewOAuthService(providers []*oauth.Provider, userRepo *repository.UserRepository, identityRepo *repository.UserIdentityRepository, cache *cache.Redis, twoFactor *TwoFactorService) *OAuthService {
+	byName := make(map[string]*oauth.Provider, len(providers))
+	for _, p := range providers {
+		byName[p.Name()] = p
+	}
+
+	return &OAuthService{
+		providers:    byName,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		cache:        cache,
+		twoFactor:    twoFactor,
+	}
+}
+
+func (s *OAuthService) getStateKey(state string) string {
+	return fmt.Sprintf("oauth_state:%s", state)
+}
+
+// Authorize returns the provider URL the client has to be redirected to and
+// the state, which the browser has to keep in a cookie for the callback
+func (s *OAuthService) Authorize(ctx context.Context, providerName string) (string, string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", appErrors.ErrUnknownProvider
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	if err := s.cache.SetExp(ctx, s.getStateKey(state), oauthState{
+		Provider: providerName,
+		Verifier: verifier,
+		Nonce:    nonce,
+	}, oauthStateTTL); err != nil {
+		return "", "", fmt.Errorf("failed to store oauth state: %w", err)
+	}
+
+	return provider.AuthCodeURL(state, nonce, verifier), state, nil
+}
+
+// FormPost reports whether the callback of providerName arrives as a cross
+// site POST, which only carries cookies marked SameSite=None
+func (s *OAuthService) FormPost(providerName string) bool {
+	provider, ok := s.providers[providerName]
+	return ok && provider.FormPost()
+}
+
+// Callback completes the flow, signing in the linked user or creating one.
+// browserState is the state kept by the browser that started the flow, so a
+// callback URL started by someone else cannot sign the victim in.
+func (s *OAuthService) Callback(ctx context.Context, providerName, code, state, browserState string) (model.AuthResponse, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.Callback")
+	defer span.End()
+
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return model.AuthResponse{}, appErrors.ErrUnknownProvider
+	}
+	if code == "" || state == "" {
+		return model.AuthResponse{}, appErrors.ErrOAuthFailed.WithMessage("code and state are required")
+	}
+	if subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return model.AuthResponse{}, appErrors.ErrOAuthFailed.WithMessage("login was not started from this browser")
+	}
+
+	var saved oauthState
+	if err := s.cache.Take(ctx, s.getStateKey(state), &saved); err != nil || saved.Provider != providerName {
+		return model.AuthResponse{}, appErrors.ErrOAuthFailed.WithMessage("login session is invalid or expired")
+	}
+
+	identity, err := provider.Exchange(ctx, code, saved.Verifier, saved.Nonce)
+	if err != nil {
+		return model.AuthResponse{}, appErrors.ErrOAuthFailed.Wrap(err)
+	}
+
+	user, err := s.resolveUser(ctx, providerName, identity)
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+	if user.DeletedAt != nil {
+		return model.AuthResponse{}, appErrors.ErrAccountDeleted
+	}
+	if user.DisabledAt != nil {
+		return model.AuthResponse{}, appErrors.ErrAccountDisabled
+	}
+	metrics.LoginsTotal.WithLabelValues("oauth_" + providerName).Inc()
+
+	// The provider login does not replace the second factor
+	return s.twoFactor.SignIn(ctx, &user, "oauth_"+providerName)
+}
+
+// resolveUser finds the user linked to identity. Unknown identities are linked
+// to the user with the same email only when the provider verified it, and get a
+// new passwordless account otherwise.
+func (s *OAuthService) resolveUser(ctx context.Context, providerName string, identity *oauth.Identity) (model.User, error) {
+	user, err := s.identityRepo.GetUserByIdentity(ctx, providerName, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return model.User{}, err
+	}
+
+	if identity.Email == "" {
+		return model.User{}, appErrors.ErrOAuthFailed.WithMessage("provider did not share an email address")
+	}
+
+	now := time.Now()
+	link := &model.UserIdentity{
+		ID:        uuid.New(),
+		Provider:  providerName,
+		Subject:   identity.Subject,
+		Email:     &identity.Email,
+		CreatedAt: now,
+	}
+
+	existing, err := s.userRepo.GetUserByEmail(ctx, identity.Email)
+	if err == nil {
+		if !identity.EmailVerified {
+			return model.User{}, appErrors.ErrIdentityConflict
+		}
+		link.UserID = existing.ID
+		if err := s.identityRepo.LinkIdentity(ctx, link); err != nil {
+			return model.User{}, err
+		}
+		logger.FromContext(ctx).Info("linked external identity", "provider", providerName, "user_id", existing.ID.String())
+		return existing, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return model.User{}, err
+	}
+
+	user = model.User{ID: uuid.New(), Email: identity.Email, CreatedAt: now}
+	if identity.Name != "" {
+		user.Name = &identity.Name
+	}
+	link.UserID = user.ID
+	if err := s.identityRepo.CreateUserWithIdentity(ctx, &user, link, identity.EmailVerified); err != nil {
+		return model.User{}, err
+	}
+	metrics.UsersRegisteredTotal.Inc()
+	logger.FromContext(ctx).Info("registered user through external identity", "provider", providerName, "user_id", user.ID.String())
+
+	return user, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/cache"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/repository"
+)
+
+// SessionService revokes JWTs. Tokens are stateless, so revoking means
+// rejecting every token issued before the user's sessions_revoked_at.
+type SessionService struct {
+	userRepo *repository.UserRepository
+	cache    *cache.Redis
+}
+
+func NewSessionService(userRepo *repository.UserRepository, cache *cache.Redis) *SessionService {
+	return &SessionService{userRepo: userRepo, cache: cache}
+}
+
+func (s *SessionService) getRevokedKey(userID uuid.UUID) string {
+	return fmt.Sprintf("user_sessions:%s", userID.String())
+}
+
+// Revoke invalidates every token issued before now. JWT iat has second
+// precision, so the cutoff is truncated to let a token issued right after
+// the revocation through.
+func (s *SessionService) Revoke(ctx context.Context, userID uuid.UUID) error {
+	revokedAt := time.Now().Truncate(time.Second)
+	if err := s.userRepo.RevokeSessions(ctx, userID, revokedAt); err != nil {
+		return err
+	}
+
+	if err := s.cache.SetExp(ctx, s.getRevokedKey(userID), revokedAt.Unix(), 10*time.Minute); err != nil {
+		logger.FromContext(ctx).Warn("failed to cache session revocation", "error", err)
+		_ = s.cache.Delete(ctx, s.getRevokedKey(userID))
+	}
+	return nil
+}
+
+// Validate returns ErrSessionRevoked when a token issued at issuedAt was revoked
+func (s *SessionService) Validate(ctx context.Context, userID uuid.UUID, issuedAt time.Time) error {
+	cacheKey := s.getRevokedKey(userID)
+
+	// 0 means the user never revoked their sessions
+	var revokedAt int64
+	if err := s.cache.GetAs(ctx, cacheKey, &revokedAt); err != nil {
+		revoked, err := s.userRepo.GetSessionsRevokedAt(ctx, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return appErrors.ErrInvalidToken.WithMessage("user no longer exists")
+		}
+		if err != nil {
+			return err
+		}
+		if revoked != nil {
+			revokedAt = revoked.Unix()
+		}
+		_ = s.cache.SetExp(ctx, cacheKey, revokedAt, 10*time.Minute)
+	}
+
+	if revokedAt > 0 && issuedAt.Unix() < revokedAt {
+		return appErrors.ErrSessionRevoked
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/cache"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"github.com/insanjati/fitbyte/internal/utils"
+)
+
+const (
+	recoveryCodeCount = 10
+	// challengeMaxAttempts wrong codes burn the login challenge
+	challengeMaxAttempts = 5
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TwoFactorConfig struct {
+	// Issuer is the name authenticator apps show next to the code
+	Issuer string
+	// EncryptionKey encrypts TOTP secrets and signs recovery codes
+	EncryptionKey string
+	ChallengeTTL  time.Duration
+}
+
+// loginChallenge is kept in Redis between the password and the TOTP step
+type loginChallenge struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email"`
+	Method string    `json:"method"`
+}
+
+// TwoFactorService manages TOTP enrollment and the second login step
+type TwoFactorService struct {
+	repo       *repository.TwoFactorRepository
+	userRepo   *repository.UserRepository
+	cache      *cache.Redis
+	jwtService JwtService
+	box        *utils.SecretBox
+	audit      *AuditService
+	config     TwoFactorConfig
+}
+
+func NewTwoFactorService(repo *repository.TwoFactorRepository, userRepo *repository.UserRepository, cache *cache.Redis, jwt JwtService, audit *AuditService, config TwoFactorConfig) (*TwoFactorService, error) {
+	box, err := utils.NewSecretBox(config.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorService{
+		repo:       repo,
+		userRepo:   userRepo,
+		cache:      cache,
+		jwtService: jwt,
+		box:        box,
+		audit:      audit,
+		config:     config,
+	}, nil
+}
+
+func (s *TwoFactorService) getChallengeKey(token string) string {
+	return fmt.Sprintf("login_challenge:%s", token)
+}
+
+func (s *TwoFactorService) getChallengeAttemptsKey(token string) string {
+	return fmt.Sprintf("login_challenge_attempts:%s", token)
+}
+
+// Enroll creates a pending secret. 2FA is only enforced after Enable proved
+// the authenticator app produces valid codes.
+func (s *TwoFactorService) Enroll(ctx context.Context, userID uuid.UUID) (*model.TwoFactorEnrollment, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.Enroll")
+	defer span.End()
+
+	current, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if current != nil && current.EnabledAt != nil {
+		return nil, appErrors.ErrTwoFactorEnabled
+	}
+
+	user, err := s.userRepo.GetUserById(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, appErrors.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.box.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SavePendingTOTP(ctx, userID, sealed); err != nil {
+		return nil, err
+	}
+
+	return &model.TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(s.config.Issuer, user.Email, secret),
+	}, nil
+}
+
+// Enable confirms the enrollment with a first code and returns the recovery
+// codes, they are only ever shown this once
+func (s *TwoFactorService) Enable(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.Enable")
+	defer span.End()
+
+	totp, err := s.repo.GetTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, appErrors.ErrTwoFactorNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if totp.EnabledAt != nil {
+		return nil, appErrors.ErrTwoFactorEnabled
+	}
+
+	if err := s.verifyTOTP(ctx, totp, code); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, s.hashRecoveryCode(code))
+	}
+
+	if err := s.repo.EnableTOTP(ctx, userID, time.Now(), hashes); err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).Info("two-factor authentication enabled")
+
+	return codes, nil
+}
+
+// Disable turns 2FA off, code may be a TOTP or a recovery code
+func (s *TwoFactorService) Disable(ctx context.Context, userID uuid.UUID, code string) error {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.Disable")
+	defer span.End()
+
+	if err := s.verifyCode(ctx, userID, code); err != nil {
+		return err
+	}
+
+	if err := s.repo.DisableTOTP(ctx, userID); err != nil {
+		return err
+	}
+	logger.FromContext(ctx).Info("two-factor authentication disabled")
+	return nil
+}
+
+// SignIn finishes a successful first factor: users without 2FA get their JWT,
+// the others a short-lived challenge token for CompleteLogin. method names the
+// first factor in the audit log.
+func (s *TwoFactorService) SignIn(ctx context.Context, user *model.User, method string) (model.AuthResponse, error) {
+	totp, err := s.repo.GetTOTP(ctx, user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return model.AuthResponse{}, err
+	}
+
+	if totp == nil || totp.EnabledAt == nil {
+		token, err := s.jwtService.GenerateToken(user)
+		if err != nil {
+			return model.AuthResponse{}, fmt.Errorf("failed to generate token: %v", err)
+		}
+		s.recordLogin(ctx, user.ID, method)
+		return model.AuthResponse{Email: user.Email, Token: token}, nil
+	}
+
+	challenge, err := randomString()
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+	if err := s.cache.SetExp(ctx, s.getChallengeKey(challenge), loginChallenge{UserID: user.ID, Email: user.Email, Method: method}, s.config.ChallengeTTL); err != nil {
+		return model.AuthResponse{}, fmt.Errorf("failed to store login challenge: %w", err)
+	}
+
+	return model.AuthResponse{Email: user.Email, TwoFactorRequired: true, ChallengeToken: challenge}, nil
+}
+
+// CompleteLogin exchanges a challenge token and a TOTP or recovery code for a JWT
+func (s *TwoFactorService) CompleteLogin(ctx context.Context, req model.TwoFactorLoginRequest) (model.AuthResponse, error) {
+	ctx, span := tracing.Start(ctx, "TwoFactorService.CompleteLogin")
+	defer span.End()
+
+	var challenge loginChallenge
+	if err := s.cache.GetAs(ctx, s.getChallengeKey(req.ChallengeToken), &challenge); err != nil {
+		return model.AuthResponse{}, appErrors.ErrInvalidLoginChallenge
+	}
+
+	if err := s.verifyCode(ctx, challenge.UserID, req.Code); err != nil {
+		if errors.Is(err, appErrors.ErrInvalidTwoFactorCode) {
+			s.failChallenge(ctx, req.ChallengeToken)
+			s.audit.Record(ctx, AuditEvent{
+				SubjectID:  challenge.UserID,
+				Action:     "user.login_failed",
+				EntityType: "user",
+				EntityID:   challenge.UserID.String(),
+				Metadata:   map[string]string{"method": challenge.Method, "reason": "invalid_two_factor_code"},
+			})
+		}
+		return model.AuthResponse{}, err
+	}
+
+	_ = s.cache.Delete(ctx, s.getChallengeKey(req.ChallengeToken))
+	_ = s.cache.Delete(ctx, s.getChallengeAttemptsKey(req.ChallengeToken))
+
+	// The account may have been disabled, deleted or had its role changed
+	// while the challenge was pending, revoking sessions cannot cover a token
+	// issued after it
+	user, err := s.userRepo.GetUserAuth(ctx, challenge.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.AuthResponse{}, appErrors.ErrInvalidLoginChallenge
+	}
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+	if user.DeletedAt != nil {
+		return model.AuthResponse{}, appErrors.ErrAccountDeleted
+	}
+	if user.DisabledAt != nil {
+		return model.AuthResponse{}, appErrors.ErrAccountDisabled
+	}
+
+	token, err := s.jwtService.GenerateToken(&user)
+	if err != nil {
+		return model.AuthResponse{}, fmt.Errorf("failed to generate token: %v", err)
+	}
+	s.recordLogin(ctx, user.ID, challenge.Method+"+two_factor")
+
+	return model.AuthResponse{Email: user.Email, Token: token}, nil
+}
+
+func (s *TwoFactorService) recordLogin(ctx context.Context, userID uuid.UUID, method string) {
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    userID,
+		SubjectID:  userID,
+		Action:     "user.login",
+		EntityType: "user",
+		EntityID:   userID.String(),
+		Metadata:   map[string]string{"method": method},
+	})
+}
+
+// failChallenge burns the challenge after too many wrong codes
+func (s *TwoFactorService) failChallenge(ctx context.Context, token string) {
+	attempts, err := s.cache.Incr(ctx, s.getChallengeAttemptsKey(token), s.config.ChallengeTTL)
+	if err != nil {
+		logger.FromContext(ctx).Warn("failed to record two-factor failure", "error", err)
+		return
+	}
+	if attempts >= challengeMaxAttempts {
+		_ = s.cache.Delete(ctx, s.getChallengeKey(token))
+		logger.FromContext(ctx).Warn("login challenge burned after repeated failures")
+	}
+}
+
+// verifyCode accepts a TOTP code or an unused recovery code of an enabled user
+func (s *TwoFactorService) verifyCode(ctx context.Context, userID uuid.UUID, code string) error {
+	totp, err := s.repo.GetTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return appErrors.ErrTwoFactorNotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+	if totp.EnabledAt == nil {
+		return appErrors.ErrTwoFactorNotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == 6 {
+		return s.verifyTOTP(ctx, totp, code)
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, userID, s.hashRecoveryCode(code), time.Now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return appErrors.ErrInvalidTwoFactorCode
+	}
+	logger.FromContext(ctx).Info("recovery code used", "user_id", userID.String())
+	return nil
+}
+
+func (s *TwoFactorService) verifyTOTP(ctx context.Context, totp *model.UserTOTP, code string) error {
+	secret, err := s.box.Open(totp.SecretEncrypted)
+	if err != nil {
+		return err
+	}
+
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return appErrors.ErrInvalidTwoFactorCode
+	}
+
+	fresh, err := s.repo.UseStep(ctx, totp.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return appErrors.ErrInvalidTwoFactorCode.WithMessage("two-factor code was already used")
+	}
+	return nil
+}
+
+// hashRecoveryCode ignores case and dashes so codes can be typed loosely
+func (s *TwoFactorService) hashRecoveryCode(code string) string {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	mac := hmac.New(sha256.New, []byte(s.config.EncryptionKey))
+	mac.Write([]byte(normalized))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateRecoveryCode returns codes like "ABCDE-FGHIJ"
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	code := recoveryCodeEncoding.EncodeToString(b)[:10]
+	return code[:5] + "-" + code[5:], nil
+}
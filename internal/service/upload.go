@@ -0,0 +1,533 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/cache"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/imaging"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/model"
+	"github.com/insanjati/fitbyte/internal/storage"
+	"github.com/insanjati/fitbyte/internal/tracing"
+)
+
+// maxUploadChunks is the most parts S3 joins into one object
+const maxUploadChunks = 10000
+
+// staleJoinedBatchSize is how many expired joined uploads one cleanup checks
+const staleJoinedBatchSize = 100
+
+// uploadExtensions are the content types accepted by resumable uploads
+var uploadExtensions = map[string]string{
+	"application/gpx+xml":            ".gpx",
+	"application/vnd.garmin.tcx+xml": ".tcx",
+	"application/vnd.ant.fit":        ".fit",
+	"video/mp4":                      ".mp4",
+	"video/quicktime":                ".mov",
+}
+
+type UploadConfig struct {
+	// SessionTTL is how long a resumable upload may take from start to end,
+	// unfinished uploads are aborted after it
+	SessionTTL time.Duration
+	// ChunkSize is the size of every chunk but the last, at least
+	// storage.MinPartSize
+	ChunkSize int64
+	// MaxSize is the largest file accepted
+	MaxSize         int64
+	CleanupInterval time.Duration
+}
+
+// uploadSession is kept in Redis until the upload completes or expires
+type uploadSession struct {
+	ID          uuid.UUID `json:"id"`
+	OwnerID     uuid.UUID `json:"ownerId"`
+	ObjectName  string    `json:"objectName"`
+	Target      string    `json:"target"`
+	Quarantined bool      `json:"quarantined"`
+	MultipartID string    `json:"multipartId"`
+	FileName    string    `json:"fileName"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	ChunkSize   int64     `json:"chunkSize"`
+	ChunkCount  int       `json:"chunkCount"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	// Joined is set once the chunks are joined into the object, the file
+	// may still have to be recorded
+	Joined bool `json:"joined"`
+}
+
+// chunkSize is the size chunk index must have
+func (u *uploadSession) chunkSize(index int) int64 {
+	if index == u.ChunkCount-1 {
+		return u.Size - u.ChunkSize*int64(u.ChunkCount-1)
+	}
+	return u.ChunkSize
+}
+
+// uploadedChunk is kept per chunk in a Redis hash so chunks can arrive in
+// parallel
+type uploadedChunk struct {
+	ETag   string `json:"etag"`
+	SHA256 string `json:"sha256"`
+}
+
+func uploadSessionKey(uploadID uuid.UUID) string {
+	return "upload_session:" + uploadID.String()
+}
+
+func uploadChunksKey(uploadID uuid.UUID) string {
+	return "upload_session:" + uploadID.String() + ":chunks"
+}
+
+// joinedUploadsKey is a sorted set of the uploads whose object may exist
+// without a file recording it, scored by when their session expires
+const joinedUploadsKey = "upload_sessions:joined"
+
+// joinedUpload is a member of joinedUploadsKey
+type joinedUpload struct {
+	ID      uuid.UUID `json:"id"`
+	OwnerID uuid.UUID `json:"ownerId"`
+	Target  string    `json:"target"`
+}
+
+func (u *uploadSession) joined() joinedUpload {
+	return joinedUpload{ID: u.ID, OwnerID: u.OwnerID, Target: u.Target}
+}
+
+// UploadService takes large files in chunks over several requests, each chunk
+// is a part of a multipart upload in storage. A dropped connection only costs
+// the chunk in flight.
+type UploadService struct {
+	storage storage.Storage
+	files   *FileService
+	cache   *cache.Redis
+	config  UploadConfig
+}
+
+func NewUploadService(storage storage.Storage, files *FileService, cache *cache.Redis, config UploadConfig) *UploadService {
+	return &UploadService{storage: storage, files: files, cache: cache, config: config}
+}
+
+func (s *UploadService) Create(ctx context.Context, ownerID uuid.UUID, req model.CreateUploadRequest) (*model.UploadSession, error) {
+	ctx, span := tracing.Start(ctx, "UploadService.Create")
+	defer span.End()
+
+	if req.Size > s.config.MaxSize {
+		return nil, appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "size", Tag: "max", Message: fmt.Sprintf("size must be at most %d bytes", s.config.MaxSize)})
+	}
+	chunkCount := int((req.Size + s.config.ChunkSize - 1) / s.config.ChunkSize)
+	if chunkCount > maxUploadChunks {
+		return nil, appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "size", Tag: "max", Message: "file needs too many chunks"})
+	}
+
+	id := uuid.New()
+	session := uploadSession{
+		ID:          id,
+		OwnerID:     ownerID,
+		ObjectName:  storage.UserObjectName(ownerID, id.String()+"/"+imaging.OriginalVariant+uploadExtensions[req.ContentType]),
+		FileName:    attachmentName(req.FileName),
+		ContentType: req.ContentType,
+		Size:        req.Size,
+		ChunkSize:   s.config.ChunkSize,
+		ChunkCount:  chunkCount,
+		ExpiresAt:   time.Now().Add(s.config.SessionTTL),
+	}
+	session.Target, session.Quarantined = s.files.UploadTarget(ownerID, session.ObjectName)
+
+	var err error
+	session.MultipartID, err = s.storage.NewMultipartUpload(ctx, session.Target, session.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache.SetExp(ctx, uploadSessionKey(id), session, s.config.SessionTTL); err != nil {
+		return nil, fmt.Errorf("failed to store upload session: %w", err)
+	}
+
+	return s.response(&session, nil), nil
+}
+
+// Get reports which chunks arrived, for resuming
+func (s *UploadService) Get(ctx context.Context, ownerID, uploadID uuid.UUID) (*model.UploadSession, error) {
+	ctx, span := tracing.Start(ctx, "UploadService.Get")
+	defer span.End()
+
+	session, err := s.session(ctx, ownerID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := s.chunks(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	return s.response(session, chunks), nil
+}
+
+// PutChunk stores chunk index when its content matches checksum, the hex
+// SHA-256 the client computed. Sending a chunk again replaces it.
+func (s *UploadService) PutChunk(ctx context.Context, ownerID, uploadID uuid.UUID, index int, checksum string, data io.Reader) (*model.UploadSession, error) {
+	ctx, span := tracing.Start(ctx, "UploadService.PutChunk")
+	defer span.End()
+
+	session, err := s.session(ctx, ownerID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Joined {
+		return nil, appErrors.ErrUploadCompleting
+	}
+	if index < 0 || index >= session.ChunkCount {
+		return nil, appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "index", Tag: "max", Message: fmt.Sprintf("chunk index must be between 0 and %d", session.ChunkCount-1)})
+	}
+	if _, err := hex.DecodeString(checksum); err != nil || len(checksum) != sha256.Size*2 {
+		return nil, appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "X-Chunk-SHA256", Tag: "required", Message: "X-Chunk-SHA256 must be the hex SHA-256 of the chunk"})
+	}
+
+	// One byte over the expected size is enough to tell the chunk is wrong
+	size := session.chunkSize(index)
+	content, err := io.ReadAll(io.LimitReader(data, size+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk: %w", err)
+	}
+	if int64(len(content)) != size {
+		return nil, appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "chunk", Tag: "len", Message: fmt.Sprintf("chunk %d must be %d bytes", index, size)})
+	}
+	sum := sha256.Sum256(content)
+	chunk := uploadedChunk{SHA256: hex.EncodeToString(sum[:])}
+	if chunk.SHA256 != strings.ToLower(checksum) {
+		return nil, appErrors.ErrChunkChecksumMismatch
+	}
+
+	chunk.ETag, err = s.storage.PutObjectPart(ctx, session.Target, session.MultipartID, index+1, bytes.NewReader(content), size, chunk.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache.HSetExp(ctx, uploadChunksKey(uploadID), strconv.Itoa(index), chunk, session.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	chunks, err := s.chunks(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	return s.response(session, chunks), nil
+}
+
+// Complete joins the chunks once all arrived and records the file. The
+// session outlives failures after the join, calling Complete again records
+// the joined object without uploading it again.
+func (s *UploadService) Complete(ctx context.Context, ownerID, uploadID uuid.UUID) (*model.StoredFile, error) {
+	ctx, span := tracing.Start(ctx, "UploadService.Complete")
+	defer span.End()
+
+	session, err := s.session(ctx, ownerID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.Joined {
+		// An earlier call may have failed after recording the file
+		file, err := s.files.Owned(ctx, ownerID, session.ID)
+		if err == nil {
+			s.finish(ctx, session)
+			return s.stored(ctx, file)
+		}
+		if !errors.Is(err, appErrors.ErrFileNotFound) {
+			return nil, err
+		}
+	} else if err := s.join(ctx, session); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkContent(ctx, session); err != nil {
+		var appErr *appErrors.AppError
+		if errors.As(err, &appErr) {
+			s.discard(ctx, session)
+		}
+		return nil, err
+	}
+
+	file := &model.File{
+		ID:          session.ID,
+		OwnerID:     ownerID,
+		ContentType: session.ContentType,
+		Size:        session.Size,
+		Objects:     map[string]string{imaging.OriginalVariant: session.ObjectName},
+		CreatedAt:   time.Now(),
+	}
+	// Failures here, a busy database or a full quota, can be retried
+	if err := s.files.Register(ctx, file, session.Quarantined); err != nil {
+		return nil, err
+	}
+	s.files.queueScan(file)
+	s.finish(ctx, session)
+
+	return s.stored(ctx, file)
+}
+
+// join completes the multipart upload once every chunk arrived. The upload
+// is tracked before so CleanupStale finds the object if the session is lost.
+func (s *UploadService) join(ctx context.Context, session *uploadSession) error {
+	chunks, err := s.chunks(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+
+	etags := make([]string, session.ChunkCount)
+	for i := range etags {
+		chunk, ok := chunks[i]
+		if !ok {
+			return appErrors.ErrUploadIncomplete.WithMessage(fmt.Sprintf("chunk %d has not been uploaded yet", i))
+		}
+		etags[i] = chunk.ETag
+	}
+
+	if err := s.cache.ZAddAt(ctx, joinedUploadsKey, session.joined(), session.ExpiresAt); err != nil {
+		return err
+	}
+	if err := s.storage.CompleteMultipartUpload(ctx, session.Target, session.MultipartID, etags); err != nil {
+		return err
+	}
+
+	session.Joined = true
+	if err := s.cache.SetExp(ctx, uploadSessionKey(session.ID), session, time.Until(session.ExpiresAt)); err != nil {
+		return fmt.Errorf("failed to store upload session: %w", err)
+	}
+	return nil
+}
+
+func (s *UploadService) stored(ctx context.Context, file *model.File) (*model.StoredFile, error) {
+	stored := &model.StoredFile{
+		ID:          file.ID,
+		URI:         s.files.URL(file, imaging.OriginalVariant),
+		ContentType: file.ContentType,
+		Size:        file.Size,
+		ScanStatus:  file.ScanStatus,
+	}
+	var err error
+	if stored.Links, err = s.files.SignedURLs(ctx, file); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// Abort drops an upload and the chunks it received, or the object they were
+// joined into
+func (s *UploadService) Abort(ctx context.Context, ownerID, uploadID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "UploadService.Abort")
+	defer span.End()
+
+	session, err := s.session(ctx, ownerID, uploadID)
+	if err != nil {
+		return err
+	}
+	if session.Joined {
+		// Too late when an earlier Complete recorded the file
+		_, err := s.files.Owned(ctx, ownerID, session.ID)
+		if err == nil || errors.Is(err, appErrors.ErrFileRejected) {
+			s.finish(ctx, session)
+			return nil
+		}
+		if !errors.Is(err, appErrors.ErrFileNotFound) {
+			return err
+		}
+	} else if err := s.storage.AbortMultipartUpload(ctx, session.Target, session.MultipartID); err != nil {
+		return err
+	}
+	// The join may have gone through without being recorded in the session
+	if err := s.storage.RemoveObject(ctx, session.Target); err != nil {
+		return err
+	}
+	s.finish(ctx, session)
+	return nil
+}
+
+func (s *UploadService) session(ctx context.Context, ownerID, uploadID uuid.UUID) (*uploadSession, error) {
+	var session uploadSession
+	err := s.cache.GetAs(ctx, uploadSessionKey(uploadID), &session)
+	if errors.Is(err, cache.ErrKeyNotExist) {
+		return nil, appErrors.ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.OwnerID != ownerID {
+		return nil, appErrors.ErrUploadNotFound
+	}
+	return &session, nil
+}
+
+func (s *UploadService) chunks(ctx context.Context, uploadID uuid.UUID) (map[int]uploadedChunk, error) {
+	fields, err := s.cache.HGetAll(ctx, uploadChunksKey(uploadID))
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make(map[int]uploadedChunk, len(fields))
+	for field, value := range fields {
+		index, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		var chunk uploadedChunk
+		if err := json.Unmarshal([]byte(value), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode uploaded chunk: %w", err)
+		}
+		chunks[index] = chunk
+	}
+	return chunks, nil
+}
+
+// finish drops the session once the upload is finished either way
+func (s *UploadService) finish(ctx context.Context, session *uploadSession) {
+	for _, key := range []string{uploadSessionKey(session.ID), uploadChunksKey(session.ID)} {
+		if err := s.cache.Delete(ctx, key); err != nil {
+			logger.FromContext(ctx).Warn("failed to delete upload session", "upload_id", session.ID.String(), "error", err)
+		}
+	}
+	if err := s.cache.ZRem(ctx, joinedUploadsKey, session.joined()); err != nil {
+		logger.FromContext(ctx).Warn("failed to untrack upload", "upload_id", session.ID.String(), "error", err)
+	}
+}
+
+// discard removes a joined upload that can never be recorded
+func (s *UploadService) discard(ctx context.Context, session *uploadSession) {
+	if err := s.storage.RemoveObject(ctx, session.Target); err != nil {
+		// Left tracked for CleanupStale
+		logger.FromContext(ctx).Warn("failed to remove rejected upload", "object", session.Target, "error", err)
+		return
+	}
+	s.finish(ctx, session)
+}
+
+// checkContent compares the start of the joined file with its announced type
+func (s *UploadService) checkContent(ctx context.Context, session *uploadSession) error {
+	object, err := s.storage.GetObject(ctx, session.Target)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(object, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+	if !matchesContentType(session.ContentType, head[:n]) {
+		return appErrors.ErrValidation.WithFields(appErrors.FieldError{Field: "contentType", Tag: "mimetype", Message: "uploaded file does not match the announced content type"})
+	}
+	return nil
+}
+
+// matchesContentType recognizes the uploads by their first bytes: MP4 and
+// QuickTime start with an ftyp box, FIT files carry ".FIT" in their header,
+// GPX and TCX are XML
+func matchesContentType(contentType string, head []byte) bool {
+	switch contentType {
+	case "video/mp4", "video/quicktime":
+		return len(head) >= 8 && string(head[4:8]) == "ftyp"
+	case "application/vnd.ant.fit":
+		return len(head) >= 12 && string(head[8:12]) == ".FIT"
+	default:
+		head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+		return bytes.HasPrefix(bytes.TrimLeft(head, " \t\r\n"), []byte("<"))
+	}
+}
+
+func (s *UploadService) response(session *uploadSession, chunks map[int]uploadedChunk) *model.UploadSession {
+	received := make([]int, 0, len(chunks))
+	for index := range chunks {
+		received = append(received, index)
+	}
+	sort.Ints(received)
+
+	return &model.UploadSession{
+		UploadID:       session.ID,
+		FileName:       session.FileName,
+		ContentType:    session.ContentType,
+		Size:           session.Size,
+		ChunkSize:      session.ChunkSize,
+		ChunkCount:     session.ChunkCount,
+		ReceivedChunks: received,
+		ExpiresAt:      session.ExpiresAt,
+	}
+}
+
+// CleanupStale aborts uploads whose session expired, their parts would
+// otherwise stay in storage, and removes objects joined by expired sessions
+// that were never recorded as files
+func (s *UploadService) CleanupStale(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "UploadService.CleanupStale")
+	defer span.End()
+
+	aborted, err := s.storage.AbortStaleMultipartUploads(ctx, time.Now().Add(-s.config.SessionTTL))
+	if err != nil {
+		return aborted, err
+	}
+
+	members, err := s.cache.ZRangeBefore(ctx, joinedUploadsKey, time.Now(), staleJoinedBatchSize)
+	if err != nil {
+		return aborted, err
+	}
+	for _, member := range members {
+		var upload joinedUpload
+		if err := json.Unmarshal([]byte(member), &upload); err != nil {
+			return aborted, fmt.Errorf("failed to decode joined upload: %w", err)
+		}
+
+		// Recorded files are left to the files garbage collector
+		_, err := s.files.Owned(ctx, upload.OwnerID, upload.ID)
+		switch {
+		case errors.Is(err, appErrors.ErrFileNotFound):
+			if err := s.storage.RemoveObject(ctx, upload.Target); err != nil {
+				return aborted, err
+			}
+			aborted++
+		case err != nil && !errors.Is(err, appErrors.ErrFileRejected):
+			return aborted, err
+		}
+		if err := s.cache.ZRem(ctx, joinedUploadsKey, upload); err != nil {
+			return aborted, err
+		}
+	}
+	return aborted, nil
+}
+
+// Run cleans up stale uploads every CleanupInterval until ctx is cancelled
+func (s *UploadService) Run(ctx context.Context) {
+	if s.config.CleanupInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			aborted, err := s.CleanupStale(ctx)
+			if err != nil {
+				logger.FromContext(ctx).Error("upload cleanup failed", "error", err)
+				continue
+			}
+			if aborted > 0 {
+				logger.FromContext(ctx).Info("aborted stale uploads", "count", aborted)
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package service
+
+import "testing"
+
+func TestMatchesContentType(t *testing.T) {
+	fitHeader := []byte{14, 0x10, 0x6c, 0x08, 0x12, 0, 0, 0, '.', 'F', 'I', 'T', 0, 0}
+
+	tests := []struct {
+		name        string
+		contentType string
+		head        []byte
+		want        bool
+	}{
+		{"mp4", "video/mp4", []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00"), true},
+		{"quicktime", "video/quicktime", []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"), true},
+		{"mp4 without ftyp", "video/mp4", []byte("\x00\x00\x00\x20moov"), false},
+		{"mp4 too short", "video/mp4", []byte("\x00\x00\x00\x20fty"), false},
+		{"fit", "application/vnd.ant.fit", fitHeader, true},
+		{"fit too short", "application/vnd.ant.fit", fitHeader[:11], false},
+		{"fit announced for mp4", "application/vnd.ant.fit", []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00"), false},
+		{"gpx", "application/gpx+xml", []byte(`<?xml version="1.0"?><gpx>`), true},
+		{"gpx with bom", "application/gpx+xml", []byte("\xef\xbb\xbf<?xml version=\"1.0\"?>"), true},
+		{"gpx with leading space", "application/gpx+xml", []byte("\r\n  <gpx>"), true},
+		{"tcx", "application/vnd.garmin.tcx+xml", []byte(`<TrainingCenterDatabase>`), true},
+		{"xml announced but binary", "application/gpx+xml", fitHeader, false},
+		{"xml announced but json", "application/vnd.garmin.tcx+xml", []byte(`{"activity": 1}`), false},
+		{"empty", "application/gpx+xml", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesContentType(tt.contentType, tt.head); got != tt.want {
+				t.Errorf("matchesContentType(%q, %q) = %v, want %v", tt.contentType, tt.head, got, tt.want)
+			}
+		})
+	}
+}
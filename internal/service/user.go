@@ -2,14 +2,18 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/insanjati/fitbyte/internal/cache"
+	appErrors "github.com/insanjati/fitbyte/internal/errors"
+	"github.com/insanjati/fitbyte/internal/logger"
+	"github.com/insanjati/fitbyte/internal/metrics"
 	"github.com/insanjati/fitbyte/internal/model"
 	"github.com/insanjati/fitbyte/internal/repository"
+	"github.com/insanjati/fitbyte/internal/tracing"
 	"github.com/insanjati/fitbyte/internal/utils"
 
 	"github.com/google/uuid"
@@ -20,70 +24,151 @@ type UserService struct {
 	cache      *cache.Redis
 	userUtils  utils.PasswordHasher
 	jwtService JwtService
+	loginGuard *loginGuard
+	accounts   *AccountService
+	sessions   *SessionService
+	twoFactor  *TwoFactorService
+	audit      *AuditService
+	files      *FileService
 }
 
-func NewUserService(userRepo *repository.UserRepository, cache *cache.Redis, jwt JwtService) *UserService {
+func NewUserService(userRepo *repository.UserRepository, cache *cache.Redis, jwt JwtService, accounts *AccountService, sessions *SessionService, twoFactor *TwoFactorService, audit *AuditService, files *FileService, lockout LockoutConfig) *UserService {
 	return &UserService{
 		userRepo:   userRepo,
 		cache:      cache,
 		userUtils:  utils.NewPasswordHasher(),
 		jwtService: jwt,
+		loginGuard: &loginGuard{cache: cache, config: lockout},
+		accounts:   accounts,
+		sessions:   sessions,
+		twoFactor:  twoFactor,
+		audit:      audit,
+		files:      files,
 	}
 }
 
-func (s *UserService) FindUserById(userId uuid.UUID) (*model.UserResponse, error) {
-	ctx := context.Background()
+func (s *UserService) FindUserById(ctx context.Context, userId uuid.UUID) (*model.UserResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.FindUserById")
+	defer span.End()
+
 	cacheKey := fmt.Sprintf("user:id:%s", userId.String())
 
 	// Try cache first using GetAs
 	var cachedUser model.UserResponse
 	if err := s.cache.GetAs(ctx, cacheKey, &cachedUser); err == nil {
-		return &cachedUser, nil
+		return s.signImage(ctx, &cachedUser), nil
 	}
 
-	user, err := s.userRepo.GetUserById(userId)
+	user, err := s.userRepo.GetUserById(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, appErrors.ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	_ = s.cache.Set(ctx, cacheKey, user, 10*time.Minute)
 
-	return user, nil
+	return s.signImage(ctx, user), nil
 }
 
-func (s *UserService) UpdateUser(userId uuid.UUID, user *model.UpdateUserRequest) (*model.UserResponse, error) {
-	ctx := context.Background()
+// signImage swaps the stored image URL for a signed link, the cache keeps the
+// stored URL since links expire
+func (s *UserService) signImage(ctx context.Context, user *model.UserResponse) *model.UserResponse {
+	if user.ImageUri == nil || *user.ImageUri == "" {
+		return user
+	}
+	signed := *user
+	imageURI := s.files.SignURI(ctx, *user.ImageUri)
+	signed.ImageUri = &imageURI
+	return &signed
+}
+
+func (s *UserService) UpdateUser(ctx context.Context, userId uuid.UUID, user *model.UpdateUserRequest) (*model.UserResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser")
+	defer span.End()
+
 	cacheKey := fmt.Sprintf("user:id:%s", userId.String())
 
-	prevUser, err := s.userRepo.GetUserById(userId)
+	prevUser, err := s.userRepo.GetUserById(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, appErrors.ErrUserNotFound
+	}
 	if err != nil {
-		return nil, errors.New("user not found")
+		return nil, err
 	}
 
 	if user.Name == nil || *user.Name == "" {
 		user.Name = prevUser.Name
 	}
+	imageChanged := false
+	var image *model.File
 	if user.ImageUri == nil || *user.ImageUri == "" {
 		user.ImageUri = prevUser.ImageUri
+	} else if prevUser.ImageUri == nil || *user.ImageUri != *prevUser.ImageUri {
+		if image, err = s.files.ResolveURI(ctx, userId, *user.ImageUri); err != nil {
+			return nil, err
+		}
+		imageChanged = true
+	}
+
+	// The reference comes first: an image the row points at without one would
+	// be collected. A previous upload is released, an image outside the bucket
+	// references nothing.
+	if imageChanged {
+		if err := s.files.SetReference(ctx, FileReferenceUserImage, userId.String(), image); err != nil {
+			return nil, err
+		}
 	}
 
-	updated, err := s.userRepo.UpdateUser(userId, user)
+	updated, err := s.userRepo.UpdateUser(ctx, userId, user)
 	if err != nil {
+		if imageChanged {
+			s.restoreImageReference(ctx, userId, prevUser.ImageUri)
+		}
 		return nil, err
 	}
 
 	if err := s.cache.Delete(ctx, cacheKey); err != nil {
-		log.Printf("WARN: failed to invalidate cache for user %s: %v", userId, err)
+		logger.FromContext(ctx).Warn("failed to invalidate user cache", "error", err)
 	}
 
-	if err := s.cache.SetExp(context.Background(), cacheKey, updated, 10*time.Minute); err != nil {
-		log.Printf("WARN: failed to cache updated user %s: %v", userId, err)
+	if err := s.cache.SetExp(ctx, cacheKey, updated, 10*time.Minute); err != nil {
+		logger.FromContext(ctx).Warn("failed to cache updated user", "error", err)
 	}
 
-	return updated, nil
+	s.audit.Record(ctx, AuditEvent{
+		ActorID:    userId,
+		SubjectID:  userId,
+		Action:     "user.updated",
+		EntityType: "user",
+		EntityID:   userId.String(),
+		Before:     prevUser,
+		After:      updated,
+	})
+	return s.signImage(ctx, updated), nil
+}
+
+// restoreImageReference points the image reference back at the image the
+// user row still has after a failed update
+func (s *UserService) restoreImageReference(ctx context.Context, userId uuid.UUID, imageURI *string) {
+	var file *model.File
+	if imageURI != nil && *imageURI != "" {
+		var err error
+		if file, _, err = s.files.lookup(ctx, *imageURI); err != nil {
+			logger.FromContext(ctx).Error("failed to restore image reference", "error", err)
+			return
+		}
+	}
+	if err := s.files.SetReference(ctx, FileReferenceUserImage, userId.String(), file); err != nil {
+		logger.FromContext(ctx).Error("failed to restore image reference", "error", err)
+	}
 }
 
 func (s *UserService) RegisterNewUser(ctx context.Context, payload model.User) (model.AuthResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.RegisterNewUser")
+	defer span.End()
+
 	// Business Logiv
 	// Check if email exists Import get email function
 
@@ -106,9 +191,16 @@ func (s *UserService) RegisterNewUser(ctx context.Context, payload model.User) (
 	createdUser, err := s.userRepo.RegisterNewUser(ctx, payload)
 	if err != nil {
 		if ctx.Err() != nil {
-			return model.AuthResponse{}, fmt.Errorf("context error: %v", ctx.Err())
+			return model.AuthResponse{}, fmt.Errorf("context error: %w", err)
 		}
-		return model.AuthResponse{}, fmt.Errorf("failed to create user: %v", err)
+		return model.AuthResponse{}, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	metrics.UsersRegisteredTotal.Inc()
+
+	// A failed mail must not fail the registration, the user can ask for a new link
+	if err := s.accounts.SendVerification(ctx, createdUser.ID, createdUser.Email); err != nil {
+		logger.FromContext(ctx).Error("failed to send verification email", "error", err)
 	}
 
 	token, err := s.jwtService.GenerateToken(&createdUser)
@@ -120,20 +212,99 @@ func (s *UserService) RegisterNewUser(ctx context.Context, payload model.User) (
 }
 
 func (s *UserService) Login(ctx context.Context, payload model.User) (model.AuthResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Login")
+	defer span.End()
+
+	var fields []appErrors.FieldError
 	if payload.Email == "" {
-		return model.AuthResponse{}, fmt.Errorf("email is required")
+		fields = append(fields, appErrors.FieldError{Field: "email", Tag: "required", Message: "email is required"})
 	}
 	if payload.Password == "" {
-		return model.AuthResponse{}, fmt.Errorf("password is required")
+		fields = append(fields, appErrors.FieldError{Field: "password", Tag: "required", Message: "password is required"})
+	}
+	if len(fields) > 0 {
+		return model.AuthResponse{}, appErrors.ErrValidation.WithFields(fields...)
+	}
+
+	if err := s.loginGuard.check(ctx, payload.Email); err != nil {
+		metrics.LoginsTotal.WithLabelValues("locked").Inc()
+		return model.AuthResponse{}, err
 	}
 
 	user, err := s.userRepo.GetUserByEmail(ctx, payload.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Same answer and about the same time as a wrong password, so the
+		// response does not tell which emails have an account
+		_ = s.userUtils.ComparePasswordHash(dummyPasswordHash, payload.Password)
+		metrics.LoginsTotal.WithLabelValues("unknown_user").Inc()
+		s.loginGuard.fail(ctx, payload.Email)
+		return model.AuthResponse{}, appErrors.ErrInvalidCredentials
+	}
 	if err != nil {
-		return model.AuthResponse{}, fmt.Errorf("user not found")
+		return model.AuthResponse{}, err
 	}
 
 	if err := s.userUtils.ComparePasswordHash(user.Password, payload.Password); err != nil {
-		return model.AuthResponse{}, fmt.Errorf("invalid credentials")
+		metrics.LoginsTotal.WithLabelValues("invalid_password").Inc()
+		s.loginGuard.fail(ctx, payload.Email)
+		s.audit.Record(ctx, AuditEvent{
+			SubjectID:  user.ID,
+			Action:     "user.login_failed",
+			EntityType: "user",
+			EntityID:   user.ID.String(),
+			Metadata:   map[string]string{"method": "password", "reason": "invalid_password"},
+		})
+		return model.AuthResponse{}, appErrors.ErrInvalidCredentials.Wrap(err)
+	}
+	if user.DeletedAt != nil {
+		metrics.LoginsTotal.WithLabelValues("deleted").Inc()
+		return model.AuthResponse{}, appErrors.ErrAccountDeleted
+	}
+	if user.DisabledAt != nil {
+		metrics.LoginsTotal.WithLabelValues("disabled").Inc()
+		return model.AuthResponse{}, appErrors.ErrAccountDisabled
+	}
+	metrics.LoginsTotal.WithLabelValues("success").Inc()
+	s.loginGuard.reset(ctx, payload.Email)
+
+	// Users with 2FA get a challenge token and finish through TwoFactorService.CompleteLogin
+	return s.twoFactor.SignIn(ctx, &user, "password")
+}
+
+// ChangePassword revokes every existing session and returns a fresh token so
+// only the caller stays signed in
+func (s *UserService) ChangePassword(ctx context.Context, userId uuid.UUID, req model.ChangePasswordRequest) (model.AuthResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ChangePassword")
+	defer span.End()
+
+	currentHash, err := s.userRepo.GetPasswordHash(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.AuthResponse{}, appErrors.ErrUserNotFound
+	}
+	if err != nil {
+		return model.AuthResponse{}, err
+	}
+
+	if err := s.userUtils.ComparePasswordHash(currentHash, req.CurrentPassword); err != nil {
+		return model.AuthResponse{}, appErrors.ErrWrongPassword.Wrap(err)
+	}
+
+	hashedPassword, err := s.userUtils.EncryptPassword(req.NewPassword)
+	if err != nil {
+		return model.AuthResponse{}, fmt.Errorf("failed to encrypt password: %v", err)
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, userId, hashedPassword); err != nil {
+		return model.AuthResponse{}, err
+	}
+	if err := s.sessions.Revoke(ctx, userId); err != nil {
+		return model.AuthResponse{}, err
+	}
+	s.audit.Record(ctx, AuditEvent{ActorID: userId, SubjectID: userId, Action: "user.password_changed", EntityType: "user", EntityID: userId.String()})
+
+	user, err := s.userRepo.GetUserAuth(ctx, userId)
+	if err != nil {
+		return model.AuthResponse{}, err
 	}
 
 	token, err := s.jwtService.GenerateToken(&user)
@@ -141,5 +312,13 @@ func (s *UserService) Login(ctx context.Context, payload model.User) (model.Auth
 		return model.AuthResponse{}, fmt.Errorf("failed to generate token: %v", err)
 	}
 
-	return model.AuthResponse{Email: payload.Email, Token: token}, nil
+	return model.AuthResponse{Email: user.Email, Token: token}, nil
+}
+
+// ListAudit returns the audit log entries about the user's own account
+func (s *UserService) ListAudit(ctx context.Context, userId uuid.UUID, limit, offset int) ([]model.AuditEntry, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ListAudit")
+	defer span.End()
+
+	return s.audit.ListForUser(ctx, userId, limit, offset)
 }
@@ -0,0 +1,427 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/metrics"
+	"github.com/insanjati/fitbyte/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Form fields of a presigned local upload
+const (
+	localFieldKey         = "key"
+	localFieldContentType = "Content-Type"
+	localFieldMaxSize     = "x-fitbyte-max-size"
+	localFieldExpires     = "x-fitbyte-expires"
+	localFieldSignature   = "x-fitbyte-signature"
+)
+
+// Query parameters of a presigned local download
+const (
+	localParamExpires   = "expires"
+	localParamSignature = "signature"
+)
+
+// localMultipartDir holds the parts of unfinished multipart uploads, one
+// folder per upload
+const localMultipartDir = ".multipart"
+
+var (
+	ErrInvalidSignature = errors.New("signature is invalid or expired")
+	ErrObjectTooLarge   = errors.New("object exceeds the allowed size")
+	ErrChecksumMismatch = errors.New("checksum does not match the content")
+	ErrUploadNotFound   = errors.New("multipart upload not found")
+)
+
+type LocalConfig struct {
+	// Root is the directory objects are stored in
+	Root string
+	// BaseURL is where the app serves objects, object names are appended to it
+	BaseURL string
+	// SigningKey signs presigned uploads
+	SigningKey string
+}
+
+// LocalStorage keeps objects on the local disk for tests and small
+// deployments. Objects are served by the app itself to presigned URLs.
+type LocalStorage struct {
+	config *LocalConfig
+}
+
+func NewLocalStorage(config *LocalConfig) (*LocalStorage, error) {
+	if config.SigningKey == "" {
+		return nil, errors.New("local storage requires a signing key")
+	}
+	if err := os.MkdirAll(config.Root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	return &LocalStorage{config: config}, nil
+}
+
+// path maps objectName into Root, ".." cannot climb out of it
+func (s *LocalStorage) path(objectName string) (string, error) {
+	clean := path.Clean("/" + objectName)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid object name %q", objectName)
+	}
+	return filepath.Join(s.config.Root, filepath.FromSlash(clean)), nil
+}
+
+// PutObject writes to a temporary file first so readers never see a partial object
+func (s *LocalStorage) PutObject(ctx context.Context, objectName, contentType string, data io.Reader, size int64) error {
+	ctx, span := tracing.Start(ctx, "LocalStorage.PutObject",
+		attribute.String("storage.object", objectName),
+		attribute.Int64("storage.size", size),
+	)
+	start := time.Now()
+	err := s.write(objectName, data)
+	tracing.End(span, err)
+	if err != nil {
+		metrics.StorageUploadDuration.WithLabelValues("local", "error").Observe(time.Since(start).Seconds())
+		return err
+	}
+	metrics.StorageUploadDuration.WithLabelValues("local", "success").Observe(time.Since(start).Seconds())
+	metrics.StorageUploadBytes.WithLabelValues("local").Observe(float64(size))
+
+	return nil
+}
+
+func (s *LocalStorage) write(objectName string, data io.Reader) error {
+	name, err := s.path(objectName)
+	if err != nil {
+		return err
+	}
+	return writeFile(name, data)
+}
+
+func writeFile(name string, data io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s *LocalStorage) GetObject(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	name, err := s.path(objectName)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return file, err
+}
+
+func (s *LocalStorage) StatObject(ctx context.Context, objectName string) (int64, error) {
+	name, err := s.path(objectName)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(name)
+	if errors.Is(err, os.ErrNotExist) || err == nil && info.IsDir() {
+		return 0, ErrObjectNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (s *LocalStorage) RemoveObject(ctx context.Context, objectName string) error {
+	name, err := s.path(objectName)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) MoveObject(ctx context.Context, srcName, dstName string) error {
+	src, err := s.path(srcName)
+	if err != nil {
+		return err
+	}
+	dst, err := s.path(dstName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+	err = os.Rename(src, dst)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+// PresignedPost signs a form the client posts to the app like it would to an
+// S3 POST policy
+func (s *LocalStorage) PresignedPost(ctx context.Context, objectName, contentType string, maxSize int64, expiresAt time.Time) (string, map[string]string, error) {
+	formData := map[string]string{
+		localFieldKey:         objectName,
+		localFieldContentType: contentType,
+		localFieldMaxSize:     strconv.FormatInt(maxSize, 10),
+		localFieldExpires:     strconv.FormatInt(expiresAt.Unix(), 10),
+	}
+	formData[localFieldSignature] = s.sign(formData)
+	return s.config.BaseURL, formData, nil
+}
+
+func (s *LocalStorage) sign(formData map[string]string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.SigningKey))
+	for _, field := range []string{localFieldKey, localFieldContentType, localFieldMaxSize, localFieldExpires} {
+		mac.Write([]byte(formData[field]))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AcceptPost stores a file posted with the form returned by PresignedPost
+func (s *LocalStorage) AcceptPost(ctx context.Context, formData map[string]string, file io.Reader) error {
+	signature := formData[localFieldSignature]
+	if !hmac.Equal([]byte(signature), []byte(s.sign(formData))) {
+		return ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(formData[localFieldExpires], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrInvalidSignature
+	}
+	maxSize, err := strconv.ParseInt(formData[localFieldMaxSize], 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	// One byte over the limit is enough to tell the file is too large
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > maxSize {
+		return ErrObjectTooLarge
+	}
+
+	return s.PutObject(ctx, formData[localFieldKey], formData[localFieldContentType], bytes.NewReader(data), int64(len(data)))
+}
+
+// PresignedGet signs a download URL served by ServeObject
+func (s *LocalStorage) PresignedGet(ctx context.Context, objectName string, expiry time.Duration) (string, error) {
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	query := url.Values{
+		localParamExpires:   {expires},
+		localParamSignature: {s.signGet(objectName, expires)},
+	}
+	return s.config.BaseURL + "/" + objectName + "?" + query.Encode(), nil
+}
+
+func (s *LocalStorage) signGet(objectName, expires string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.SigningKey))
+	mac.Write([]byte("GET\x00" + objectName + "\x00" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeObject writes objectName to w when r carries a valid signature from
+// PresignedGet, with range and conditional request support
+func (s *LocalStorage) ServeObject(w http.ResponseWriter, r *http.Request, objectName string) error {
+	query := r.URL.Query()
+	expires := query.Get(localParamExpires)
+	if !hmac.Equal([]byte(query.Get(localParamSignature)), []byte(s.signGet(objectName, expires))) {
+		return ErrInvalidSignature
+	}
+	if unix, err := strconv.ParseInt(expires, 10, 64); err != nil || time.Now().Unix() > unix {
+		return ErrInvalidSignature
+	}
+
+	name, err := s.path(objectName)
+	if err != nil {
+		return ErrObjectNotFound
+	}
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrObjectNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return ErrObjectNotFound
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private")
+	http.ServeContent(w, r, path.Base(objectName), info.ModTime(), file)
+	return nil
+}
+
+// partsDir is the folder of a multipart upload, upload IDs are UUIDs so they
+// cannot point elsewhere
+func (s *LocalStorage) partsDir(uploadID string) (string, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", ErrUploadNotFound
+	}
+	return filepath.Join(s.config.Root, localMultipartDir, uploadID), nil
+}
+
+func partName(dir string, partNumber int) string {
+	return filepath.Join(dir, fmt.Sprintf("%05d", partNumber))
+}
+
+func (s *LocalStorage) NewMultipartUpload(ctx context.Context, objectName, contentType string) (string, error) {
+	uploadID := uuid.New().String()
+	dir, err := s.partsDir(uploadID)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	return uploadID, nil
+}
+
+// PutObjectPart keeps the part in the folder of the upload, its ETag is its
+// SHA-256
+func (s *LocalStorage) PutObjectPart(ctx context.Context, objectName, uploadID string, partNumber int, data io.Reader, size int64, sha256Hex string) (string, error) {
+	dir, err := s.partsDir(uploadID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return "", ErrUploadNotFound
+	}
+
+	hash := sha256.New()
+	content, err := io.ReadAll(io.TeeReader(io.LimitReader(data, size), hash))
+	if err != nil {
+		return "", err
+	}
+	etag := hex.EncodeToString(hash.Sum(nil))
+	if int64(len(content)) != size || sha256Hex != "" && etag != sha256Hex {
+		return "", ErrChecksumMismatch
+	}
+
+	if err := writeFile(partName(dir, partNumber), bytes.NewReader(content)); err != nil {
+		return "", err
+	}
+	return etag, nil
+}
+
+// CompleteMultipartUpload writes the parts one after the other into the object
+func (s *LocalStorage) CompleteMultipartUpload(ctx context.Context, objectName, uploadID string, etags []string) error {
+	dir, err := s.partsDir(uploadID)
+	if err != nil {
+		return err
+	}
+
+	parts := make([]io.Reader, len(etags))
+	for i := range etags {
+		part, err := os.Open(partName(dir, i+1))
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrUploadNotFound
+		}
+		if err != nil {
+			return err
+		}
+		defer part.Close()
+		parts[i] = part
+	}
+
+	if err := s.write(objectName, io.MultiReader(parts...)); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *LocalStorage) AbortMultipartUpload(ctx context.Context, objectName, uploadID string) error {
+	dir, err := s.partsDir(uploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// AbortStaleMultipartUploads removes upload folders last written to before
+// cutoff
+func (s *LocalStorage) AbortStaleMultipartUploads(ctx context.Context, cutoff time.Time) (int, error) {
+	root := filepath.Join(s.config.Root, localMultipartDir)
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	aborted := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !entry.IsDir() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+			return aborted, err
+		}
+		aborted++
+	}
+	return aborted, nil
+}
+
+func (s *LocalStorage) RemoveUserFiles(ctx context.Context, ownerID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "LocalStorage.RemoveUserFiles",
+		attribute.String("storage.prefix", userPrefix(ownerID)),
+	)
+	dir, err := s.path(userPrefix(ownerID))
+	if err == nil {
+		err = os.RemoveAll(dir)
+	}
+	tracing.End(span, err)
+	return err
+}
+
+func (s *LocalStorage) ObjectName(uri string) (string, bool) {
+	prefix := s.config.BaseURL + "/"
+	if !strings.HasPrefix(uri, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(uri, prefix), true
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocalStorage(t *testing.T) *LocalStorage {
+	t.Helper()
+	s, err := NewLocalStorage(&LocalConfig{
+		Root:       filepath.Join(t.TempDir(), "objects"),
+		BaseURL:    "http://localhost:8080/api/v1/files/",
+		SigningKey: "test-signing-key",
+	})
+	if err != nil {
+		t.Fatalf("NewLocalStorage() error = %v", err)
+	}
+	return s
+}
+
+func TestLocalStoragePath(t *testing.T) {
+	s := newTestLocalStorage(t)
+	root := s.config.Root
+
+	tests := []struct {
+		name       string
+		objectName string
+		want       string
+		wantErr    bool
+	}{
+		{"object", "uploads/a/b.png", filepath.Join(root, "uploads", "a", "b.png"), false},
+		{"parent", "../secret", filepath.Join(root, "secret"), false},
+		{"nested parent", "uploads/../../../etc/passwd", filepath.Join(root, "etc", "passwd"), false},
+		{"absolute", "/etc/passwd", filepath.Join(root, "etc", "passwd"), false},
+		{"empty", "", "", true},
+		{"root", "/", "", true},
+		{"only parents", "../..", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.path(tt.objectName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("path(%q) error = %v, wantErr %v", tt.objectName, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("path(%q) = %q, want %q", tt.objectName, got, tt.want)
+			}
+			if err == nil && !strings.HasPrefix(got, root+string(filepath.Separator)) {
+				t.Errorf("path(%q) = %q is outside %q", tt.objectName, got, root)
+			}
+		})
+	}
+}
+
+func TestLocalStorageAcceptPost(t *testing.T) {
+	tests := []struct {
+		name    string
+		expires time.Time
+		tamper  func(formData map[string]string)
+		content string
+		wantErr error
+	}{
+		{"valid", time.Now().Add(time.Minute), nil, "hello", nil},
+		{"expired", time.Now().Add(-time.Minute), nil, "hello", ErrInvalidSignature},
+		{"other key", time.Now().Add(time.Minute), func(f map[string]string) { f[localFieldKey] = "uploads/other.png" }, "hello", ErrInvalidSignature},
+		{"other content type", time.Now().Add(time.Minute), func(f map[string]string) { f[localFieldContentType] = "text/html" }, "hello", ErrInvalidSignature},
+		{"larger limit", time.Now().Add(time.Minute), func(f map[string]string) { f[localFieldMaxSize] = "1000" }, "hello", ErrInvalidSignature},
+		{"later expiry", time.Now().Add(time.Minute), func(f map[string]string) { f[localFieldExpires] = "99999999999" }, "hello", ErrInvalidSignature},
+		{"no signature", time.Now().Add(time.Minute), func(f map[string]string) { delete(f, localFieldSignature) }, "hello", ErrInvalidSignature},
+		{"too large", time.Now().Add(time.Minute), nil, "hello world", ErrObjectTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestLocalStorage(t)
+			_, formData, err := s.PresignedPost(context.Background(), "uploads/a.png", "image/png", 5, tt.expires)
+			if err != nil {
+				t.Fatalf("PresignedPost() error = %v", err)
+			}
+			if tt.tamper != nil {
+				tt.tamper(formData)
+			}
+
+			err = s.AcceptPost(context.Background(), formData, strings.NewReader(tt.content))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AcceptPost() error = %v, want %v", err, tt.wantErr)
+			}
+
+			_, statErr := s.StatObject(context.Background(), "uploads/a.png")
+			if stored := statErr == nil; stored != (tt.wantErr == nil) {
+				t.Errorf("object stored = %v, want %v", stored, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestLocalStorageServeObject(t *testing.T) {
+	tests := []struct {
+		name       string
+		objectName string
+		expiry     time.Duration
+		tamper     func(query url.Values)
+		serveName  string
+		wantErr    error
+	}{
+		{"valid", "uploads/a.txt", time.Minute, nil, "uploads/a.txt", nil},
+		{"expired", "uploads/a.txt", -time.Minute, nil, "uploads/a.txt", ErrInvalidSignature},
+		{"other object", "uploads/a.txt", time.Minute, nil, "uploads/b.txt", ErrInvalidSignature},
+		{"later expiry", "uploads/a.txt", time.Minute, func(q url.Values) { q.Set(localParamExpires, "99999999999") }, "uploads/a.txt", ErrInvalidSignature},
+		{"bad signature", "uploads/a.txt", time.Minute, func(q url.Values) { q.Set(localParamSignature, strings.Repeat("0", 64)) }, "uploads/a.txt", ErrInvalidSignature},
+		{"missing", "uploads/missing.txt", time.Minute, nil, "uploads/missing.txt", ErrObjectNotFound},
+		{"folder", "uploads", time.Minute, nil, "uploads", ErrObjectNotFound},
+		{"outside root", "../outside.txt", time.Minute, nil, "../outside.txt", ErrObjectNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestLocalStorage(t)
+			for _, name := range []string{"uploads/a.txt", "uploads/b.txt"} {
+				if err := s.PutObject(context.Background(), name, "text/plain", strings.NewReader("content of "+name), 0); err != nil {
+					t.Fatalf("PutObject(%q) error = %v", name, err)
+				}
+			}
+			// Next to Root, reachable only by climbing out of it
+			outside := filepath.Join(filepath.Dir(s.config.Root), "outside.txt")
+			if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			signed, err := s.PresignedGet(context.Background(), tt.objectName, tt.expiry)
+			if err != nil {
+				t.Fatalf("PresignedGet() error = %v", err)
+			}
+			u, err := url.Parse(signed)
+			if err != nil {
+				t.Fatalf("invalid presigned URL %q: %v", signed, err)
+			}
+			query := u.Query()
+			if tt.tamper != nil {
+				tt.tamper(query)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/?"+query.Encode(), nil)
+			w := httptest.NewRecorder()
+			err = s.ServeObject(w, r, tt.serveName)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ServeObject() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				if got, want := w.Body.String(), "content of "+tt.serveName; got != want {
+					t.Errorf("body = %q, want %q", got, want)
+				}
+				if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+					t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+				}
+			}
+		})
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"path/filepath"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/insanjati/fitbyte/internal/metrics"
+	"github.com/insanjati/fitbyte/internal/tracing"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type MinIOConfig struct {
@@ -19,10 +23,17 @@ type MinIOConfig struct {
 	BucketName     string
 	PublicEndpoint string
 	UseSSL         bool
+	// Region is needed to sign URLs without asking the server for it
+	Region string
 }
 
+// MinIOStorage keeps objects in a private bucket, clients get presigned URLs
 type MinIOStorage struct {
 	client *minio.Client
+	// core exposes the multipart calls the client hides
+	core *minio.Core
+	// signer signs URLs for the public endpoint, it never connects
+	signer *minio.Client
 	config *MinIOConfig
 }
 
@@ -35,8 +46,24 @@ func NewMinIOStorage(config *MinIOConfig) (*MinIOStorage, error) {
 		return nil, fmt.Errorf("failed to initialize MinIO client: %w", err)
 	}
 
+	// Presigned URLs cover the host, they must be signed for the one clients use
+	public, err := url.Parse(config.PublicEndpoint)
+	if err != nil || public.Host == "" {
+		return nil, fmt.Errorf("invalid MinIO public endpoint %q", config.PublicEndpoint)
+	}
+	signer, err := minio.New(public.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: public.Scheme == "https",
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize MinIO signer: %w", err)
+	}
+
 	storage := &MinIOStorage{
 		client: client,
+		core:   &minio.Core{Client: client},
+		signer: signer,
 		config: config,
 	}
 
@@ -65,19 +92,256 @@ func (s *MinIOStorage) ensureBucket() error {
 	return nil
 }
 
-func (s *MinIOStorage) UploadFile(ctx context.Context, file io.Reader, header *multipart.FileHeader) (string, error) {
-	// Generate unique filename
-	filename := fmt.Sprintf("%d_%s", time.Now().Unix(), header.Filename)
-	objectName := filepath.Join("uploads", filename)
-
-	// Upload file
-	_, err := s.client.PutObject(ctx, s.config.BucketName, objectName, file, header.Size, minio.PutObjectOptions{
-		ContentType: header.Header.Get("Content-Type"),
+func (s *MinIOStorage) PutObject(ctx context.Context, objectName, contentType string, data io.Reader, size int64) error {
+	ctx, span := tracing.Start(ctx, "MinIOStorage.PutObject",
+		attribute.String("storage.bucket", s.config.BucketName),
+		attribute.String("storage.object", objectName),
+		attribute.Int64("storage.size", size),
+	)
+	start := time.Now()
+	_, err := s.client.PutObject(ctx, s.config.BucketName, objectName, data, size, minio.PutObjectOptions{
+		ContentType: contentType,
 	})
+	tracing.End(span, err)
+	if err != nil {
+		metrics.StorageUploadDuration.WithLabelValues("minio", "error").Observe(time.Since(start).Seconds())
+		return err
+	}
+	metrics.StorageUploadDuration.WithLabelValues("minio", "success").Observe(time.Since(start).Seconds())
+	metrics.StorageUploadBytes.WithLabelValues("minio").Observe(float64(size))
+
+	return nil
+}
+
+// PresignedGet returns a URL that downloads objectName until expiry passed
+func (s *MinIOStorage) PresignedGet(ctx context.Context, objectName string, expiry time.Duration) (string, error) {
+	signed, err := s.signer.PresignedGetObject(ctx, s.config.BucketName, objectName, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign %s: %w", objectName, err)
+	}
+	return signed.String(), nil
+}
+
+// PresignedPost returns a URL and the form fields a client posts a file with
+// directly to the bucket. The policy pins the object name, content type and
+// maximum size.
+func (s *MinIOStorage) PresignedPost(ctx context.Context, objectName, contentType string, maxSize int64, expiresAt time.Time) (string, map[string]string, error) {
+	policy := minio.NewPostPolicy()
+	err := policy.SetBucket(s.config.BucketName)
+	if err == nil {
+		err = policy.SetKey(objectName)
+	}
+	if err == nil {
+		err = policy.SetExpires(expiresAt.UTC())
+	}
+	if err == nil {
+		err = policy.SetContentType(contentType)
+	}
+	if err == nil {
+		err = policy.SetContentLengthRange(1, maxSize)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to build upload policy: %w", err)
+	}
+
+	_, formData, err := s.client.PresignedPostPolicy(ctx, policy)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to presign upload: %w", err)
+	}
+
+	// The policy signature does not cover the host, so clients can post to
+	// the public endpoint instead of the one the app talks to
+	return fmt.Sprintf("%s/%s", s.config.PublicEndpoint, s.config.BucketName), formData, nil
+}
+
+// StatObject returns the size of objectName, or ErrObjectNotFound
+func (s *MinIOStorage) StatObject(ctx context.Context, objectName string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "MinIOStorage.StatObject",
+		attribute.String("storage.bucket", s.config.BucketName),
+		attribute.String("storage.object", objectName),
+	)
+	info, err := s.client.StatObject(ctx, s.config.BucketName, objectName, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+		err = ErrObjectNotFound
+	}
+	tracing.End(span, err)
 	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// GetObject opens objectName for reading, the caller closes it
+func (s *MinIOStorage) GetObject(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.config.BucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", objectName, err)
+	}
+	return object, nil
+}
+
+func (s *MinIOStorage) RemoveObject(ctx context.Context, objectName string) error {
+	ctx, span := tracing.Start(ctx, "MinIOStorage.RemoveObject",
+		attribute.String("storage.bucket", s.config.BucketName),
+		attribute.String("storage.object", objectName),
+	)
+	err := s.client.RemoveObject(ctx, s.config.BucketName, objectName, minio.RemoveObjectOptions{})
+	tracing.End(span, err)
+	return err
+}
+
+// MoveObject copies srcName within the bucket, then removes it
+func (s *MinIOStorage) MoveObject(ctx context.Context, srcName, dstName string) error {
+	ctx, span := tracing.Start(ctx, "MinIOStorage.MoveObject",
+		attribute.String("storage.bucket", s.config.BucketName),
+		attribute.String("storage.object", srcName),
+		attribute.String("storage.destination", dstName),
+	)
+	_, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.config.BucketName, Object: dstName},
+		minio.CopySrcOptions{Bucket: s.config.BucketName, Object: srcName},
+	)
+	if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+		err = ErrObjectNotFound
+	}
+	if err == nil {
+		err = s.client.RemoveObject(ctx, s.config.BucketName, srcName, minio.RemoveObjectOptions{})
+	}
+	tracing.End(span, err)
+	return err
+}
+
+func (s *MinIOStorage) NewMultipartUpload(ctx context.Context, objectName, contentType string) (string, error) {
+	ctx, span := tracing.Start(ctx, "MinIOStorage.NewMultipartUpload",
+		attribute.String("storage.bucket", s.config.BucketName),
+		attribute.String("storage.object", objectName),
+	)
+	uploadID, err := s.core.NewMultipartUpload(ctx, s.config.BucketName, objectName, minio.PutObjectOptions{ContentType: contentType})
+	tracing.End(span, err)
+	return uploadID, err
+}
+
+// PutObjectPart has MinIO check the part against sha256Hex as well
+func (s *MinIOStorage) PutObjectPart(ctx context.Context, objectName, uploadID string, partNumber int, data io.Reader, size int64, sha256Hex string) (string, error) {
+	ctx, span := tracing.Start(ctx, "MinIOStorage.PutObjectPart",
+		attribute.String("storage.bucket", s.config.BucketName),
+		attribute.String("storage.object", objectName),
+		attribute.Int("storage.part", partNumber),
+		attribute.Int64("storage.size", size),
+	)
+	start := time.Now()
+	part, err := s.core.PutObjectPart(ctx, s.config.BucketName, objectName, uploadID, partNumber, data, size, minio.PutObjectPartOptions{Sha256Hex: sha256Hex})
+	tracing.End(span, err)
+	if err != nil {
+		metrics.StorageUploadDuration.WithLabelValues("minio", "error").Observe(time.Since(start).Seconds())
 		return "", err
 	}
+	metrics.StorageUploadDuration.WithLabelValues("minio", "success").Observe(time.Since(start).Seconds())
+	metrics.StorageUploadBytes.WithLabelValues("minio").Observe(float64(size))
+
+	return part.ETag, nil
+}
+
+func (s *MinIOStorage) CompleteMultipartUpload(ctx context.Context, objectName, uploadID string, etags []string) error {
+	ctx, span := tracing.Start(ctx, "MinIOStorage.CompleteMultipartUpload",
+		attribute.String("storage.bucket", s.config.BucketName),
+		attribute.String("storage.object", objectName),
+		attribute.Int("storage.parts", len(etags)),
+	)
+	parts := make([]minio.CompletePart, len(etags))
+	for i, etag := range etags {
+		parts[i] = minio.CompletePart{PartNumber: i + 1, ETag: etag}
+	}
+	_, err := s.core.CompleteMultipartUpload(ctx, s.config.BucketName, objectName, uploadID, parts, minio.PutObjectOptions{})
+	tracing.End(span, err)
+	return err
+}
+
+func (s *MinIOStorage) AbortMultipartUpload(ctx context.Context, objectName, uploadID string) error {
+	ctx, span := tracing.Start(ctx, "MinIOStorage.AbortMultipartUpload",
+		attribute.String("storage.bucket", s.config.BucketName),
+		attribute.String("storage.object", objectName),
+	)
+	err := s.core.AbortMultipartUpload(ctx, s.config.BucketName, objectName, uploadID)
+	if minio.ToErrorResponse(err).Code == minio.NoSuchUpload {
+		err = nil
+	}
+	tracing.End(span, err)
+	return err
+}
 
-	// Return public URL
-	return fmt.Sprintf("%s/%s/%s", s.config.PublicEndpoint, s.config.BucketName, objectName), nil
+// AbortStaleMultipartUploads asks the bucket for its unfinished uploads, so
+// parts are found even when the session that knew them is gone
+func (s *MinIOStorage) AbortStaleMultipartUploads(ctx context.Context, cutoff time.Time) (int, error) {
+	ctx, span := tracing.Start(ctx, "MinIOStorage.AbortStaleMultipartUploads",
+		attribute.String("storage.bucket", s.config.BucketName),
+	)
+
+	// Cancelling stops the listing when the loop ends early
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	aborted := 0
+	var err error
+	for upload := range s.client.ListIncompleteUploads(listCtx, s.config.BucketName, "uploads/", true) {
+		if upload.Err != nil {
+			err = upload.Err
+			break
+		}
+		if !upload.Initiated.Before(cutoff) {
+			continue
+		}
+		if err = s.AbortMultipartUpload(ctx, upload.Key, upload.UploadID); err != nil {
+			break
+		}
+		aborted++
+	}
+	tracing.End(span, err)
+	return aborted, err
+}
+
+// RemoveUserFiles deletes every upload in the folder of a user. Uploads made
+// before objects were grouped per user are left alone: the stored imageUri
+// cannot prove who wrote them, it was not checked then.
+func (s *MinIOStorage) RemoveUserFiles(ctx context.Context, ownerID uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "MinIOStorage.RemoveUserFiles",
+		attribute.String("storage.bucket", s.config.BucketName),
+		attribute.String("storage.prefix", userPrefix(ownerID)),
+	)
+
+	var listErr error
+	objects := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objects)
+		for object := range s.client.ListObjects(ctx, s.config.BucketName, minio.ListObjectsOptions{Prefix: userPrefix(ownerID), Recursive: true}) {
+			if object.Err != nil {
+				listErr = object.Err
+				return
+			}
+			objects <- object
+		}
+	}()
+
+	var err error
+	for result := range s.client.RemoveObjects(ctx, s.config.BucketName, objects, minio.RemoveObjectsOptions{}) {
+		if err == nil && result.Err != nil {
+			err = fmt.Errorf("failed to remove %s: %w", result.ObjectName, result.Err)
+		}
+	}
+	// RemoveObjects only finishes once the listing goroutine closed objects
+	if err == nil && listErr != nil {
+		err = fmt.Errorf("failed to list uploads: %w", listErr)
+	}
+	tracing.End(span, err)
+	return err
+}
+
+// ObjectName maps a public URL of the bucket back to its object, images
+// uploaded while the bucket was public are stored with such URLs
+func (s *MinIOStorage) ObjectName(uri string) (string, bool) {
+	prefix := fmt.Sprintf("%s/%s/", s.config.PublicEndpoint, s.config.BucketName)
+	if !strings.HasPrefix(uri, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(uri, prefix), true
 }
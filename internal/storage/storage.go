@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrObjectNotFound is returned for objects missing from the store
+var ErrObjectNotFound = errors.New("object not found")
+
+// Storage is where uploads are kept, MinIO or any S3 compatible service, or
+// the local disk
+type Storage interface {
+	PutObject(ctx context.Context, objectName, contentType string, data io.Reader, size int64) error
+	// GetObject opens objectName for reading, the caller closes it
+	GetObject(ctx context.Context, objectName string) (io.ReadCloser, error)
+	// StatObject returns the size of objectName, or ErrObjectNotFound
+	StatObject(ctx context.Context, objectName string) (int64, error)
+	RemoveObject(ctx context.Context, objectName string) error
+	// MoveObject renames srcName to dstName, ErrObjectNotFound when srcName
+	// is missing
+	MoveObject(ctx context.Context, srcName, dstName string) error
+	// PresignedGet returns a URL that downloads objectName until expiry passed,
+	// objects are never readable without one
+	PresignedGet(ctx context.Context, objectName string, expiry time.Duration) (string, error)
+	// PresignedPost returns a URL and the form fields a client posts a file
+	// with directly to the store
+	PresignedPost(ctx context.Context, objectName, contentType string, maxSize int64, expiresAt time.Time) (string, map[string]string, error)
+	// ObjectName maps an unsigned URL into the store back to its object, such
+	// URLs were handed out before objects became private
+	ObjectName(uri string) (string, bool)
+	// RemoveUserFiles deletes every upload in the folder of a user
+	RemoveUserFiles(ctx context.Context, ownerID uuid.UUID) error
+
+	// Multipart uploads assemble objectName from parts sent one by one and
+	// possibly more than once, parts are numbered from 1. Every part but the
+	// last must be at least MinPartSize.
+	NewMultipartUpload(ctx context.Context, objectName, contentType string) (string, error)
+	// PutObjectPart stores a part whose SHA-256 is sha256Hex and returns its ETag
+	PutObjectPart(ctx context.Context, objectName, uploadID string, partNumber int, data io.Reader, size int64, sha256Hex string) (string, error)
+	// CompleteMultipartUpload joins the parts with etags, in part order
+	CompleteMultipartUpload(ctx context.Context, objectName, uploadID string, etags []string) error
+	AbortMultipartUpload(ctx context.Context, objectName, uploadID string) error
+	// AbortStaleMultipartUploads aborts uploads started before cutoff
+	AbortStaleMultipartUploads(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+// MinPartSize is the smallest part S3 accepts in a multipart upload, except
+// for the last one
+const MinPartSize = 5 * 1024 * 1024
+
+// userPrefix is the folder holding every upload of a user
+func userPrefix(ownerID uuid.UUID) string {
+	return "uploads/" + ownerID.String() + "/"
+}
+
+// IsUserObject reports whether objectName lies in the folder of ownerID
+func IsUserObject(ownerID uuid.UUID, objectName string) bool {
+	return strings.HasPrefix(objectName, userPrefix(ownerID))
+}
+
+// UserObjectPath returns objectName relative to the folder of ownerID
+func UserObjectPath(ownerID uuid.UUID, objectName string) (string, bool) {
+	if !IsUserObject(ownerID, objectName) {
+		return "", false
+	}
+	return strings.TrimPrefix(objectName, userPrefix(ownerID)), true
+}
+
+// UserObjectName places name in the folder of ownerID
+func UserObjectName(ownerID uuid.UUID, name string) string {
+	return path.Join(userPrefix(ownerID), name)
+}
+
+// QuarantineObjectName is where objectName of ownerID waits for its malware
+// scan. It stays in the folder of the user so deleting the account removes it.
+func QuarantineObjectName(ownerID uuid.UUID, objectName string) string {
+	name, ok := UserObjectPath(ownerID, objectName)
+	if !ok {
+		name = path.Base(objectName)
+	}
+	return UserObjectName(ownerID, "quarantine/"+name)
+}
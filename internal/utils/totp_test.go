@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 test key of RFC 6238, "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	// The RFC lists 8 digit codes, these are their last 6 digits
+	tests := []struct {
+		name     string
+		unix     int64
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"rfc 59", 59, "287082", 1, true},
+		{"rfc 1111111109", 1111111109, "081804", 37037036, true},
+		{"rfc 1111111111", 1111111111, "050471", 37037037, true},
+		{"rfc 1234567890", 1234567890, "005924", 41152263, true},
+		{"rfc 2000000000", 2000000000, "279037", 66666666, true},
+		{"rfc 20000000000", 20000000000, "353130", 666666666, true},
+		{"previous step", 89, "287082", 1, true},
+		{"next step", 29, "287082", 1, true},
+		{"too old", 119, "287082", 0, false},
+		{"too early", -31, "287082", 0, false},
+		{"wrong code", 59, "287083", 0, false},
+		{"short code", 59, "28708", 0, false},
+		{"8 digits", 59, "94287082", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0))
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("ValidateTOTP(%q, %d) = %d, %v, want %d, %v", tt.code, tt.unix, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPInvalidSecret(t *testing.T) {
+	if _, ok := ValidateTOTP("not base32!", "287082", time.Unix(59, 0)); ok {
+		t.Error("ValidateTOTP accepted a code for an invalid secret")
+	}
+}
+
+// A code stays valid for its whole window, replays are refused by comparing
+// the step it returns, so every use within the window must report the same one
+func TestValidateTOTPStepIsStableAcrossWindow(t *testing.T) {
+	for unix := int64(30); unix < 90; unix++ {
+		step, ok := ValidateTOTP(rfc6238Secret, "287082", time.Unix(unix, 0))
+		if !ok || step != 1 {
+			t.Fatalf("ValidateTOTP at %d = %d, %v, want 1, true", unix, step, ok)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN sessions_revoked_at TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+
+CREATE INDEX idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL; -- For purging accounts after the grace period
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'coach', 'admin'));
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+
+CREATE TABLE audit_log (
+    id UUID PRIMARY KEY,
+    actor_id UUID, -- NULL for system actions, kept when the actor is deleted
+    action VARCHAR(100) NOT NULL,
+    entity_type VARCHAR(50) NOT NULL,
+    entity_id VARCHAR(255),
+    metadata JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at DESC);
+CREATE INDEX idx_audit_log_actor_id ON audit_log(actor_id);
@@ -0,0 +1,13 @@
+CREATE TABLE coaching_relationships (
+    id UUID PRIMARY KEY,
+    coach_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    trainee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scope VARCHAR(20) NOT NULL CHECK (scope IN ('read', 'read_write')),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'active')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    accepted_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    UNIQUE (coach_id, trainee_id),
+    CHECK (coach_id <> trainee_id)
+);
+
+CREATE INDEX idx_coaching_relationships_trainee_id ON coaching_relationships(trainee_id);
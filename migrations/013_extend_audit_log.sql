@@ -0,0 +1,18 @@
+ALTER TABLE audit_log ADD COLUMN subject_id UUID; -- user the entry concerns, kept after the user is purged
+ALTER TABLE audit_log ADD COLUMN before_data JSONB;
+ALTER TABLE audit_log ADD COLUMN after_data JSONB;
+ALTER TABLE audit_log ADD COLUMN ip_address VARCHAR(45);
+ALTER TABLE audit_log ADD COLUMN user_agent VARCHAR(512);
+
+CREATE INDEX idx_audit_log_subject_id ON audit_log(subject_id, created_at DESC);
+
+-- The audit log is append-only, even for the application's own database user
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update_or_delete
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,26 @@
+-- One row per upload, objects maps each variant name to its object key
+CREATE TABLE files (
+    id UUID PRIMARY KEY,
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    objects JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    -- Set while nothing references the file, the garbage collector removes
+    -- files that stayed unreferenced for the grace period
+    unreferenced_since TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_files_owner_id ON files(owner_id);
+CREATE INDEX idx_files_unreferenced_since ON files(unreferenced_since) WHERE unreferenced_since IS NOT NULL;
+
+-- Entities using a file, like a profile picture
+CREATE TABLE file_references (
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    entity_type VARCHAR(50) NOT NULL,
+    entity_id VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (entity_type, entity_id)
+);
+
+CREATE INDEX idx_file_references_file_id ON file_references(file_id);
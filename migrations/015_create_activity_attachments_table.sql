@@ -0,0 +1,9 @@
+CREATE TABLE activity_attachments (
+    id UUID PRIMARY KEY,
+    activity_id UUID NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_activity_attachments_activity_id ON activity_attachments(activity_id, created_at);
@@ -0,0 +1,11 @@
+-- Uploads wait in quarantine until the malware scan promotes them. Files
+-- stored before scanning existed, or while it is disabled, are 'unscanned'.
+ALTER TABLE files ADD COLUMN scan_status VARCHAR(20) NOT NULL DEFAULT 'unscanned'
+    CHECK (scan_status IN ('unscanned', 'pending', 'clean', 'infected', 'failed'));
+ALTER TABLE files ADD COLUMN scan_signature VARCHAR(255) DEFAULT NULL;
+ALTER TABLE files ADD COLUMN scan_attempts INT NOT NULL DEFAULT 0;
+-- Set while a worker scans the file, a stale value lets another worker retry
+ALTER TABLE files ADD COLUMN scan_started_at TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+ALTER TABLE files ADD COLUMN scanned_at TIMESTAMP WITH TIME ZONE DEFAULT NULL;
+
+CREATE INDEX idx_files_scan_pending ON files(created_at) WHERE scan_status = 'pending'; -- For the scan worker
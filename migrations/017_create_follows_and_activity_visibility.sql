@@ -0,0 +1,14 @@
+-- Users follow each other, two users following each other are friends
+CREATE TABLE follows (
+    follower_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX idx_follows_followee_id ON follows(followee_id, created_at DESC); -- For listing followers
+
+-- Who sees an activity in the feed, existing activities stay private
+ALTER TABLE activities ADD COLUMN visibility VARCHAR(20) NOT NULL DEFAULT 'private'
+    CHECK (visibility IN ('private', 'friends', 'public'));